@@ -0,0 +1,394 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Overall verdicts reported in TestResponse.Verdict
+const (
+	verdictPass = "pass"
+	verdictFail = "fail"
+)
+
+// Assertion types reported in AssertionResult.Type
+const (
+	assertStatus       = "status"
+	assertHeader       = "header"
+	assertBodyContains = "bodyContains"
+	assertBodyRegex    = "bodyRegex"
+	assertJSONPath     = "jsonPath"
+	assertResponseTime = "responseTime"
+	assertTLSDays      = "tlsDays"
+)
+
+// Assertions declares expectations on the response of a test
+type Assertions struct {
+	Status          []string            `json:"status,omitempty"` // codes, classes or ranges: "200", "2xx", "200-299"
+	Headers         []HeaderAssertion   `json:"headers,omitempty"`
+	BodyContains    []string            `json:"bodyContains,omitempty"`
+	BodyRegex       []string            `json:"bodyRegex,omitempty"`
+	JSONPath        []JSONPathAssertion `json:"jsonPath,omitempty"`
+	MaxResponseTime int64               `json:"maxResponseTime,omitempty"` // milliseconds
+	MinTLSDays      *int                `json:"minTlsDays,omitempty"`      // days until the leaf certificate expires
+}
+
+// HeaderAssertion checks a response header; with only a name it checks the header is present
+type HeaderAssertion struct {
+	Name    string `json:"name"`
+	Equals  string `json:"equals,omitempty"`
+	Matches string `json:"matches,omitempty"` // regular expression
+	Absent  bool   `json:"absent,omitempty"`  // the header must not be present
+}
+
+// JSONPathAssertion checks a value in a JSON body, e.g. $.data.items[0].id
+// Without equals it checks the value exists
+type JSONPathAssertion struct {
+	Path   string          `json:"path"`
+	Equals json.RawMessage `json:"equals,omitempty"`
+}
+
+// AssertionResult is the outcome of one assertion
+type AssertionResult struct {
+	Type     string `json:"type"`
+	Target   string `json:"target,omitempty"` // header name or JSON path
+	Expected string `json:"expected"`
+	Actual   string `json:"actual"`
+	Passed   bool   `json:"passed"`
+}
+
+// statusRange is an inclusive range of status codes
+type statusRange struct {
+	min, max int
+}
+
+// parseStatusRange parses "200", "2xx" or "200-299"
+func parseStatusRange(spec string) (statusRange, error) {
+	spec = strings.ToLower(strings.TrimSpace(spec))
+	invalid := fmt.Errorf("invalid status %q", spec)
+
+	if len(spec) == 3 && strings.HasSuffix(spec, "xx") {
+		class := int(spec[0] - '0')
+		if class < 1 || class > 5 {
+			return statusRange{}, invalid
+		}
+		return statusRange{class * 100, class*100 + 99}, nil
+	}
+
+	lo, hi, isRange := strings.Cut(spec, "-")
+	from, err := strconv.Atoi(strings.TrimSpace(lo))
+	if err != nil {
+		return statusRange{}, invalid
+	}
+	to := from
+	if isRange {
+		if to, err = strconv.Atoi(strings.TrimSpace(hi)); err != nil {
+			return statusRange{}, invalid
+		}
+	}
+	if from < 100 || to > 599 || from > to {
+		return statusRange{}, invalid
+	}
+	return statusRange{from, to}, nil
+}
+
+// validateAssertions checks that every assertion can be evaluated
+func validateAssertions(a *Assertions) string {
+	if a == nil {
+		return ""
+	}
+	for _, spec := range a.Status {
+		if _, err := parseStatusRange(spec); err != nil {
+			return "Invalid status assertion: " + err.Error()
+		}
+	}
+	for _, h := range a.Headers {
+		if !isValidHeaderName(h.Name) {
+			return "Invalid header assertion name: " + h.Name
+		}
+		if h.Matches != "" {
+			if _, err := regexp.Compile(h.Matches); err != nil {
+				return "Invalid header assertion regex: " + err.Error()
+			}
+		}
+	}
+	for _, pattern := range a.BodyRegex {
+		if _, err := regexp.Compile(pattern); err != nil {
+			return "Invalid body regex: " + err.Error()
+		}
+	}
+	for _, jp := range a.JSONPath {
+		if _, err := parseJSONPath(jp.Path); err != nil {
+			return "Invalid JSON path: " + err.Error()
+		}
+		if len(jp.Equals) > 0 && !json.Valid(jp.Equals) {
+			return "Invalid JSON value for path " + jp.Path
+		}
+	}
+	if a.MaxResponseTime < 0 {
+		return "maxResponseTime must not be negative"
+	}
+	return ""
+}
+
+// applyAssertions evaluates the request's assertions against response and the full body
+// and sets the assertion results and verdict. Assertions fail when there is no response.
+func applyAssertions(response *TestResponse, a *Assertions, body []byte) {
+	if a == nil {
+		return
+	}
+	response.Assertions = evaluateAssertions(a, *response, body)
+	response.Verdict = verdictPass
+	if !response.Success {
+		response.Verdict = verdictFail
+	}
+	for _, result := range response.Assertions {
+		if !result.Passed {
+			response.Verdict = verdictFail
+		}
+	}
+}
+
+// evaluateAssertions returns one result per assertion
+func evaluateAssertions(a *Assertions, response TestResponse, body []byte) []AssertionResult {
+	var results []AssertionResult
+	noResponse := "no response"
+
+	if len(a.Status) > 0 {
+		result := AssertionResult{Type: assertStatus, Expected: strings.Join(a.Status, ", "), Actual: noResponse}
+		if response.Success {
+			result.Actual = strconv.Itoa(response.StatusCode)
+			for _, spec := range a.Status {
+				r, _ := parseStatusRange(spec)
+				if response.StatusCode >= r.min && response.StatusCode <= r.max {
+					result.Passed = true
+				}
+			}
+		}
+		results = append(results, result)
+	}
+
+	for _, h := range a.Headers {
+		results = append(results, evaluateHeaderAssertion(h, response))
+	}
+
+	for _, text := range a.BodyContains {
+		result := AssertionResult{Type: assertBodyContains, Expected: text, Actual: noResponse}
+		if response.Success {
+			result.Passed = bytes.Contains(body, []byte(text))
+			result.Actual = "not found"
+			if result.Passed {
+				result.Actual = "found"
+			}
+		}
+		results = append(results, result)
+	}
+
+	for _, pattern := range a.BodyRegex {
+		result := AssertionResult{Type: assertBodyRegex, Expected: pattern, Actual: noResponse}
+		if response.Success {
+			re, _ := regexp.Compile(pattern)
+			result.Actual = "no match"
+			if match := re.Find(body); match != nil {
+				result.Passed = true
+				result.Actual = truncateString(string(match), 100)
+			}
+		}
+		results = append(results, result)
+	}
+
+	if len(a.JSONPath) > 0 {
+		var doc interface{}
+		var docErr error
+		if response.Success {
+			docErr = json.Unmarshal(body, &doc)
+		}
+		for _, jp := range a.JSONPath {
+			results = append(results, evaluateJSONPathAssertion(jp, response.Success, doc, docErr))
+		}
+	}
+
+	if a.MaxResponseTime > 0 {
+		result := AssertionResult{Type: assertResponseTime, Expected: fmt.Sprintf("<= %dms", a.MaxResponseTime), Actual: noResponse}
+		if response.Success {
+			result.Actual = fmt.Sprintf("%dms", response.ResponseTime)
+			result.Passed = response.ResponseTime <= a.MaxResponseTime
+		}
+		results = append(results, result)
+	}
+
+	if a.MinTLSDays != nil {
+		result := AssertionResult{Type: assertTLSDays, Expected: fmt.Sprintf(">= %d days", *a.MinTLSDays), Actual: noResponse}
+		switch {
+		case !response.Success:
+		case response.TLS == nil || len(response.TLS.Certificates) == 0:
+			result.Actual = "no TLS certificate"
+		default:
+			days := response.TLS.Certificates[0].DaysUntilExpiry
+			result.Actual = fmt.Sprintf("%d days", days)
+			result.Passed = days >= *a.MinTLSDays
+		}
+		results = append(results, result)
+	}
+
+	return results
+}
+
+// evaluateHeaderAssertion checks one header assertion
+func evaluateHeaderAssertion(h HeaderAssertion, response TestResponse) AssertionResult {
+	result := AssertionResult{Type: assertHeader, Target: h.Name, Actual: "no response"}
+	switch {
+	case h.Absent:
+		result.Expected = "absent"
+	case h.Equals != "":
+		result.Expected = h.Equals
+	case h.Matches != "":
+		result.Expected = "matches " + h.Matches
+	default:
+		result.Expected = "present"
+	}
+	if !response.Success {
+		return result
+	}
+
+	value, present := response.Headers[http.CanonicalHeaderKey(h.Name)]
+	result.Actual = value
+	if !present {
+		result.Actual = "absent"
+	}
+
+	switch {
+	case h.Absent:
+		result.Passed = !present
+	case !present:
+	case h.Equals != "":
+		result.Passed = value == h.Equals
+	case h.Matches != "":
+		re, _ := regexp.Compile(h.Matches)
+		result.Passed = re.MatchString(value)
+	default:
+		result.Passed = true
+	}
+	return result
+}
+
+// evaluateJSONPathAssertion checks one JSON path assertion against the decoded body
+func evaluateJSONPathAssertion(jp JSONPathAssertion, hasResponse bool, doc interface{}, docErr error) AssertionResult {
+	result := AssertionResult{Type: assertJSONPath, Target: jp.Path, Expected: "exists", Actual: "no response"}
+	if len(jp.Equals) > 0 {
+		result.Expected = string(jp.Equals)
+	}
+	if !hasResponse {
+		return result
+	}
+	if docErr != nil {
+		result.Actual = "body is not valid JSON"
+		return result
+	}
+
+	steps, _ := parseJSONPath(jp.Path)
+	value, found := lookupJSONPath(doc, steps)
+	if !found {
+		result.Actual = "not found"
+		return result
+	}
+	encoded, _ := json.Marshal(value)
+	result.Actual = truncateString(string(encoded), 100)
+
+	if len(jp.Equals) == 0 {
+		result.Passed = true
+		return result
+	}
+	var expected interface{}
+	json.Unmarshal(jp.Equals, &expected)
+	result.Passed = reflect.DeepEqual(value, expected)
+	return result
+}
+
+// jsonPathStep is a single object key or array index of a JSON path
+type jsonPathStep struct {
+	key     string
+	index   int
+	isIndex bool
+}
+
+// parseJSONPath parses a simple JSON path: $.key.nested[0]["other key"]
+func parseJSONPath(path string) ([]jsonPathStep, error) {
+	if !strings.HasPrefix(path, "$") {
+		return nil, fmt.Errorf("%q must start with $", path)
+	}
+
+	var steps []jsonPathStep
+	rest := path[1:]
+	for rest != "" {
+		switch {
+		case rest[0] == '.':
+			end := strings.IndexAny(rest[1:], ".[")
+			if end < 0 {
+				end = len(rest) - 1
+			}
+			key := rest[1 : end+1]
+			if key == "" {
+				return nil, fmt.Errorf("%q has an empty key", path)
+			}
+			steps = append(steps, jsonPathStep{key: key})
+			rest = rest[end+1:]
+		case rest[0] == '[':
+			end := strings.IndexByte(rest, ']')
+			if end < 0 {
+				return nil, fmt.Errorf("%q has an unclosed [", path)
+			}
+			inner := rest[1:end]
+			if len(inner) >= 2 && (inner[0] == '"' || inner[0] == '\'') && inner[len(inner)-1] == inner[0] {
+				steps = append(steps, jsonPathStep{key: inner[1 : len(inner)-1]})
+			} else {
+				index, err := strconv.Atoi(inner)
+				if err != nil || index < 0 {
+					return nil, fmt.Errorf("%q has an invalid index %q", path, inner)
+				}
+				steps = append(steps, jsonPathStep{index: index, isIndex: true})
+			}
+			rest = rest[end+1:]
+		default:
+			return nil, fmt.Errorf("%q is not a valid path", path)
+		}
+	}
+	return steps, nil
+}
+
+// lookupJSONPath follows steps through a decoded JSON document
+func lookupJSONPath(doc interface{}, steps []jsonPathStep) (interface{}, bool) {
+	current := doc
+	for _, step := range steps {
+		if step.isIndex {
+			items, ok := current.([]interface{})
+			if !ok || step.index >= len(items) {
+				return nil, false
+			}
+			current = items[step.index]
+			continue
+		}
+		object, ok := current.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		if current, ok = object[step.key]; !ok {
+			return nil, false
+		}
+	}
+	return current, true
+}
+
+// truncateString shortens s to at most limit bytes, marking the cut with "..."
+func truncateString(s string, limit int) string {
+	if len(s) <= limit {
+		return s
+	}
+	return s[:limit] + "..."
+}
@@ -0,0 +1,246 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestParseStatusRange(t *testing.T) {
+	tests := []struct {
+		spec    string
+		want    statusRange
+		wantErr bool
+	}{
+		{spec: "200", want: statusRange{200, 200}},
+		{spec: "2xx", want: statusRange{200, 299}},
+		{spec: "4XX", want: statusRange{400, 499}},
+		{spec: "200-204", want: statusRange{200, 204}},
+		{spec: " 301 - 308 ", want: statusRange{301, 308}},
+		{spec: "6xx", wantErr: true},
+		{spec: "99", wantErr: true},
+		{spec: "300-200", wantErr: true},
+		{spec: "abc", wantErr: true},
+		{spec: "200-", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := parseStatusRange(tt.spec)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("%q: expected error", tt.spec)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("%q: expected %v, got %v (%v)", tt.spec, tt.want, got, err)
+		}
+	}
+}
+
+func TestJSONPath(t *testing.T) {
+	var doc interface{}
+	json.Unmarshal([]byte(`{"data": {"items": [{"id": 1}, {"id": 2, "tags": ["a"]}]}, "odd key": true, "n": null}`), &doc)
+
+	tests := []struct {
+		path  string
+		value string
+		found bool
+	}{
+		{"$", "", true},
+		{"$.data.items[1].id", "2", true},
+		{"$.data.items[1].tags[0]", `"a"`, true},
+		{`$["odd key"]`, "true", true},
+		{"$['data'].items[0]", `{"id":1}`, true},
+		{"$.n", "null", true},
+		{"$.data.items[5]", "", false},
+		{"$.data.missing", "", false},
+		{"$.data.items.id", "", false},
+	}
+
+	for _, tt := range tests {
+		steps, err := parseJSONPath(tt.path)
+		if err != nil {
+			t.Fatalf("%q: unexpected error: %v", tt.path, err)
+		}
+		value, found := lookupJSONPath(doc, steps)
+		if found != tt.found {
+			t.Errorf("%q: expected found=%v", tt.path, tt.found)
+			continue
+		}
+		if found && tt.value != "" {
+			encoded, _ := json.Marshal(value)
+			if string(encoded) != tt.value {
+				t.Errorf("%q: expected %s, got %s", tt.path, tt.value, encoded)
+			}
+		}
+	}
+
+	for _, path := range []string{"data.id", "$.", "$[x]", "$[0", "$..a", "$a"} {
+		if _, err := parseJSONPath(path); err == nil {
+			t.Errorf("%q: expected error", path)
+		}
+	}
+}
+
+func TestEvaluateAssertions(t *testing.T) {
+	days := 30
+	response := TestResponse{
+		Success:      true,
+		StatusCode:   200,
+		ResponseTime: 120,
+		Headers:      map[string]string{"Content-Type": "application/json; charset=utf-8", "Cache-Control": "no-store"},
+		TLS:          &TLSInfo{Certificates: []CertificateInfo{{DaysUntilExpiry: 45}}},
+	}
+	body := []byte(`{"status": "ok", "count": 3}`)
+
+	tests := []struct {
+		name   string
+		assert Assertions
+		passed bool
+	}{
+		{"status match", Assertions{Status: []string{"201", "2xx"}}, true},
+		{"status mismatch", Assertions{Status: []string{"3xx", "400-499"}}, false},
+		{"header present", Assertions{Headers: []HeaderAssertion{{Name: "cache-control"}}}, true},
+		{"header missing", Assertions{Headers: []HeaderAssertion{{Name: "ETag"}}}, false},
+		{"header absent", Assertions{Headers: []HeaderAssertion{{Name: "Set-Cookie", Absent: true}}}, true},
+		{"header not absent", Assertions{Headers: []HeaderAssertion{{Name: "Cache-Control", Absent: true}}}, false},
+		{"header equals", Assertions{Headers: []HeaderAssertion{{Name: "Cache-Control", Equals: "no-store"}}}, true},
+		{"header not equal", Assertions{Headers: []HeaderAssertion{{Name: "Cache-Control", Equals: "public"}}}, false},
+		{"header matches", Assertions{Headers: []HeaderAssertion{{Name: "Content-Type", Matches: "^application/json"}}}, true},
+		{"header does not match", Assertions{Headers: []HeaderAssertion{{Name: "Content-Type", Matches: "^text/"}}}, false},
+		{"body contains", Assertions{BodyContains: []string{`"ok"`}}, true},
+		{"body does not contain", Assertions{BodyContains: []string{"error"}}, false},
+		{"body regex", Assertions{BodyRegex: []string{`"count":\s*\d+`}}, true},
+		{"body regex no match", Assertions{BodyRegex: []string{`^<html`}}, false},
+		{"json equals number", Assertions{JSONPath: []JSONPathAssertion{{Path: "$.count", Equals: json.RawMessage("3")}}}, true},
+		{"json equals string", Assertions{JSONPath: []JSONPathAssertion{{Path: "$.status", Equals: json.RawMessage(`"ok"`)}}}, true},
+		{"json not equal", Assertions{JSONPath: []JSONPathAssertion{{Path: "$.status", Equals: json.RawMessage(`"down"`)}}}, false},
+		{"json exists", Assertions{JSONPath: []JSONPathAssertion{{Path: "$.count"}}}, true},
+		{"json missing", Assertions{JSONPath: []JSONPathAssertion{{Path: "$.missing"}}}, false},
+		{"response time ok", Assertions{MaxResponseTime: 500}, true},
+		{"response time too slow", Assertions{MaxResponseTime: 100}, false},
+		{"tls days ok", Assertions{MinTLSDays: &days}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			results := evaluateAssertions(&tt.assert, response, body)
+			if len(results) != 1 {
+				t.Fatalf("expected 1 result, got %d", len(results))
+			}
+			if results[0].Passed != tt.passed {
+				t.Errorf("expected passed=%v, got %+v", tt.passed, results[0])
+			}
+		})
+	}
+
+	// Test non-JSON body
+	t.Run("json path on html body", func(t *testing.T) {
+		results := evaluateAssertions(&Assertions{JSONPath: []JSONPathAssertion{{Path: "$.a"}}}, response, []byte("<html>"))
+		if results[0].Passed || results[0].Actual != "body is not valid JSON" {
+			t.Errorf("unexpected result: %+v", results[0])
+		}
+	})
+
+	// Test plain HTTP has no TLS days
+	t.Run("tls days without tls", func(t *testing.T) {
+		results := evaluateAssertions(&Assertions{MinTLSDays: &days}, TestResponse{Success: true, StatusCode: 200}, nil)
+		if results[0].Passed {
+			t.Errorf("expected failure without TLS")
+		}
+	})
+
+	// Test every assertion fails without a response
+	t.Run("no response", func(t *testing.T) {
+		failed := TestResponse{Success: false, Error: "connection refused"}
+		applyAssertions(&failed, &Assertions{Status: []string{"2xx"}, Headers: []HeaderAssertion{{Name: "X", Absent: true}}}, nil)
+		if failed.Verdict != verdictFail || len(failed.Assertions) != 2 {
+			t.Fatalf("unexpected verdict %q with %d results", failed.Verdict, len(failed.Assertions))
+		}
+		for _, result := range failed.Assertions {
+			if result.Passed || result.Actual != "no response" {
+				t.Errorf("unexpected result: %+v", result)
+			}
+		}
+	})
+}
+
+func TestValidateAssertions(t *testing.T) {
+	tests := []struct {
+		name    string
+		assert  *Assertions
+		wantErr string
+	}{
+		{name: "nil", assert: nil},
+		{name: "valid", assert: &Assertions{Status: []string{"2xx"}, BodyRegex: []string{"ok"}, JSONPath: []JSONPathAssertion{{Path: "$.a", Equals: json.RawMessage("1")}}}},
+		{name: "bad status", assert: &Assertions{Status: []string{"abc"}}, wantErr: "Invalid status assertion"},
+		{name: "bad header name", assert: &Assertions{Headers: []HeaderAssertion{{Name: "Bad Header"}}}, wantErr: "Invalid header assertion name"},
+		{name: "bad header regex", assert: &Assertions{Headers: []HeaderAssertion{{Name: "X", Matches: "("}}}, wantErr: "Invalid header assertion regex"},
+		{name: "bad body regex", assert: &Assertions{BodyRegex: []string{"[a-"}}, wantErr: "Invalid body regex"},
+		{name: "bad json path", assert: &Assertions{JSONPath: []JSONPathAssertion{{Path: "a.b"}}}, wantErr: "Invalid JSON path"},
+		{name: "negative response time", assert: &Assertions{MaxResponseTime: -1}, wantErr: "maxResponseTime"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := validateAssertions(tt.assert)
+			if tt.wantErr == "" && got != "" {
+				t.Errorf("expected no error, got %q", got)
+			}
+			if tt.wantErr != "" && !strings.Contains(got, tt.wantErr) {
+				t.Errorf("expected error containing %q, got %q", tt.wantErr, got)
+			}
+		})
+	}
+}
+
+func TestAssertionsInResponse(t *testing.T) {
+	// Body longer than the preview so assertions must use the full body
+	body := `{"padding": "` + strings.Repeat("x", 2000) + `", "status": "ok"}`
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(body))
+	}))
+	defer server.Close()
+
+	reqBody := `{"url": "` + server.URL + `", "assert": {
+		"status": ["200"],
+		"headers": [{"name": "Content-Type", "equals": "application/json"}],
+		"bodyContains": ["\"status\": \"ok\""],
+		"jsonPath": [{"path": "$.status", "equals": "ok"}, {"path": "$.missing"}]
+	}}`
+	req := httptest.NewRequest(http.MethodPost, "/api/test", strings.NewReader(reqBody))
+	w := httptest.NewRecorder()
+	testURLHandler(w, req)
+
+	var response TestResponse
+	if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if !response.Truncated {
+		t.Errorf("expected body preview to be truncated")
+	}
+	if response.Verdict != verdictFail {
+		t.Errorf("expected verdict fail, got %q", response.Verdict)
+	}
+	if len(response.Assertions) != 5 {
+		t.Fatalf("expected 5 assertion results, got %d", len(response.Assertions))
+	}
+	for i, result := range response.Assertions {
+		wantPassed := i != 4
+		if result.Passed != wantPassed {
+			t.Errorf("assertion %d: expected passed=%v, got %+v", i, wantPassed, result)
+		}
+	}
+
+	// Test invalid assertions are rejected
+	req = httptest.NewRequest(http.MethodPost, "/api/test", strings.NewReader(`{"url": "`+server.URL+`", "assert": {"bodyRegex": ["("]}}`))
+	w = httptest.NewRecorder()
+	testURLHandler(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("expected status code 400, got %d", w.Code)
+	}
+}
@@ -0,0 +1,401 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Batch limits
+const (
+	maxBatchSize              = 1000
+	defaultBatchConcurrency   = 10
+	maxBatchConcurrency       = 50
+	defaultPerHostConcurrency = 2
+	maxBatchUploadBytes       = 1 << 20
+)
+
+// BatchRequest represents a bulk URL test request
+type BatchRequest struct {
+	Requests           []TestRequest `json:"requests"`
+	Concurrency        int           `json:"concurrency,omitempty"`        // total parallel tests, defaults to 10
+	PerHostConcurrency int           `json:"perHostConcurrency,omitempty"` // parallel tests per host, defaults to 2
+}
+
+// BatchResult is the result of one test in a batch
+type BatchResult struct {
+	Index int    `json:"index"`
+	URL   string `json:"url"`
+	TestResponse
+}
+
+// BatchSummary aggregates the results of a batch
+type BatchSummary struct {
+	Total         int            `json:"total"`
+	Succeeded     int            `json:"succeeded"` // got an HTTP response
+	Errored       int            `json:"errored"`
+	Blocked       int            `json:"blocked"`
+	StatusClasses map[string]int `json:"statusClasses"` // e.g. {"2xx": 10, "4xx": 2}
+	LatencyP50    int64          `json:"latencyP50"`    // milliseconds
+	LatencyP95    int64          `json:"latencyP95"`    // milliseconds
+	Duration      int64          `json:"duration"`      // milliseconds for the whole batch
+}
+
+// BatchResponse is returned by POST /api/batch
+type BatchResponse struct {
+	Results []BatchResult `json:"results"`
+	Summary BatchSummary  `json:"summary"`
+}
+
+// batchHandler handles POST /api/batch requests
+// Accepts a JSON BatchRequest, or a newline/CSV list of URLs (raw body or multipart "file" field)
+func batchHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxBatchUploadBytes)
+	batch, err := parseBatchRequest(r)
+	if err != nil {
+		status := http.StatusBadRequest
+		if errors.Is(err, errBatchTooLarge) {
+			status = http.StatusRequestEntityTooLarge
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+
+	if validationErr := validateBatchRequest(batch); validationErr != "" {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": validationErr})
+		return
+	}
+
+	// Run in the background and stream progress over Server-Sent Events
+	if r.URL.Query().Get("async") == "true" {
+		job, err := batchJobs.start(r.Context(), batch)
+		if err != nil {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusTooManyRequests)
+			json.NewEncoder(w).Encode(map[string]string{"error": "Too many batch jobs running, try again later"})
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"id":        job.id,
+			"total":     job.total,
+			"eventsUrl": "/api/batch/" + job.id + "/events",
+		})
+		return
+	}
+
+	start := time.Now()
+	results := runBatch(r.Context(), batch, nil)
+	summary := summarizeBatch(results)
+	summary.Duration = time.Since(start).Milliseconds()
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(BatchResponse{Results: results, Summary: summary})
+}
+
+// errBatchTooLarge is returned by parseBatchRequest for bodies over maxBatchUploadBytes
+var errBatchTooLarge = fmt.Errorf("Batch upload exceeds %d bytes", maxBatchUploadBytes)
+
+// parseBatchRequest reads a batch from a JSON body, a text/CSV body or a multipart upload
+// The caller limits the body to maxBatchUploadBytes with http.MaxBytesReader
+func parseBatchRequest(r *http.Request) (BatchRequest, error) {
+	var batch BatchRequest
+	tooLarge := func(err error) bool {
+		var maxErr *http.MaxBytesError
+		return errors.As(err, &maxErr)
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	switch mediaType {
+	case "", "application/json":
+		if err := json.NewDecoder(r.Body).Decode(&batch); err != nil {
+			if tooLarge(err) {
+				return batch, errBatchTooLarge
+			}
+			return batch, errors.New("Invalid JSON")
+		}
+		return batch, nil
+	case "multipart/form-data":
+		// The whole body fits in memory, so nothing is written to temporary files
+		if err := r.ParseMultipartForm(maxBatchUploadBytes); err != nil {
+			if tooLarge(err) {
+				return batch, errBatchTooLarge
+			}
+			return batch, fmt.Errorf("Invalid upload: %v", err)
+		}
+		file, header, err := r.FormFile("file")
+		if err != nil {
+			return batch, errors.New("Missing upload field \"file\"")
+		}
+		defer file.Close()
+		batch.Requests, err = parseURLList(file, strings.HasSuffix(strings.ToLower(header.Filename), ".csv"))
+		if err != nil {
+			return batch, err
+		}
+	case "text/csv", "text/plain":
+		requests, err := parseURLList(r.Body, mediaType == "text/csv")
+		if tooLarge(err) {
+			return batch, errBatchTooLarge
+		}
+		if err != nil {
+			return batch, err
+		}
+		batch.Requests = requests
+	default:
+		return batch, fmt.Errorf("Unsupported content type: %s", mediaType)
+	}
+
+	// Text uploads take options from the query string
+	query := r.URL.Query()
+	batch.Concurrency, _ = strconv.Atoi(query.Get("concurrency"))
+	batch.PerHostConcurrency, _ = strconv.Atoi(query.Get("perHostConcurrency"))
+	return batch, nil
+}
+
+// parseURLList parses one URL per line, or CSV rows with url and optional method columns
+// Blank lines and lines starting with # are ignored; a CSV header row is detected by its "url" column
+func parseURLList(r io.Reader, isCSV bool) ([]TestRequest, error) {
+	var requests []TestRequest
+
+	if !isCSV {
+		scanner := bufio.NewScanner(r)
+		for scanner.Scan() {
+			line := strings.TrimSpace(scanner.Text())
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+			requests = append(requests, TestRequest{URL: line})
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, fmt.Errorf("Invalid upload: %w", err)
+		}
+		return requests, nil
+	}
+
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.Comment = '#'
+	reader.TrimLeadingSpace = true
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("Invalid CSV: %w", err)
+	}
+
+	urlCol, methodCol := 0, -1
+	if len(records) > 0 {
+		for i, col := range records[0] {
+			switch strings.ToLower(strings.TrimSpace(col)) {
+			case "url":
+				urlCol = i
+			case "method":
+				methodCol = i
+			}
+		}
+		if methodCol >= 0 || strings.EqualFold(strings.TrimSpace(records[0][urlCol]), "url") {
+			records = records[1:]
+		}
+	}
+
+	for _, record := range records {
+		if urlCol >= len(record) || strings.TrimSpace(record[urlCol]) == "" {
+			continue
+		}
+		req := TestRequest{URL: strings.TrimSpace(record[urlCol])}
+		if methodCol >= 0 && methodCol < len(record) {
+			req.Method = strings.TrimSpace(record[methodCol])
+		}
+		requests = append(requests, req)
+	}
+	return requests, nil
+}
+
+// validateBatchRequest checks batch size and concurrency options
+// Individual requests are validated when run so one bad line does not reject the batch
+func validateBatchRequest(batch BatchRequest) string {
+	if len(batch.Requests) == 0 {
+		return "At least one request is required"
+	}
+	if len(batch.Requests) > maxBatchSize {
+		return fmt.Sprintf("Batch exceeds maximum of %d requests", maxBatchSize)
+	}
+	if batch.Concurrency < 0 || batch.Concurrency > maxBatchConcurrency {
+		return fmt.Sprintf("concurrency must be between 1 and %d", maxBatchConcurrency)
+	}
+	if batch.PerHostConcurrency < 0 || batch.PerHostConcurrency > maxBatchConcurrency {
+		return fmt.Sprintf("perHostConcurrency must be between 1 and %d", maxBatchConcurrency)
+	}
+	return ""
+}
+
+// hostLimiter bounds the number of concurrent tests per host
+type hostLimiter struct {
+	limit int
+
+	mu   sync.Mutex
+	sems map[string]chan struct{}
+}
+
+// newHostLimiter creates a limiter allowing limit concurrent tests per host
+func newHostLimiter(limit int) *hostLimiter {
+	return &hostLimiter{limit: limit, sems: make(map[string]chan struct{})}
+}
+
+// acquire blocks until a slot for host is available
+func (l *hostLimiter) acquire(host string) {
+	l.mu.Lock()
+	sem, ok := l.sems[host]
+	if !ok {
+		sem = make(chan struct{}, l.limit)
+		l.sems[host] = sem
+	}
+	l.mu.Unlock()
+	sem <- struct{}{}
+}
+
+// release frees a slot for host
+func (l *hostLimiter) release(host string) {
+	l.mu.Lock()
+	sem := l.sems[host]
+	l.mu.Unlock()
+	<-sem
+}
+
+// runBatch tests every request with a bounded worker pool and returns results in request order
+// onResult, if not nil, is called as each test completes
+func runBatch(ctx context.Context, batch BatchRequest, onResult func(BatchResult)) []BatchResult {
+	concurrency := batch.Concurrency
+	if concurrency == 0 {
+		concurrency = defaultBatchConcurrency
+	}
+	perHost := batch.PerHostConcurrency
+	if perHost == 0 {
+		perHost = defaultPerHostConcurrency
+	}
+
+	results := make([]BatchResult, len(batch.Requests))
+	limiter := newHostLimiter(perHost)
+	jobs := make(chan int)
+
+	var wg sync.WaitGroup
+	for i := 0; i < concurrency && i < len(batch.Requests); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for index := range jobs {
+				results[index] = runBatchItem(ctx, index, batch.Requests[index], limiter)
+				if onResult != nil {
+					onResult(results[index])
+				}
+			}
+		}()
+	}
+	// Stop handing out requests once the client is gone; the rest are reported as canceled
+	sent := 0
+feed:
+	for ; sent < len(batch.Requests); sent++ {
+		select {
+		case jobs <- sent:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(jobs)
+	wg.Wait()
+	for i := sent; i < len(batch.Requests); i++ {
+		results[i] = BatchResult{Index: i, URL: batch.Requests[i].URL, TestResponse: TestResponse{
+			Success:    false,
+			Error:      "request canceled",
+			ErrorCode:  "canceled",
+			ErrorPhase: phaseRequest,
+		}}
+	}
+
+	return results
+}
+
+// runBatchItem validates and tests one request of a batch
+func runBatchItem(ctx context.Context, index int, req TestRequest, limiter *hostLimiter) BatchResult {
+	result := BatchResult{Index: index, URL: req.URL}
+
+	if validationErr := validateRequest(req); validationErr != "" {
+		result.TestResponse = TestResponse{
+			Success:    false,
+			Error:      validationErr,
+			ErrorCode:  "invalid_request",
+			ErrorPhase: phaseRequest,
+		}
+		return result
+	}
+
+	host := req.URL
+	if parsedURL, err := url.Parse(req.URL); err == nil {
+		host = strings.ToLower(parsedURL.Hostname())
+	}
+	limiter.acquire(host)
+	defer limiter.release(host)
+
+	result.TestResponse = recordResult(ctx, sourceBatch, "", req, testURLContext(ctx, req)).Response
+	return result
+}
+
+// summarizeBatch aggregates counts and latency percentiles over batch results
+func summarizeBatch(results []BatchResult) BatchSummary {
+	summary := BatchSummary{
+		Total:         len(results),
+		StatusClasses: make(map[string]int),
+	}
+
+	var latencies []int64
+	for _, result := range results {
+		if !result.Success {
+			summary.Errored++
+			continue
+		}
+		summary.Succeeded++
+		if result.Blocked {
+			summary.Blocked++
+		}
+		summary.StatusClasses[fmt.Sprintf("%dxx", result.StatusCode/100)]++
+		latencies = append(latencies, result.ResponseTime)
+	}
+
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+	summary.LatencyP50 = percentile(latencies, 50)
+	summary.LatencyP95 = percentile(latencies, 95)
+	return summary
+}
+
+// percentile returns the nearest-rank percentile p of sorted values, or 0 if empty
+func percentile(sorted []int64, p int) int64 {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := (p*len(sorted) + 99) / 100
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
@@ -0,0 +1,299 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestParseURLList(t *testing.T) {
+	// Test newline-separated text
+	t.Run("text", func(t *testing.T) {
+		text := "https://a.example.com\n\n# comment\n  https://b.example.com  \n"
+		requests, err := parseURLList(strings.NewReader(text), false)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(requests) != 2 || requests[1].URL != "https://b.example.com" {
+			t.Errorf("unexpected requests: %+v", requests)
+		}
+	})
+
+	// Test CSV with header row
+	t.Run("csv with header", func(t *testing.T) {
+		text := "name,url,method\nhome,https://a.example.com,GET\napi,https://b.example.com,HEAD\n"
+		requests, err := parseURLList(strings.NewReader(text), true)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(requests) != 2 {
+			t.Fatalf("expected 2 requests, got %d", len(requests))
+		}
+		if requests[1].URL != "https://b.example.com" || requests[1].Method != "HEAD" {
+			t.Errorf("unexpected request: %+v", requests[1])
+		}
+	})
+
+	// Test CSV without header row
+	t.Run("csv without header", func(t *testing.T) {
+		text := "https://a.example.com,ignored\nhttps://b.example.com\n"
+		requests, err := parseURLList(strings.NewReader(text), true)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(requests) != 2 || requests[0].URL != "https://a.example.com" {
+			t.Errorf("unexpected requests: %+v", requests)
+		}
+	})
+}
+
+func TestSummarizeBatch(t *testing.T) {
+	results := []BatchResult{
+		{TestResponse: TestResponse{Success: true, StatusCode: 200, ResponseTime: 10}},
+		{TestResponse: TestResponse{Success: true, StatusCode: 204, ResponseTime: 20}},
+		{TestResponse: TestResponse{Success: true, StatusCode: 301, ResponseTime: 30}},
+		{TestResponse: TestResponse{Success: true, StatusCode: 403, ResponseTime: 40, Blocked: true}},
+		{TestResponse: TestResponse{Success: true, StatusCode: 500, ResponseTime: 1000}},
+		{TestResponse: TestResponse{Success: false, Error: "DNS error"}},
+	}
+
+	summary := summarizeBatch(results)
+
+	if summary.Total != 6 || summary.Succeeded != 5 || summary.Errored != 1 || summary.Blocked != 1 {
+		t.Errorf("unexpected counts: %+v", summary)
+	}
+	expected := map[string]int{"2xx": 2, "3xx": 1, "4xx": 1, "5xx": 1}
+	for class, count := range expected {
+		if summary.StatusClasses[class] != count {
+			t.Errorf("expected %d %s, got %d", count, class, summary.StatusClasses[class])
+		}
+	}
+	if summary.LatencyP50 != 30 {
+		t.Errorf("expected p50 30, got %d", summary.LatencyP50)
+	}
+	if summary.LatencyP95 != 1000 {
+		t.Errorf("expected p95 1000, got %d", summary.LatencyP95)
+	}
+}
+
+func TestRunBatch(t *testing.T) {
+	var inFlight, maxInFlight int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		current := atomic.AddInt32(&inFlight, 1)
+		defer atomic.AddInt32(&inFlight, -1)
+		for {
+			max := atomic.LoadInt32(&maxInFlight)
+			if current <= max || atomic.CompareAndSwapInt32(&maxInFlight, max, current) {
+				break
+			}
+		}
+		time.Sleep(20 * time.Millisecond)
+		if r.URL.Path == "/blocked" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	batch := BatchRequest{
+		Requests: []TestRequest{
+			{URL: server.URL + "/1"},
+			{URL: server.URL + "/2"},
+			{URL: server.URL + "/blocked"},
+			{URL: server.URL + "/4"},
+			{URL: "not-a-url"},
+			{URL: server.URL + "/6"},
+		},
+		Concurrency:        4,
+		PerHostConcurrency: 2,
+	}
+
+	results := runBatch(context.Background(), batch, nil)
+
+	if len(results) != len(batch.Requests) {
+		t.Fatalf("expected %d results, got %d", len(batch.Requests), len(results))
+	}
+	for i, result := range results {
+		if result.Index != i || result.URL != batch.Requests[i].URL {
+			t.Errorf("result %d out of order: %+v", i, result)
+		}
+	}
+	if !results[2].Blocked {
+		t.Errorf("expected result 2 to be blocked")
+	}
+	if results[4].Success || results[4].ErrorCode != "invalid_request" {
+		t.Errorf("expected invalid request result, got %+v", results[4].TestResponse)
+	}
+	if maxInFlight > 2 {
+		t.Errorf("expected at most 2 concurrent requests per host, got %d", maxInFlight)
+	}
+}
+
+func TestRunBatchCanceled(t *testing.T) {
+	useTestResultStore(t, newMemoryResultStore(100, 0))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var hits atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		// The client goes away while the first request is running
+		cancel()
+		select {
+		case <-r.Context().Done():
+		case <-time.After(5 * time.Second):
+		}
+	}))
+	defer server.Close()
+
+	batch := BatchRequest{Concurrency: 1}
+	for i := 0; i < 5; i++ {
+		batch.Requests = append(batch.Requests, TestRequest{URL: fmt.Sprintf("%s/%d", server.URL, i)})
+	}
+	results := runBatch(ctx, batch, nil)
+
+	if n := hits.Load(); n != 1 {
+		t.Errorf("expected only the first request to reach the server, got %d", n)
+	}
+	for i, result := range results {
+		if result.Index != i || result.URL != batch.Requests[i].URL || result.ErrorCode != "canceled" {
+			t.Errorf("expected result %d to be canceled, got %+v", i, result)
+		}
+	}
+}
+
+func TestBatchHandler(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	// Test JSON batch
+	t.Run("json body", func(t *testing.T) {
+		body := `{"requests":[{"url":"` + server.URL + `"},{"url":"` + server.URL + `/x","method":"HEAD"}]}`
+		req := httptest.NewRequest(http.MethodPost, "/api/batch", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		batchHandler(w, req)
+
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected status code 200, got %d: %s", w.Code, w.Body.String())
+		}
+		var response BatchResponse
+		if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+			t.Fatalf("failed to decode response: %v", err)
+		}
+		if len(response.Results) != 2 || response.Summary.Succeeded != 2 {
+			t.Errorf("unexpected response: %+v", response.Summary)
+		}
+		if response.Summary.StatusClasses["2xx"] != 2 {
+			t.Errorf("expected 2 2xx results, got %v", response.Summary.StatusClasses)
+		}
+	})
+
+	// Test plain text body with query options
+	t.Run("text body", func(t *testing.T) {
+		body := server.URL + "/a\n" + server.URL + "/b\n"
+		req := httptest.NewRequest(http.MethodPost, "/api/batch?concurrency=2", strings.NewReader(body))
+		req.Header.Set("Content-Type", "text/plain")
+		w := httptest.NewRecorder()
+		batchHandler(w, req)
+
+		var response BatchResponse
+		if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+			t.Fatalf("failed to decode response: %v", err)
+		}
+		if len(response.Results) != 2 {
+			t.Errorf("expected 2 results, got %d", len(response.Results))
+		}
+	})
+
+	// Test multipart CSV upload
+	t.Run("multipart csv upload", func(t *testing.T) {
+		var buf bytes.Buffer
+		mw := multipart.NewWriter(&buf)
+		part, _ := mw.CreateFormFile("file", "urls.csv")
+		part.Write([]byte("url\n" + server.URL + "\n"))
+		mw.Close()
+
+		req := httptest.NewRequest(http.MethodPost, "/api/batch", &buf)
+		req.Header.Set("Content-Type", mw.FormDataContentType())
+		w := httptest.NewRecorder()
+		batchHandler(w, req)
+
+		var response BatchResponse
+		if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+			t.Fatalf("failed to decode response: %v", err)
+		}
+		if len(response.Results) != 1 || !response.Results[0].Success {
+			t.Errorf("unexpected results: %+v", response.Results)
+		}
+	})
+
+	// Test validation errors
+	t.Run("empty batch", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/api/batch", strings.NewReader(`{"requests":[]}`))
+		w := httptest.NewRecorder()
+		batchHandler(w, req)
+
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("expected status code 400, got %d", w.Code)
+		}
+	})
+
+	t.Run("concurrency too high", func(t *testing.T) {
+		body := `{"requests":[{"url":"https://example.com"}],"concurrency":500}`
+		req := httptest.NewRequest(http.MethodPost, "/api/batch", strings.NewReader(body))
+		w := httptest.NewRecorder()
+		batchHandler(w, req)
+
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("expected status code 400, got %d", w.Code)
+		}
+	})
+
+	t.Run("upload too large", func(t *testing.T) {
+		lines := strings.Repeat("https://example.com/"+strings.Repeat("a", 100)+"\n", maxBatchUploadBytes/100)
+		var multipartBody bytes.Buffer
+		mw := multipart.NewWriter(&multipartBody)
+		part, _ := mw.CreateFormFile("file", "urls.txt")
+		part.Write([]byte(lines))
+		mw.Close()
+
+		bodies := map[string]string{
+			"application/json":       `{"requests":[{"url":"https://example.com/` + strings.Repeat("a", maxBatchUploadBytes) + `"}]}`,
+			"text/plain":             lines,
+			"text/csv":               lines,
+			mw.FormDataContentType(): multipartBody.String(),
+		}
+		for contentType, body := range bodies {
+			req := httptest.NewRequest(http.MethodPost, "/api/batch", strings.NewReader(body))
+			req.Header.Set("Content-Type", contentType)
+			w := httptest.NewRecorder()
+			batchHandler(w, req)
+
+			if w.Code != http.StatusRequestEntityTooLarge {
+				t.Errorf("%s: expected status code 413, got %d: %s", contentType, w.Code, w.Body.String())
+			}
+		}
+	})
+
+	t.Run("method not allowed", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/api/batch", nil)
+		w := httptest.NewRecorder()
+		batchHandler(w, req)
+
+		if w.Code != http.StatusMethodNotAllowed {
+			t.Errorf("expected status code 405, got %d", w.Code)
+		}
+	})
+}
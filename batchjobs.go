@@ -0,0 +1,229 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// batchJobRetention is how long finished batch jobs stay available for streaming
+const batchJobRetention = 10 * time.Minute
+
+// Batch job limits
+const (
+	maxRunningBatchJobs  = 5   // async batches running at once
+	maxRetainedBatchJobs = 100 // running and finished jobs kept; the oldest finished jobs are dropped first
+)
+
+// errTooManyBatchJobs is returned by start when maxRunningBatchJobs are running
+var errTooManyBatchJobs = errors.New("too many batch jobs running, try again later")
+
+// sseHeartbeatInterval keeps idle event streams open through proxies
+const sseHeartbeatInterval = 15 * time.Second
+
+// BatchProgress is sent after every completed test of a streamed batch
+type BatchProgress struct {
+	Completed int `json:"completed"`
+	Total     int `json:"total"`
+}
+
+// batchJob is a batch running in the background
+type batchJob struct {
+	id      string
+	total   int
+	started time.Time
+
+	mu       sync.Mutex
+	results  []BatchResult // in completion order
+	summary  *BatchSummary // set when the batch is done
+	finished time.Time
+	changed  chan struct{} // closed on every update
+}
+
+// add records a completed test and wakes up listeners
+func (j *batchJob) add(result BatchResult) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.results = append(j.results, result)
+	j.notifyLocked()
+}
+
+// finish records the summary and wakes up listeners
+func (j *batchJob) finish(summary BatchSummary) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.summary = &summary
+	j.finished = time.Now()
+	j.notifyLocked()
+}
+
+// notifyLocked wakes up everyone waiting on the current change channel
+func (j *batchJob) notifyLocked() {
+	close(j.changed)
+	j.changed = make(chan struct{})
+}
+
+// snapshot returns results completed after index from, the summary if done,
+// and a channel that is closed on the next update
+func (j *batchJob) snapshot(from int) ([]BatchResult, *BatchSummary, <-chan struct{}) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.results[from:], j.summary, j.changed
+}
+
+// batchJobStore keeps running and recently finished batch jobs in memory
+type batchJobStore struct {
+	mu   sync.Mutex
+	jobs map[string]*batchJob
+}
+
+// batchJobs holds the batch jobs of this server
+var batchJobs = &batchJobStore{jobs: make(map[string]*batchJob)}
+
+// start runs batch in the background and returns its job
+// Checks log with the logger of ctx, but are not cancelled with it
+func (s *batchJobStore) start(ctx context.Context, batch BatchRequest) (*batchJob, error) {
+	job := &batchJob{
+		id:      newID(),
+		total:   len(batch.Requests),
+		started: time.Now(),
+		changed: make(chan struct{}),
+	}
+
+	s.mu.Lock()
+	s.removeExpiredLocked()
+	running, oldest := 0, ""
+	var oldestFinished time.Time
+	for id, j := range s.jobs {
+		j.mu.Lock()
+		if j.summary == nil {
+			running++
+		} else if oldest == "" || j.finished.Before(oldestFinished) {
+			oldest, oldestFinished = id, j.finished
+		}
+		j.mu.Unlock()
+	}
+	if running >= maxRunningBatchJobs {
+		s.mu.Unlock()
+		return nil, errTooManyBatchJobs
+	}
+	if len(s.jobs) >= maxRetainedBatchJobs && oldest != "" {
+		delete(s.jobs, oldest)
+	}
+	s.jobs[job.id] = job
+	s.mu.Unlock()
+
+	go func() {
+		results := runBatch(context.WithoutCancel(ctx), batch, job.add)
+		summary := summarizeBatch(results)
+		summary.Duration = time.Since(job.started).Milliseconds()
+		job.finish(summary)
+	}()
+	return job, nil
+}
+
+// get returns the job with the given id, or nil
+func (s *batchJobStore) get(id string) *batchJob {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.removeExpiredLocked()
+	return s.jobs[id]
+}
+
+// removeExpiredLocked drops jobs that finished more than batchJobRetention ago
+func (s *batchJobStore) removeExpiredLocked() {
+	for id, job := range s.jobs {
+		job.mu.Lock()
+		expired := job.summary != nil && time.Since(job.finished) > batchJobRetention
+		job.mu.Unlock()
+		if expired {
+			delete(s.jobs, id)
+		}
+	}
+}
+
+// batchEventsHandler handles GET /api/batch/{id}/events
+// Streams every completed test as a "result" event followed by a "progress" event,
+// then a final "summary" event. Results completed before connecting are replayed.
+func batchEventsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	id, ok := strings.CutSuffix(strings.TrimPrefix(r.URL.Path, "/api/batch/"), "/events")
+	if !ok || id == "" || strings.Contains(id, "/") {
+		http.NotFound(w, r)
+		return
+	}
+	job := batchJobs.get(id)
+	if job == nil {
+		http.Error(w, "Batch not found", http.StatusNotFound)
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming not supported", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	heartbeat := time.NewTicker(sseHeartbeatInterval)
+	defer heartbeat.Stop()
+
+	sent := 0
+	for {
+		results, summary, changed := job.snapshot(sent)
+		for _, result := range results {
+			sent++
+			writeSSE(w, "result", result)
+			writeSSE(w, "progress", BatchProgress{Completed: sent, Total: job.total})
+		}
+		if summary != nil {
+			writeSSE(w, "summary", summary)
+			flusher.Flush()
+			return
+		}
+		flusher.Flush()
+
+		select {
+		case <-changed:
+		case <-heartbeat.C:
+			fmt.Fprint(w, ": heartbeat\n\n")
+			flusher.Flush()
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+// writeSSE writes one Server-Sent Event with a JSON payload
+func writeSSE(w http.ResponseWriter, event string, data interface{}) {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return
+	}
+	fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, payload)
+}
+
+// newID returns a random 128-bit hex identifier
+func newID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// sseEvent is one parsed Server-Sent Event
+type sseEvent struct {
+	name string
+	data string
+}
+
+// parseSSE splits an event stream into events, skipping comments
+func parseSSE(t *testing.T, body string) []sseEvent {
+	t.Helper()
+	var events []sseEvent
+	var current sseEvent
+	scanner := bufio.NewScanner(strings.NewReader(body))
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case strings.HasPrefix(line, "event: "):
+			current.name = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			current.data = strings.TrimPrefix(line, "data: ")
+		case line == "" && current.name != "":
+			events = append(events, current)
+			current = sseEvent{}
+		}
+	}
+	return events
+}
+
+func TestBatchEvents(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/missing" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	// Start an async batch
+	body := server.URL + "/a\n" + server.URL + "/b\n" + server.URL + "/missing\n"
+	req := httptest.NewRequest(http.MethodPost, "/api/batch?async=true", strings.NewReader(body))
+	req.Header.Set("Content-Type", "text/plain")
+	w := httptest.NewRecorder()
+	batchHandler(w, req)
+
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("expected status code 202, got %d: %s", w.Code, w.Body.String())
+	}
+	var started struct {
+		ID        string `json:"id"`
+		Total     int    `json:"total"`
+		EventsURL string `json:"eventsUrl"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&started); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if started.ID == "" || started.Total != 3 || started.EventsURL != "/api/batch/"+started.ID+"/events" {
+		t.Fatalf("unexpected start response: %+v", started)
+	}
+
+	// Stream events until the summary
+	req = httptest.NewRequest(http.MethodGet, started.EventsURL, nil)
+	w = httptest.NewRecorder()
+	batchEventsHandler(w, req)
+
+	if ct := w.Header().Get("Content-Type"); ct != "text/event-stream" {
+		t.Errorf("expected text/event-stream, got %q", ct)
+	}
+
+	events := parseSSE(t, w.Body.String())
+	var results, progress int
+	var lastProgress BatchProgress
+	var summary *BatchSummary
+	for _, event := range events {
+		switch event.name {
+		case "result":
+			results++
+			var result BatchResult
+			if err := json.Unmarshal([]byte(event.data), &result); err != nil {
+				t.Errorf("invalid result event: %v", err)
+			}
+		case "progress":
+			progress++
+			json.Unmarshal([]byte(event.data), &lastProgress)
+		case "summary":
+			summary = &BatchSummary{}
+			json.Unmarshal([]byte(event.data), summary)
+		}
+	}
+
+	if results != 3 || progress != 3 {
+		t.Errorf("expected 3 result and progress events, got %d and %d", results, progress)
+	}
+	if lastProgress.Completed != 3 || lastProgress.Total != 3 {
+		t.Errorf("unexpected final progress: %+v", lastProgress)
+	}
+	if summary == nil {
+		t.Fatalf("expected summary event")
+	}
+	if summary.StatusClasses["2xx"] != 2 || summary.StatusClasses["4xx"] != 1 {
+		t.Errorf("unexpected summary: %+v", summary)
+	}
+	if events[len(events)-1].name != "summary" {
+		t.Errorf("expected summary to be the last event")
+	}
+
+	// Reconnecting replays the finished batch
+	req = httptest.NewRequest(http.MethodGet, started.EventsURL, nil)
+	w = httptest.NewRecorder()
+	batchEventsHandler(w, req)
+	if replayed := parseSSE(t, w.Body.String()); len(replayed) != len(events) {
+		t.Errorf("expected %d replayed events, got %d", len(events), len(replayed))
+	}
+}
+
+func TestBatchEventsNotFound(t *testing.T) {
+	for _, path := range []string{"/api/batch/unknown/events", "/api/batch/unknown", "/api/batch//events"} {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		w := httptest.NewRecorder()
+		batchEventsHandler(w, req)
+
+		if w.Code != http.StatusNotFound {
+			t.Errorf("%s: expected status code 404, got %d", path, w.Code)
+		}
+	}
+}
+
+func TestBatchJobLimits(t *testing.T) {
+	store := &batchJobStore{jobs: make(map[string]*batchJob)}
+	add := func(id string, finished time.Time) *batchJob {
+		job := &batchJob{id: id, changed: make(chan struct{})}
+		if !finished.IsZero() {
+			job.summary, job.finished = &BatchSummary{}, finished
+		}
+		store.jobs[id] = job
+		return job
+	}
+
+	// Running jobs are capped
+	for i := 0; i < maxRunningBatchJobs; i++ {
+		add(fmt.Sprint("running", i), time.Time{})
+	}
+	if _, err := store.start(context.Background(), BatchRequest{}); !errors.Is(err, errTooManyBatchJobs) {
+		t.Fatalf("expected errTooManyBatchJobs, got %v", err)
+	}
+
+	// Retained jobs are capped by dropping the oldest finished job
+	delete(store.jobs, "running0")
+	now := time.Now()
+	for len(store.jobs) < maxRetainedBatchJobs {
+		add(fmt.Sprint("done", len(store.jobs)), now.Add(-time.Duration(len(store.jobs))*time.Second))
+	}
+	oldest := fmt.Sprint("done", maxRetainedBatchJobs-1)
+	if _, err := store.start(context.Background(), BatchRequest{}); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if len(store.jobs) != maxRetainedBatchJobs || store.get(oldest) != nil {
+		t.Errorf("expected the oldest finished job to be dropped, got %d jobs", len(store.jobs))
+	}
+
+	// Expired jobs are dropped on lookup
+	add("expired", now.Add(-batchJobRetention-time.Minute))
+	if store.get("expired") != nil {
+		t.Errorf("expected the expired job to be dropped")
+	}
+}
+
+func TestBatchHandlerTooManyJobs(t *testing.T) {
+	saved := batchJobs
+	batchJobs = &batchJobStore{jobs: make(map[string]*batchJob)}
+	t.Cleanup(func() { batchJobs = saved })
+	for i := 0; i < maxRunningBatchJobs; i++ {
+		batchJobs.jobs[fmt.Sprint(i)] = &batchJob{changed: make(chan struct{})}
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/api/batch?async=true", strings.NewReader("https://example.com\n"))
+	req.Header.Set("Content-Type", "text/plain")
+	w := httptest.NewRecorder()
+	batchHandler(w, req)
+	if w.Code != http.StatusTooManyRequests {
+		t.Errorf("expected 429, got %d: %s", w.Code, w.Body.String())
+	}
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// Block reasons reported in TestResponse.BlockReason
+const (
+	blockReasonChallenge    = "challenge"     // JavaScript or bot challenge, e.g. "Just a moment..."
+	blockReasonCaptcha      = "captcha"       // captcha page
+	blockReasonAccessDenied = "access_denied" // request refused
+	blockReasonRateLimited  = "rate_limited"  // too many requests
+)
+
+// Confidence of a block detection reported in TestResponse.BlockConfidence
+const (
+	confidenceHigh   = "high"   // a block page of a known vendor
+	confidenceMedium = "medium" // a block page, or a known vendor refusing the request
+	confidenceLow    = "low"    // only the status code suggests a block
+)
+
+// maxBlockScanBytes is how much of the body is searched for block page markers
+const maxBlockScanBytes = 256 << 10
+
+// blockDetection is the result of inspecting a response for a block
+type blockDetection struct {
+	Reason     string
+	Vendor     string
+	Confidence string
+	Signature  string // name of the matching signature, empty for a bare status
+	Evidence   []string
+}
+
+// detectBlock inspects the status, headers and body of a response for block and challenge pages
+// It returns nil when the response does not look blocked
+func detectBlock(statusCode int, header http.Header, body []byte) *blockDetection {
+	if len(body) > maxBlockScanBytes {
+		body = body[:maxBlockScanBytes]
+	}
+	text := string(body)
+	success := statusCode >= 200 && statusCode < 300
+
+	var best *blockDetection
+	for _, sig := range signatures.current() {
+		vendorEvidence := sig.matchVendor(header)
+		bodyEvidence := sig.matchBody(text)
+		statusMatch := sig.matchStatus(statusCode)
+
+		var detection *blockDetection
+		switch {
+		case len(bodyEvidence) > 0 && (len(vendorEvidence) > 0 || statusMatch):
+			detection = &blockDetection{Reason: sig.Reason, Confidence: confidenceHigh}
+		case len(bodyEvidence) > 0 && !success:
+			detection = &blockDetection{Reason: sig.Reason, Confidence: confidenceMedium}
+		case len(vendorEvidence) > 0 && statusMatch:
+			detection = &blockDetection{Reason: statusBlockReason(statusCode), Confidence: confidenceMedium}
+		default:
+			continue
+		}
+		if confidenceRank(detection.Confidence) > confidenceRank(sig.Severity) {
+			detection.Confidence = sig.Severity
+		}
+		detection.Vendor = sig.Vendor
+		detection.Signature = sig.Name
+		detection.Evidence = append(append([]string{fmt.Sprintf("status %d", statusCode)}, vendorEvidence...), bodyEvidence...)
+		if best == nil || confidenceRank(detection.Confidence) > confidenceRank(best.Confidence) {
+			best = detection
+		}
+	}
+	if best != nil {
+		return best
+	}
+
+	if isBlocked(statusCode) {
+		return &blockDetection{
+			Reason:     statusBlockReason(statusCode),
+			Confidence: confidenceLow,
+			Evidence:   []string{fmt.Sprintf("status %d", statusCode)},
+		}
+	}
+	return nil
+}
+
+// matchVendor returns the headers and cookies that show the vendor served a response
+func (sig blockSignature) matchVendor(header http.Header) []string {
+	var evidence []string
+	for _, marker := range sig.headers {
+		values := header.Values(marker.name)
+		for _, value := range values {
+			if marker.value == nil || marker.value.MatchString(value) {
+				evidence = append(evidence, "header "+marker.name)
+				break
+			}
+		}
+	}
+	for _, cookie := range (&http.Response{Header: header}).Cookies() {
+		for _, name := range sig.cookies {
+			if name.MatchString(cookie.Name) {
+				evidence = append(evidence, "cookie "+cookie.Name)
+				break
+			}
+		}
+	}
+	return evidence
+}
+
+// matchBody returns the block page markers found in a body
+func (sig blockSignature) matchBody(body string) []string {
+	var evidence []string
+	for _, marker := range sig.body {
+		if marker.MatchString(body) {
+			evidence = append(evidence, "body /"+marker.String()+"/")
+		}
+	}
+	return evidence
+}
+
+// matchStatus reports whether the vendor answers blocks with a status
+func (sig blockSignature) matchStatus(statusCode int) bool {
+	for _, r := range sig.statuses {
+		if statusCode >= r.min && statusCode <= r.max {
+			return true
+		}
+	}
+	return false
+}
+
+// statusBlockReason is the reason reported when only the status code shows a block
+func statusBlockReason(statusCode int) string {
+	if statusCode == http.StatusTooManyRequests {
+		return blockReasonRateLimited
+	}
+	return blockReasonAccessDenied
+}
+
+// confidenceRank orders confidence levels
+func confidenceRank(confidence string) int {
+	switch confidence {
+	case confidenceHigh:
+		return 3
+	case confidenceMedium:
+		return 2
+	case confidenceLow:
+		return 1
+	}
+	return 0
+}
+
+// applyBlockDetection sets the block fields of a response
+func applyBlockDetection(response *TestResponse, detection *blockDetection) {
+	if detection == nil {
+		return
+	}
+	response.Blocked = true
+	response.BlockReason = detection.Reason
+	response.BlockVendor = detection.Vendor
+	response.BlockConfidence = detection.Confidence
+	response.BlockSignature = detection.Signature
+	response.BlockEvidence = detection.Evidence
+}
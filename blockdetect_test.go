@@ -0,0 +1,175 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestDetectBlock(t *testing.T) {
+	tests := []struct {
+		name           string
+		status         int
+		header         http.Header
+		body           string
+		wantReason     string
+		wantVendor     string
+		wantConfidence string
+	}{
+		{
+			name:           "cloudflare challenge",
+			status:         503,
+			header:         http.Header{"Cf-Ray": {"8a1b2c3d4e5f-AMS"}, "Server": {"cloudflare"}},
+			body:           "<html><head><title>Just a moment...</title></head><script>window._cf_chl_opt={}</script></html>",
+			wantReason:     blockReasonChallenge,
+			wantVendor:     "cloudflare",
+			wantConfidence: confidenceHigh,
+		},
+		{
+			name:           "cloudflare firewall rule",
+			status:         403,
+			header:         http.Header{"Server": {"cloudflare"}},
+			body:           `<title>Attention Required! | Cloudflare</title><div id="cf-error-details">`,
+			wantReason:     blockReasonAccessDenied,
+			wantVendor:     "cloudflare",
+			wantConfidence: confidenceHigh,
+		},
+		{
+			name:           "cloudflare rate limit without a page",
+			status:         429,
+			header:         http.Header{"Cf-Ray": {"8a1b2c3d4e5f-AMS"}},
+			wantReason:     blockReasonRateLimited,
+			wantVendor:     "cloudflare",
+			wantConfidence: confidenceMedium,
+		},
+		{
+			name:           "akamai reference page",
+			status:         403,
+			header:         http.Header{"Server": {"AkamaiGHost"}},
+			body:           `<H1>Access Denied</H1>You don't have permission to access "http://www.example.com/" on this server.<P>Reference #18.2d351ab8.1700000000.1a2b3c4d<P>https://errors.edgesuite.net/18.2d351ab8`,
+			wantReason:     blockReasonAccessDenied,
+			wantVendor:     "akamai",
+			wantConfidence: confidenceHigh,
+		},
+		{
+			name:           "datadome captcha",
+			status:         403,
+			header:         http.Header{"X-Datadome": {"protected"}, "Set-Cookie": {"datadome=abc; Path=/"}},
+			body:           `<script src="https://ct.captcha-delivery.com/c.js"></script>`,
+			wantReason:     blockReasonCaptcha,
+			wantVendor:     "datadome",
+			wantConfidence: confidenceHigh,
+		},
+		{
+			name:           "perimeterx captcha served with 200",
+			status:         200,
+			header:         http.Header{"Set-Cookie": {"_pxhd=xyz; Path=/"}},
+			body:           `<div id="px-captcha"></div><script src="https://captcha.px-cdn.net/PX123/captcha.js"></script>`,
+			wantReason:     blockReasonCaptcha,
+			wantVendor:     "perimeterx",
+			wantConfidence: confidenceHigh,
+		},
+		{
+			name:           "hcaptcha page on an error status",
+			status:         401,
+			body:           `<script src="https://hcaptcha.com/1/api.js" async></script>`,
+			wantReason:     blockReasonCaptcha,
+			wantVendor:     "hcaptcha",
+			wantConfidence: confidenceMedium,
+		},
+		{
+			name:   "recaptcha on a normal page is not a block",
+			status: 200,
+			body:   `<form><div class="g-recaptcha"></div></form><script src="https://www.google.com/recaptcha/api.js"></script>`,
+		},
+		{
+			name:   "page served through perimeterx is not a block",
+			status: 200,
+			header: http.Header{"Set-Cookie": {"_pxhd=xyz; Path=/", "_pxvid=abc; Path=/"}},
+			body:   `<html><script>window._pxAppId="PX123";</script><script src="https://client.perimeterx.net/PX123/main.min.js"></script>Welcome</html>`,
+		},
+		{
+			name:   "page served through datadome is not a block",
+			status: 200,
+			header: http.Header{"Set-Cookie": {"datadome=abc; Path=/"}},
+			body:   `<html><script>window.ddjskey="ABC123";</script><script src="https://js.datadome.co/tags.js" async></script>Welcome</html>`,
+		},
+		{
+			name:   "page served through akamai is not a block",
+			status: 200,
+			header: http.Header{"Server": {"AkamaiGHost"}, "Set-Cookie": {"_abck=abc; Path=/", "bm_sz=xyz; Path=/"}},
+			body:   `<html><script type="text/javascript" src="/akam/13/7f2a1b3c" defer></script>Welcome</html>`,
+		},
+		{
+			name:   "page served through cloudflare is not a block",
+			status: 200,
+			header: http.Header{"Cf-Ray": {"8a1b2c3d4e5f-AMS"}, "Set-Cookie": {"__cf_bm=abc; Path=/"}},
+			body:   "<html>Welcome</html>",
+		},
+		{
+			name:   "origin error through cloudflare is not a block",
+			status: 503,
+			header: http.Header{"Cf-Ray": {"8a1b2c3d4e5f-AMS"}},
+			body:   "Service Unavailable",
+		},
+		{
+			name:           "plain 403",
+			status:         403,
+			wantReason:     blockReasonAccessDenied,
+			wantConfidence: confidenceLow,
+		},
+		{
+			name:           "plain 429",
+			status:         429,
+			wantReason:     blockReasonRateLimited,
+			wantConfidence: confidenceLow,
+		},
+		{
+			name:   "plain 200",
+			status: 200,
+			body:   "ok",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header := tt.header
+			if header == nil {
+				header = http.Header{}
+			}
+			detection := detectBlock(tt.status, header, []byte(tt.body))
+			if tt.wantReason == "" {
+				if detection != nil {
+					t.Errorf("expected no block, got %+v", detection)
+				}
+				return
+			}
+			if detection == nil {
+				t.Fatalf("expected a block, got none")
+			}
+			if detection.Reason != tt.wantReason || detection.Vendor != tt.wantVendor || detection.Confidence != tt.wantConfidence {
+				t.Errorf("got %s/%s/%s, want %s/%s/%s", detection.Reason, detection.Vendor, detection.Confidence, tt.wantReason, tt.wantVendor, tt.wantConfidence)
+			}
+			if len(detection.Evidence) == 0 {
+				t.Errorf("expected evidence")
+			}
+		})
+	}
+}
+
+func TestTestURLBlockPage(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Server", "cloudflare")
+		w.Header().Set("Cf-Mitigated", "challenge")
+		w.WriteHeader(http.StatusServiceUnavailable)
+		w.Write([]byte("<!DOCTYPE html><html><head><title>Just a moment...</title></head></html>"))
+	}))
+	defer server.Close()
+
+	response := testURL(TestRequest{URL: server.URL})
+	if !response.Blocked || response.BlockVendor != "cloudflare" || response.BlockReason != blockReasonChallenge || response.BlockConfidence != confidenceHigh {
+		t.Errorf("expected a cloudflare challenge, got blocked=%v %s/%s/%s", response.Blocked, response.BlockReason, response.BlockVendor, response.BlockConfidence)
+	}
+	if code, verdict := checkVerdict(response, false); code != exitBlocked || verdict != "BLOCKED: server returned 503 (cloudflare challenge, high confidence)" {
+		t.Errorf("unexpected verdict %d %q", code, verdict)
+	}
+}
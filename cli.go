@@ -0,0 +1,319 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"text/tabwriter"
+)
+
+// Exit codes of the check command
+const (
+	exitOK              = 0
+	exitFailure         = 1 // the request failed (DNS, connect, TLS, redirect policy, ...)
+	exitUsage           = 2
+	exitBlocked         = 3 // the server answered 403 or 429, or with a block or challenge page
+	exitAssertionFailed = 4 // the response did not match the expectations
+)
+
+// checkUsage is printed for check -h and on usage errors
+const checkUsage = `Usage: url-checker check <url> [flags]
+
+Tests a single URL and exits non-zero on failure, block or assertion mismatch.
+
+Exit codes:
+  0  success
+  1  request failed
+  2  usage error
+  3  blocked (403/429, or a bot challenge or captcha page)
+  4  assertion failed (unexpected status, header, body, JSON value, time or TLS days)
+
+Flags:
+`
+
+// headerFlags collects repeated -H "Name: value" flags
+type headerFlags map[string]string
+
+func (h headerFlags) String() string {
+	return ""
+}
+
+func (h headerFlags) Set(value string) error {
+	name, val, ok := strings.Cut(value, ":")
+	if !ok || strings.TrimSpace(name) == "" {
+		return fmt.Errorf("header must be in the form \"Name: value\"")
+	}
+	h[strings.TrimSpace(name)] = strings.TrimSpace(val)
+	return nil
+}
+
+// stringList collects a repeatable string flag
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ", ")
+}
+
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+// checkOptions are the parsed arguments of the check command
+type checkOptions struct {
+	request      TestRequest
+	jsonOutput   bool
+	allowPrivate bool
+	// expectStatus is set when -expect-status was given; a blocked response then
+	// counts as an assertion result instead of exiting with exitBlocked
+	expectStatus bool
+}
+
+// defaultExpectedStatus is checked when -expect-status is not given
+var defaultExpectedStatus = []string{"2xx", "3xx"}
+
+// runCheck runs the check command with args (excluding "check") and returns the exit code
+func runCheck(args []string, stdout, stderr io.Writer) int {
+	opts, err := parseCheckArgs(args, stderr)
+	if err == flag.ErrHelp {
+		return exitOK
+	}
+	if err != nil {
+		fmt.Fprintf(stderr, "Error: %v\n", err)
+		return exitUsage
+	}
+
+	if validationErr := validateRequest(opts.request); validationErr != "" {
+		fmt.Fprintf(stderr, "Error: %s\n", validationErr)
+		return exitUsage
+	}
+
+	// The SSRF policy protects the server; local checks may target internal hosts on request
+	if opts.allowPrivate {
+		destinationPolicy = mustNetworkPolicy(nil, nil)
+	}
+
+	response := testURL(opts.request)
+	code, verdict := checkVerdict(response, opts.expectStatus)
+
+	if opts.jsonOutput {
+		encoder := json.NewEncoder(stdout)
+		encoder.SetIndent("", "  ")
+		encoder.Encode(response)
+	} else {
+		printCheckResult(stdout, opts.request, response, verdict)
+	}
+	return code
+}
+
+// parseCheckArgs parses check flags; the URL may appear before, after or between flags
+func parseCheckArgs(args []string, stderr io.Writer) (checkOptions, error) {
+	var opts checkOptions
+	headers := headerFlags{}
+	noFollow := false
+	var expectStatus, expectHeaders, expectBody, expectBodyRegex, expectJSON stringList
+	var maxTime int64
+	minTLSDays := -1
+
+	fs := flag.NewFlagSet("check", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() {
+		fmt.Fprint(stderr, checkUsage)
+		fs.PrintDefaults()
+	}
+	fs.StringVar(&opts.request.Method, "X", "GET", "HTTP method")
+	fs.Var(headers, "H", "request header \"Name: value\" (repeatable)")
+	fs.StringVar(&opts.request.Body, "d", "", "request body")
+	fs.BoolVar(&opts.jsonOutput, "json", false, "print the full result as JSON")
+	fs.BoolVar(&noFollow, "no-follow", false, "do not follow redirects")
+	fs.IntVar(&opts.request.MaxRedirects, "max-redirects", 0, fmt.Sprintf("maximum redirects to follow (default %d)", defaultMaxRedirects))
+	fs.BoolVar(&opts.request.SameHostOnly, "same-host", false, "fail on redirects to another host")
+	fs.BoolVar(&opts.request.NoDowngrade, "no-downgrade", false, "fail on redirects from https to http")
+	fs.BoolVar(&opts.request.Insecure, "insecure", false, "continue on certificate errors and report them")
+	fs.BoolVar(&opts.allowPrivate, "allow-private", false, "allow loopback and private destinations")
+	fs.Var(&expectStatus, "expect-status", "accepted status codes, classes or ranges, e.g. 200,3xx,400-404 (default 2xx,3xx)")
+	fs.Var(&expectHeaders, "expect-header", "expected header \"Name\" (present) or \"Name: value\" (equals) (repeatable)")
+	fs.Var(&expectBody, "expect-body", "text the body must contain (repeatable)")
+	fs.Var(&expectBodyRegex, "expect-body-regex", "regular expression the body must match (repeatable)")
+	fs.Var(&expectJSON, "expect-json", "JSON path \"$.path\" (exists) or \"$.path=value\" (equals) (repeatable)")
+	fs.Int64Var(&maxTime, "max-time", 0, "maximum response time in milliseconds")
+	fs.IntVar(&minTLSDays, "min-tls-days", -1, "minimum days until the certificate expires")
+
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return opts, err
+		}
+		if fs.NArg() == 0 {
+			break
+		}
+		positional = append(positional, fs.Arg(0))
+		args = fs.Args()[1:]
+	}
+
+	if len(positional) != 1 {
+		fs.Usage()
+		return opts, fmt.Errorf("expected exactly one URL, got %d", len(positional))
+	}
+	opts.request.URL = positional[0]
+	opts.request.Method = strings.ToUpper(opts.request.Method)
+	if len(headers) > 0 {
+		opts.request.Headers = headers
+	}
+	if noFollow {
+		follow := false
+		opts.request.FollowRedirects = &follow
+	}
+
+	assert := &Assertions{MaxResponseTime: maxTime}
+	for _, value := range expectStatus {
+		assert.Status = append(assert.Status, splitList(value)...)
+	}
+	opts.expectStatus = len(assert.Status) > 0
+	if !opts.expectStatus {
+		assert.Status = defaultExpectedStatus
+	}
+	for _, value := range expectHeaders {
+		name, equals, _ := strings.Cut(value, ":")
+		assert.Headers = append(assert.Headers, HeaderAssertion{Name: strings.TrimSpace(name), Equals: strings.TrimSpace(equals)})
+	}
+	assert.BodyContains = expectBody
+	assert.BodyRegex = expectBodyRegex
+	for _, value := range expectJSON {
+		assert.JSONPath = append(assert.JSONPath, parseJSONExpectation(value))
+	}
+	if minTLSDays >= 0 {
+		assert.MinTLSDays = &minTLSDays
+	}
+	opts.request.Assert = assert
+	return opts, nil
+}
+
+// parseJSONExpectation parses "$.path" or "$.path=value"; a value that is not valid JSON is compared as a string
+func parseJSONExpectation(value string) JSONPathAssertion {
+	path, expected, hasValue := strings.Cut(value, "=")
+	jp := JSONPathAssertion{Path: strings.TrimSpace(path)}
+	if hasValue {
+		expected = strings.TrimSpace(expected)
+		if json.Valid([]byte(expected)) {
+			jp.Equals = json.RawMessage(expected)
+		} else {
+			jp.Equals, _ = json.Marshal(expected)
+		}
+	}
+	return jp
+}
+
+// checkVerdict maps a test response to an exit code and a one-line verdict
+// A blocked response is reported as blocked unless the expected status was given explicitly
+func checkVerdict(response TestResponse, explicitStatus bool) (int, string) {
+	switch {
+	case !response.Success:
+		return exitFailure, "FAIL: " + response.Error
+	case response.Blocked && !explicitStatus:
+		return exitBlocked, fmt.Sprintf("BLOCKED: server returned %d (%s)", response.StatusCode, blockSummary(response))
+	case response.Verdict == verdictFail:
+		failed := 0
+		for _, result := range response.Assertions {
+			if !result.Passed {
+				failed++
+			}
+		}
+		return exitAssertionFailed, fmt.Sprintf("ASSERTION FAILED: %d of %d assertions failed", failed, len(response.Assertions))
+	}
+	return exitOK, "OK"
+}
+
+// blockSummary describes a block, e.g. "cloudflare challenge, high confidence"
+func blockSummary(response TestResponse) string {
+	summary := strings.ReplaceAll(response.BlockReason, "_", " ")
+	if response.BlockVendor != "" {
+		summary = response.BlockVendor + " " + summary
+	}
+	return summary + ", " + response.BlockConfidence + " confidence"
+}
+
+// rateLimitSummary describes a rate limit, e.g. "throttled, 0 of 100 remaining, resets in 25s"
+func rateLimitSummary(rl *RateLimit) string {
+	var parts []string
+	if rl.Throttled {
+		parts = append(parts, "throttled")
+	}
+	switch {
+	case rl.Remaining != nil && rl.Limit != nil:
+		parts = append(parts, fmt.Sprintf("%d of %d remaining", *rl.Remaining, *rl.Limit))
+	case rl.Remaining != nil:
+		parts = append(parts, fmt.Sprintf("%d remaining", *rl.Remaining))
+	case rl.Limit != nil:
+		parts = append(parts, fmt.Sprintf("limit %d", *rl.Limit))
+	}
+	if rl.ResetSeconds != nil {
+		parts = append(parts, fmt.Sprintf("resets in %ds", *rl.ResetSeconds))
+	}
+	if rl.RetryAfterSeconds != nil {
+		parts = append(parts, fmt.Sprintf("retry after %ds", *rl.RetryAfterSeconds))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// printCheckResult prints a human-readable summary of a test
+func printCheckResult(w io.Writer, req TestRequest, response TestResponse, verdict string) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "URL\t%s %s\n", req.Method, req.URL)
+
+	if !response.Success {
+		fmt.Fprintf(tw, "Error\t%s\n", response.Error)
+		if response.ErrorCode != "" {
+			fmt.Fprintf(tw, "Error code\t%s (%s)\n", response.ErrorCode, response.ErrorPhase)
+		}
+	} else {
+		fmt.Fprintf(tw, "Status\t%d %s\n", response.StatusCode, http.StatusText(response.StatusCode))
+		fmt.Fprintf(tw, "Final URL\t%s\n", response.FinalURL)
+		fmt.Fprintf(tw, "Time\t%dms\n", response.ResponseTime)
+		if n := len(response.Timings); n > 0 {
+			t := response.Timings[n-1]
+			fmt.Fprintf(tw, "Timing\tdns %.1fms, connect %.1fms, tls %.1fms, ttfb %.1fms, transfer %.1fms\n",
+				t.DNSLookup, t.TCPConnect, t.TLSHandshake, t.TimeToFirstByte, t.ContentTransfer)
+		}
+		if response.RateLimit != nil {
+			fmt.Fprintf(tw, "Rate limit\t%s\n", rateLimitSummary(response.RateLimit))
+		}
+	}
+
+	for i, hop := range response.Redirects {
+		label := ""
+		if i == 0 {
+			label = "Redirects"
+		}
+		fmt.Fprintf(tw, "%s\t%d %s -> %s\n", label, hop.StatusCode, hop.URL, hop.Location)
+	}
+
+	if response.TLS != nil {
+		fmt.Fprintf(tw, "TLS\t%s, %s\n", response.TLS.Version, response.TLS.CipherSuite)
+		if len(response.TLS.Certificates) > 0 {
+			leaf := response.TLS.Certificates[0]
+			fmt.Fprintf(tw, "Certificate\t%s, expires in %d days\n", leaf.Subject, leaf.DaysUntilExpiry)
+		}
+		for _, problem := range response.TLS.Problems {
+			fmt.Fprintf(tw, "TLS problem\t%s: %s\n", problem.Code, problem.Message)
+		}
+	}
+
+	for _, result := range response.Assertions {
+		mark := "pass"
+		if !result.Passed {
+			mark = "FAIL"
+		}
+		name := result.Type
+		if result.Target != "" {
+			name += " " + result.Target
+		}
+		fmt.Fprintf(tw, "Assert\t%s %s: expected %s, got %s\n", mark, name, result.Expected, result.Actual)
+	}
+
+	fmt.Fprintf(tw, "Result\t%s\n", verdict)
+	tw.Flush()
+}
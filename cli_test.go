@@ -0,0 +1,158 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestParseCheckArgs(t *testing.T) {
+	var stderr bytes.Buffer
+	opts, err := parseCheckArgs([]string{
+		"-X", "post", "https://example.com/api", "-H", "Accept: application/json",
+		"-H", "X-Token:abc", "-d", `{"a":1}`, "-no-follow", "-json",
+	}, &stderr)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	req := opts.request
+	if req.URL != "https://example.com/api" || req.Method != "POST" || req.Body != `{"a":1}` {
+		t.Errorf("unexpected request: %+v", req)
+	}
+	if req.Headers["Accept"] != "application/json" || req.Headers["X-Token"] != "abc" {
+		t.Errorf("unexpected headers: %v", req.Headers)
+	}
+	if req.FollowRedirects == nil || *req.FollowRedirects {
+		t.Errorf("expected followRedirects to be false")
+	}
+	if !opts.jsonOutput {
+		t.Errorf("expected JSON output")
+	}
+
+	// Test usage errors
+	for _, args := range [][]string{
+		{},
+		{"https://a.example", "https://b.example"},
+		{"-H", "no-colon", "https://example.com"},
+		{"-unknown", "https://example.com"},
+	} {
+		if _, err := parseCheckArgs(args, &stderr); err == nil {
+			t.Errorf("expected error for args %q", args)
+		}
+	}
+}
+
+func TestParseJSONExpectation(t *testing.T) {
+	tests := []struct {
+		value  string
+		path   string
+		equals string
+	}{
+		{"$.ok", "$.ok", ""},
+		{"$.ok=true", "$.ok", "true"},
+		{"$.count = 3", "$.count", "3"},
+		{"$.name=alice", "$.name", `"alice"`},
+		{`$.name="bob"`, "$.name", `"bob"`},
+	}
+
+	for _, tt := range tests {
+		jp := parseJSONExpectation(tt.value)
+		if jp.Path != tt.path || string(jp.Equals) != tt.equals {
+			t.Errorf("%q: expected %s=%s, got %s=%s", tt.value, tt.path, tt.equals, jp.Path, jp.Equals)
+		}
+	}
+}
+
+func TestRunCheck(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/forbidden":
+			w.WriteHeader(http.StatusForbidden)
+		case "/error":
+			w.WriteHeader(http.StatusInternalServerError)
+		case "/json":
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{"status": "ok", "items": [{"id": 7}]}`))
+		case "/echo":
+			w.Header().Set("X-Method", r.Method)
+			w.Write([]byte(r.Header.Get("X-Test")))
+		default:
+			w.Write([]byte("OK"))
+		}
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name     string
+		args     []string
+		exitCode int
+		verdict  string // expected on the last output line
+	}{
+		{"success", []string{server.URL}, exitOK, "Result OK"},
+		{"server error", []string{server.URL + "/error"}, exitAssertionFailed, "ASSERTION FAILED"},
+		{"expected error status", []string{server.URL + "/error", "-expect-status", "5xx"}, exitOK, "Result OK"},
+		{"unexpected status", []string{server.URL, "-expect-status", "204"}, exitAssertionFailed, "1 of 1 assertions failed"},
+		{"blocked", []string{server.URL + "/forbidden"}, exitBlocked, "BLOCKED"},
+		{"expected blocked", []string{server.URL + "/forbidden", "-expect-status", "403"}, exitOK, "Result OK"},
+		{"body and json assertions", []string{server.URL + "/json", "-expect-body", `"ok"`, "-expect-json", "$.items[0].id=7", "-expect-header", "Content-Type: application/json"}, exitOK, "Result OK"},
+		{"json assertion failed", []string{server.URL + "/json", "-expect-json", "$.status=down", "-max-time", "10000"}, exitAssertionFailed, "1 of 3 assertions failed"},
+		{"connection failure", []string{"http://127.0.0.1:1/"}, exitFailure, "FAIL: connection error"},
+		{"invalid url", []string{"ftp://example.com"}, exitUsage, ""},
+		{"invalid method", []string{"-X", "BREW", server.URL}, exitUsage, ""},
+		{"invalid expectation", []string{server.URL, "-expect-status", "abc"}, exitUsage, ""},
+		{"invalid regex", []string{server.URL, "-expect-body-regex", "("}, exitUsage, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var stdout, stderr bytes.Buffer
+			code := runCheck(tt.args, &stdout, &stderr)
+			if code != tt.exitCode {
+				t.Errorf("expected exit code %d, got %d (stdout %q, stderr %q)", tt.exitCode, code, stdout.String(), stderr.String())
+			}
+			lines := strings.Split(strings.TrimSpace(stdout.String()), "\n")
+			if last := strings.Join(strings.Fields(lines[len(lines)-1]), " "); !strings.Contains(last, tt.verdict) {
+				t.Errorf("expected verdict %q, got %q", tt.verdict, last)
+			}
+		})
+	}
+
+	// Test JSON output
+	t.Run("json output", func(t *testing.T) {
+		var stdout, stderr bytes.Buffer
+		code := runCheck([]string{"-json", "-X", "HEAD", "-H", "X-Test: hi", server.URL + "/echo"}, &stdout, &stderr)
+		if code != exitOK {
+			t.Fatalf("expected exit code 0, got %d (%s)", code, stderr.String())
+		}
+
+		var response TestResponse
+		if err := json.Unmarshal(stdout.Bytes(), &response); err != nil {
+			t.Fatalf("invalid JSON output: %v", err)
+		}
+		if response.StatusCode != http.StatusOK || response.Headers["X-Method"] != "HEAD" {
+			t.Errorf("unexpected response: %+v", response)
+		}
+	})
+}
+
+func TestRateLimitSummary(t *testing.T) {
+	n := func(v int64) *int64 { return &v }
+	tests := []struct {
+		rl   RateLimit
+		want string
+	}{
+		{RateLimit{Throttled: true, Remaining: n(0), Limit: n(100), ResetSeconds: n(25)}, "throttled, 0 of 100 remaining, resets in 25s"},
+		{RateLimit{Throttled: true, RetryAfterSeconds: n(30)}, "throttled, retry after 30s"},
+		{RateLimit{Remaining: n(7)}, "7 remaining"},
+		{RateLimit{Limit: n(10)}, "limit 10"},
+	}
+	for _, tt := range tests {
+		if got := rateLimitSummary(&tt.rl); got != tt.want {
+			t.Errorf("rateLimitSummary() = %q, want %q", got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,253 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"go/format"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Commands reproduce a test outside this tool
+type Commands struct {
+	Curl   string `json:"curl"`
+	Go     string `json:"go"`     // a complete program using net/http
+	Python string `json:"python"` // a script using requests
+}
+
+// buildCommands returns commands equivalent to a test request
+// Callers pass the redacted request, so redacted header values appear as [REDACTED]
+func buildCommands(req TestRequest) *Commands {
+	return &Commands{
+		Curl:   curlCommand(req),
+		Go:     goSnippet(req),
+		Python: pythonSnippet(req),
+	}
+}
+
+// commandHeader is a request header in the order it is written to commands
+type commandHeader struct {
+	name, value string
+}
+
+// commandHeaders returns the headers a test sends: the default User-Agent unless overridden
+// and the request headers, sorted by name
+func commandHeaders(req TestRequest) []commandHeader {
+	headers := []commandHeader{}
+	hasUserAgent := false
+	for name, value := range req.Headers {
+		headers = append(headers, commandHeader{name, value})
+		if strings.EqualFold(name, "User-Agent") {
+			hasUserAgent = true
+		}
+	}
+	if !hasUserAgent {
+		headers = append(headers, commandHeader{"User-Agent", defaultUserAgent})
+	}
+	sort.Slice(headers, func(i, j int) bool {
+		return strings.ToLower(headers[i].name) < strings.ToLower(headers[j].name)
+	})
+	return headers
+}
+
+// redirectsToHTTPS reports whether noDowngrade applies, which is only the case for https URLs
+func redirectsToHTTPS(req TestRequest) bool {
+	parsed, err := url.Parse(req.URL)
+	return req.NoDowngrade && err == nil && parsed.Scheme == "https"
+}
+
+// curlCommand builds an equivalent curl command line
+func curlCommand(req TestRequest) string {
+	method := requestMethod(req)
+	var lines []string
+	if req.SameHostOnly && followsRedirects(req) {
+		lines = append(lines, "# curl cannot reject redirects to another host (sameHostOnly)")
+	}
+
+	// --data-raw makes curl send a POST, and -I cannot be combined with it,
+	// so any other method with a body is given with -X
+	args := []string{"curl"}
+	switch {
+	case method == http.MethodHead && req.Body == "":
+		args = append(args, "-I")
+	case method == http.MethodGet && req.Body == "", method == http.MethodPost && req.Body != "":
+		args = append(args, "-i")
+	default:
+		args = append(args, "-i", "-X", method)
+	}
+	if followsRedirects(req) {
+		args = append(args, "-L", "--max-redirs", strconv.Itoa(maxRedirects(req)))
+		if redirectsToHTTPS(req) {
+			args = append(args, "--proto-redir", "=https")
+		}
+	}
+	if req.Insecure {
+		args = append(args, "-k")
+	}
+	for _, spec := range req.Resolve {
+		args = append(args, "--resolve", shellQuote(spec))
+	}
+	args = append(args, "--max-time", "30")
+	command := strings.Join(args, " ")
+
+	for _, h := range commandHeaders(req) {
+		command += " \\\n  -H " + shellQuote(h.name+": "+h.value)
+	}
+	if req.Body != "" {
+		// curl would add a form Content-Type the test does not send
+		if !hasHeader(req.Headers, "Content-Type") {
+			command += " \\\n  -H " + shellQuote("Content-Type:")
+		}
+		command += " \\\n  --data-raw " + shellQuote(req.Body)
+	}
+	command += " \\\n  " + shellQuote(req.URL)
+
+	return strings.Join(append(lines, command), "\n")
+}
+
+// shellQuote quotes s for a POSIX shell
+func shellQuote(s string) string {
+	if s != "" && strings.Trim(s, "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789-_.,:/=@%+") == "" {
+		return s
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// goSnippet builds an equivalent Go program
+func goSnippet(req TestRequest) string {
+	imports := []string{"fmt", "io", "net/http", "time"}
+	if req.Body != "" {
+		imports = append(imports, "strings")
+	}
+	if req.Insecure {
+		imports = append(imports, "crypto/tls")
+	}
+	if len(req.Resolve) > 0 {
+		imports = append(imports, "context", "net")
+	}
+	sort.Strings(imports)
+
+	var b strings.Builder
+	b.WriteString("package main\n\nimport (\n")
+	for _, name := range imports {
+		fmt.Fprintf(&b, "\t%q\n", name)
+	}
+	b.WriteString(")\n\nfunc main() {\n")
+
+	body := "nil"
+	if req.Body != "" {
+		body = fmt.Sprintf("strings.NewReader(%s)", strconv.Quote(req.Body))
+	}
+	fmt.Fprintf(&b, "\treq, err := http.NewRequest(%q, %q, %s)\n", requestMethod(req), req.URL, body)
+	b.WriteString("\tif err != nil {\n\t\tpanic(err)\n\t}\n")
+	for _, h := range commandHeaders(req) {
+		if strings.EqualFold(h.name, "Host") {
+			fmt.Fprintf(&b, "\treq.Host = %q\n", h.value)
+			continue
+		}
+		fmt.Fprintf(&b, "\treq.Header.Set(%q, %q)\n", h.name, h.value)
+	}
+
+	if len(req.Resolve) > 0 {
+		b.WriteString("\n\t// Connect to pinned addresses, like curl --resolve\n")
+		b.WriteString("\tresolve := map[string]string{\n")
+		for _, spec := range req.Resolve {
+			if o, err := parseResolveOverride(spec); err == nil {
+				fmt.Fprintf(&b, "\t\t%q: %q,\n", net.JoinHostPort(o.host, o.port), net.JoinHostPort(o.ip, o.port))
+			}
+		}
+		b.WriteString("\t}\n\tdialer := &net.Dialer{Timeout: 30 * time.Second}\n")
+	}
+
+	b.WriteString("\n\tclient := &http.Client{\n\t\tTimeout: 30 * time.Second,\n")
+	if req.Insecure || len(req.Resolve) > 0 {
+		b.WriteString("\t\tTransport: &http.Transport{\n")
+		if req.Insecure {
+			b.WriteString("\t\t\tTLSClientConfig: &tls.Config{InsecureSkipVerify: true},\n")
+		}
+		if len(req.Resolve) > 0 {
+			b.WriteString("\t\t\tDialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {\n")
+			b.WriteString("\t\t\t\tif pinned, ok := resolve[addr]; ok {\n\t\t\t\t\taddr = pinned\n\t\t\t\t}\n")
+			b.WriteString("\t\t\t\treturn dialer.DialContext(ctx, network, addr)\n\t\t\t},\n")
+		}
+		b.WriteString("\t\t},\n")
+	}
+	b.WriteString("\t\tCheckRedirect: func(req *http.Request, via []*http.Request) error {\n")
+	if !followsRedirects(req) {
+		b.WriteString("\t\t\treturn http.ErrUseLastResponse\n")
+	} else {
+		fmt.Fprintf(&b, "\t\t\tif len(via) > %d {\n\t\t\t\treturn fmt.Errorf(\"stopped after %d redirects\")\n\t\t\t}\n", maxRedirects(req), maxRedirects(req))
+		if req.SameHostOnly {
+			b.WriteString("\t\t\tif req.URL.Host != via[len(via)-1].URL.Host {\n\t\t\t\treturn fmt.Errorf(\"redirect to another host: %s\", req.URL)\n\t\t\t}\n")
+		}
+		if req.NoDowngrade {
+			b.WriteString("\t\t\tif via[len(via)-1].URL.Scheme == \"https\" && req.URL.Scheme == \"http\" {\n\t\t\t\treturn fmt.Errorf(\"redirect from https to http: %s\", req.URL)\n\t\t\t}\n")
+		}
+		b.WriteString("\t\t\treturn nil\n")
+	}
+	b.WriteString("\t\t},\n\t}\n\n")
+
+	b.WriteString("\tresp, err := client.Do(req)\n\tif err != nil {\n\t\tpanic(err)\n\t}\n\tdefer resp.Body.Close()\n")
+	b.WriteString("\tbody, err := io.ReadAll(resp.Body)\n\tif err != nil {\n\t\tpanic(err)\n\t}\n")
+	b.WriteString("\tfmt.Println(resp.Status)\n\tfmt.Println(string(body))\n}\n")
+
+	source, err := format.Source([]byte(b.String()))
+	if err != nil {
+		return b.String()
+	}
+	return string(source)
+}
+
+// pythonSnippet builds an equivalent Python script using requests
+func pythonSnippet(req TestRequest) string {
+	var b strings.Builder
+	b.WriteString("import requests\n\n")
+	if len(req.Resolve) > 0 {
+		b.WriteString("# requests has no equivalent of curl --resolve; pin these hosts in /etc/hosts:\n")
+		for _, spec := range req.Resolve {
+			b.WriteString("#   " + spec + "\n")
+		}
+	}
+	if req.SameHostOnly && followsRedirects(req) {
+		b.WriteString("# requests cannot reject redirects to another host (sameHostOnly)\n")
+	}
+	if redirectsToHTTPS(req) && followsRedirects(req) {
+		b.WriteString("# requests cannot reject redirects from https to http (noDowngrade)\n")
+	}
+	b.WriteString("session = requests.Session()\n")
+	if followsRedirects(req) {
+		fmt.Fprintf(&b, "session.max_redirects = %d\n", maxRedirects(req))
+	}
+
+	fmt.Fprintf(&b, "response = session.request(\n    %s,\n    %s,\n", pythonString(requestMethod(req)), pythonString(req.URL))
+	b.WriteString("    headers={\n")
+	for _, h := range commandHeaders(req) {
+		fmt.Fprintf(&b, "        %s: %s,\n", pythonString(h.name), pythonString(h.value))
+	}
+	b.WriteString("    },\n")
+	if req.Body != "" {
+		fmt.Fprintf(&b, "    data=%s,\n", pythonString(req.Body))
+	}
+	if !followsRedirects(req) {
+		b.WriteString("    allow_redirects=False,\n")
+	}
+	if req.Insecure {
+		b.WriteString("    verify=False,\n")
+	}
+	b.WriteString("    timeout=30,\n)\nprint(response.status_code, response.reason)\nprint(response.text)\n")
+	return b.String()
+}
+
+// pythonString returns s as a Python string literal; JSON string escapes are valid Python
+func pythonString(s string) string {
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	encoder.Encode(s)
+	return strings.TrimSuffix(buf.String(), "\n")
+}
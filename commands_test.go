@@ -0,0 +1,177 @@
+package main
+
+import (
+	"context"
+	"go/parser"
+	"go/token"
+	"strings"
+	"testing"
+)
+
+func TestCurlCommand(t *testing.T) {
+	noFollow := false
+	tests := []struct {
+		name string
+		req  TestRequest
+		want string
+	}{
+		{
+			name: "defaults",
+			req:  TestRequest{URL: "https://example.com/"},
+			want: "curl -i -L --max-redirs 10 --max-time 30 \\\n" +
+				"  -H 'User-Agent: " + defaultUserAgent + "' \\\n" +
+				"  https://example.com/",
+		},
+		{
+			name: "options",
+			req: TestRequest{
+				URL:          "https://example.com/a?b=it's",
+				Method:       "put",
+				Headers:      map[string]string{"X-Token": "[REDACTED]", "user-agent": "probe/1.0"},
+				Body:         `{"a":1}`,
+				MaxRedirects: 3,
+				SameHostOnly: true,
+				NoDowngrade:  true,
+				Insecure:     true,
+				Resolve:      []string{"example.com:443:127.0.0.1"},
+			},
+			want: "# curl cannot reject redirects to another host (sameHostOnly)\n" +
+				"curl -i -X PUT -L --max-redirs 3 --proto-redir =https -k --resolve example.com:443:127.0.0.1 --max-time 30 \\\n" +
+				"  -H 'user-agent: probe/1.0' \\\n" +
+				"  -H 'X-Token: [REDACTED]' \\\n" +
+				"  -H Content-Type: \\\n" +
+				"  --data-raw '{\"a\":1}' \\\n" +
+				"  'https://example.com/a?b=it'\\''s'",
+		},
+		{
+			name: "head without redirects",
+			req:  TestRequest{URL: "http://example.com", Method: "HEAD", FollowRedirects: &noFollow, NoDowngrade: true},
+			want: "curl -I --max-time 30 \\\n" +
+				"  -H 'User-Agent: " + defaultUserAgent + "' \\\n" +
+				"  http://example.com",
+		},
+		{
+			name: "post with body",
+			req:  TestRequest{URL: "http://example.com", Method: "POST", Body: "a=1", FollowRedirects: &noFollow},
+			want: "curl -i --max-time 30 \\\n" +
+				"  -H 'User-Agent: " + defaultUserAgent + "' \\\n" +
+				"  -H Content-Type: \\\n" +
+				"  --data-raw a=1 \\\n" +
+				"  http://example.com",
+		},
+		{
+			name: "get with body",
+			req:  TestRequest{URL: "http://example.com", Body: "q", Headers: map[string]string{"Content-Type": "text/plain"}, FollowRedirects: &noFollow},
+			want: "curl -i -X GET --max-time 30 \\\n" +
+				"  -H 'Content-Type: text/plain' \\\n" +
+				"  -H 'User-Agent: " + defaultUserAgent + "' \\\n" +
+				"  --data-raw q \\\n" +
+				"  http://example.com",
+		},
+		{
+			name: "head with body",
+			req:  TestRequest{URL: "http://example.com", Method: "HEAD", Body: "q", FollowRedirects: &noFollow},
+			want: "curl -i -X HEAD --max-time 30 \\\n" +
+				"  -H 'User-Agent: " + defaultUserAgent + "' \\\n" +
+				"  -H Content-Type: \\\n" +
+				"  --data-raw q \\\n" +
+				"  http://example.com",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := curlCommand(tt.req); got != tt.want {
+				t.Errorf("curlCommand() =\n%s\nwant:\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGoSnippet(t *testing.T) {
+	noFollow := false
+	requests := []TestRequest{
+		{URL: "https://example.com"},
+		{URL: "https://example.com", FollowRedirects: &noFollow},
+		{
+			URL:          "https://example.com/\"quoted\"",
+			Method:       "POST",
+			Headers:      map[string]string{"Host": "virtual.example", "Content-Type": "application/json"},
+			Body:         "{\"a\":\"line\nbreak\"}",
+			SameHostOnly: true,
+			NoDowngrade:  true,
+			Insecure:     true,
+			Resolve:      []string{"example.com:443:127.0.0.1", "[::1]:80:[::1]"},
+		},
+	}
+
+	for _, req := range requests {
+		snippet := goSnippet(req)
+		if _, err := parser.ParseFile(token.NewFileSet(), "main.go", snippet, 0); err != nil {
+			t.Errorf("snippet for %+v does not parse: %v\n%s", req, err, snippet)
+		}
+	}
+
+	snippet := goSnippet(requests[2])
+	for _, want := range []string{
+		`req.Host = "virtual.example"`,
+		`req.Header.Set("Content-Type", "application/json")`,
+		`InsecureSkipVerify: true`,
+		`"[::1]:80":        "[::1]:80"`,
+		`if len(via) > 10 {`,
+		`redirect to another host`,
+	} {
+		if !strings.Contains(snippet, want) {
+			t.Errorf("snippet is missing %q:\n%s", want, snippet)
+		}
+	}
+	if !strings.Contains(goSnippet(requests[1]), "return http.ErrUseLastResponse") {
+		t.Error("expected redirects to be disabled")
+	}
+}
+
+func TestPythonSnippet(t *testing.T) {
+	noFollow := false
+	snippet := pythonSnippet(TestRequest{
+		URL:             "https://example.com",
+		Method:          "PATCH",
+		Headers:         map[string]string{"Authorization": "[REDACTED]"},
+		Body:            "it's \"json\"\n",
+		FollowRedirects: &noFollow,
+		Insecure:        true,
+		Resolve:         []string{"example.com:443:127.0.0.1"},
+	})
+	for _, want := range []string{
+		"#   example.com:443:127.0.0.1\n",
+		`    "PATCH",`,
+		`        "Authorization": "[REDACTED]",`,
+		`    data="it's \"json\"\n",`,
+		"    allow_redirects=False,\n",
+		"    verify=False,\n",
+	} {
+		if !strings.Contains(snippet, want) {
+			t.Errorf("snippet is missing %q:\n%s", want, snippet)
+		}
+	}
+	if strings.Contains(snippet, "max_redirects") {
+		t.Errorf("max_redirects set without following redirects:\n%s", snippet)
+	}
+}
+
+func TestCommandsInResponse(t *testing.T) {
+	useTestResultStore(t, newMemoryResultStore(10, 0))
+	stored := recordResult(context.Background(), sourceTest, "", TestRequest{
+		URL:     "https://example.com",
+		Headers: map[string]string{"Authorization": "Bearer secret"},
+	}, TestResponse{Success: true, StatusCode: 200})
+
+	commands := stored.Response.Commands
+	if commands == nil || commands.Curl == "" || commands.Go == "" || commands.Python == "" {
+		t.Fatalf("expected commands, got %+v", commands)
+	}
+	for _, command := range []string{commands.Curl, commands.Go, commands.Python} {
+		if strings.Contains(command, "secret") || !strings.Contains(command, redactedValue) {
+			t.Errorf("expected redacted Authorization in:\n%s", command)
+		}
+	}
+}
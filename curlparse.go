@@ -0,0 +1,465 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// maxCurlCommandBytes limits the size of a curl command accepted by the API
+const maxCurlCommandBytes = 1 << 20
+
+// ParseCurlRequest is the body of POST /api/parse-curl
+type ParseCurlRequest struct {
+	Curl string `json:"curl"`
+}
+
+// ParseCurlResponse is a test request converted from a curl command
+type ParseCurlResponse struct {
+	Request  TestRequest `json:"request"`
+	Warnings []string    `json:"warnings,omitempty"` // options that were ignored
+}
+
+// curlFlagsWithValue are the curl options that take an argument, by long name
+var curlFlagsWithValue = map[string]bool{
+	"request": true, "header": true, "data": true, "data-raw": true, "data-binary": true,
+	"data-ascii": true, "data-urlencode": true, "cookie": true, "user": true, "resolve": true,
+	"user-agent": true, "referer": true, "url": true, "max-redirs": true,
+	// Accepted but ignored
+	"output": true, "write-out": true, "max-time": true, "connect-timeout": true,
+	"retry": true, "cookie-jar": true,
+}
+
+// curlShortFlags maps short curl options to their long names
+var curlShortFlags = map[byte]string{
+	'X': "request", 'H': "header", 'd': "data", 'b': "cookie", 'u': "user", 'k': "insecure",
+	'L': "location", 'I': "head", 'G': "get", 'A': "user-agent", 'e': "referer",
+	'o': "output", 'w': "write-out", 'm': "max-time", 'c': "cookie-jar",
+	's': "silent", 'S': "show-error", 'v': "verbose", 'i': "include", 'f': "fail", 'N': "no-buffer",
+}
+
+// curlIgnoredFlags do not change the request; they are accepted with a warning
+var curlIgnoredFlags = map[string]bool{
+	"output": true, "write-out": true, "max-time": true, "connect-timeout": true, "retry": true,
+	"cookie-jar": true, "silent": true, "show-error": true, "verbose": true, "include": true,
+	"fail": true, "no-buffer": true, "http1.1": true, "http2": true, "http2-prior-knowledge": true,
+	"tlsv1.2": true, "tlsv1.3": true,
+}
+
+// parseCurl converts a curl command line into a test request
+// Only the request is taken from the command; output and timeout options are ignored with a warning
+func parseCurl(command string) (TestRequest, []string, error) {
+	var req TestRequest
+	var warnings []string
+
+	args, err := splitShellWords(command)
+	if err != nil {
+		return req, nil, err
+	}
+	if len(args) == 0 || (path.Base(args[0]) != "curl" && path.Base(args[0]) != "curl.exe") {
+		return req, nil, fmt.Errorf("command must start with curl")
+	}
+
+	headers := map[string]string{}
+	removed := map[string]bool{} // headers removed with "Name:", by canonical name
+	var data []string
+	var urls []string
+	follow, compressed, getData := false, false, false
+
+	for i := 1; i < len(args); i++ {
+		arg := args[i]
+		var name, value string
+		hasValue := false
+
+		switch {
+		case strings.HasPrefix(arg, "--") && len(arg) > 2:
+			name = arg[2:]
+		case strings.HasPrefix(arg, "-") && len(arg) > 1:
+			// Short options may be combined (-sSL) or carry their value (-XPOST)
+			long, ok := curlShortFlags[arg[1]]
+			if !ok {
+				return req, nil, fmt.Errorf("unsupported curl option %s", arg)
+			}
+			name = long
+			if curlFlagsWithValue[long] && len(arg) > 2 {
+				value, hasValue = arg[2:], true
+			} else if len(arg) > 2 {
+				// Expand the rest of the group; as in curl, an option that takes a value
+				// uses the rest of the group (-sXPOST) or else the next argument
+				var expanded []string
+				for j := 2; j < len(arg); j++ {
+					flag, ok := curlShortFlags[arg[j]]
+					if !ok {
+						return req, nil, fmt.Errorf("unsupported curl option -%c in %s", arg[j], arg)
+					}
+					expanded = append(expanded, "--"+flag)
+					if curlFlagsWithValue[flag] && j+1 < len(arg) {
+						expanded = append(expanded, arg[j+1:])
+						break
+					}
+				}
+				args = append(args[:i+1], append(expanded, args[i+1:]...)...)
+			}
+		default:
+			urls = append(urls, arg)
+			continue
+		}
+
+		if curlFlagsWithValue[name] && !hasValue {
+			if i+1 >= len(args) {
+				return req, nil, fmt.Errorf("curl option %s needs a value", arg)
+			}
+			i++
+			value = args[i]
+		}
+
+		switch name {
+		case "request":
+			req.Method = strings.ToUpper(value)
+		case "header":
+			headerName, headerValue, ok := strings.Cut(value, ":")
+			headerName = strings.TrimSpace(headerName)
+			switch {
+			case ok && strings.TrimSpace(headerValue) == "":
+				// "Name:" removes a header curl would send
+				deleteHeader(headers, headerName)
+				removed[http.CanonicalHeaderKey(headerName)] = true
+			case ok:
+				setHeader(headers, headerName, strings.TrimSpace(headerValue))
+			case strings.HasSuffix(headerName, ";"):
+				// "Name;" sends the header with an empty value
+				setHeader(headers, strings.TrimSuffix(headerName, ";"), "")
+			default:
+				return req, nil, fmt.Errorf("invalid header %q", value)
+			}
+		case "data", "data-ascii", "data-binary":
+			if strings.HasPrefix(value, "@") {
+				return req, nil, fmt.Errorf("reading data from a file (%s) is not supported", value)
+			}
+			if name != "data-binary" {
+				value = strings.NewReplacer("\r", "", "\n", "").Replace(value)
+			}
+			data = append(data, value)
+		case "data-raw":
+			data = append(data, value)
+		case "data-urlencode":
+			if strings.Contains(value, "@") && !strings.Contains(value, "=") {
+				return req, nil, fmt.Errorf("reading data from a file (%s) is not supported", value)
+			}
+			field, content, ok := strings.Cut(value, "=")
+			if !ok {
+				data = append(data, url.QueryEscape(value))
+			} else if field == "" {
+				data = append(data, url.QueryEscape(content))
+			} else {
+				data = append(data, field+"="+url.QueryEscape(content))
+			}
+		case "cookie":
+			if !strings.Contains(value, "=") {
+				return req, nil, fmt.Errorf("reading cookies from a file (%s) is not supported", value)
+			}
+			setHeader(headers, "Cookie", value)
+		case "user":
+			setHeader(headers, "Authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte(value)))
+		case "user-agent":
+			setHeader(headers, "User-Agent", value)
+		case "referer":
+			setHeader(headers, "Referer", value)
+		case "insecure":
+			req.Insecure = true
+		case "compressed":
+			compressed = true
+		case "location":
+			follow = true
+		case "max-redirs":
+			n, err := strconv.Atoi(value)
+			if err != nil {
+				return req, nil, fmt.Errorf("invalid --max-redirs %q", value)
+			}
+			req.MaxRedirects = n
+		case "resolve":
+			req.Resolve = append(req.Resolve, value)
+		case "head":
+			req.Method = http.MethodHead
+		case "get":
+			getData = true
+		case "url":
+			urls = append(urls, value)
+		default:
+			if !curlIgnoredFlags[name] {
+				return req, nil, fmt.Errorf("unsupported curl option %s", arg)
+			}
+			warnings = append(warnings, "ignored "+arg)
+		}
+	}
+
+	if len(urls) != 1 {
+		return req, nil, fmt.Errorf("expected exactly one URL, got %d", len(urls))
+	}
+	req.URL = urls[0]
+	if !strings.Contains(req.URL, "://") {
+		req.URL = "http://" + req.URL // curl's default
+	}
+
+	// The checker requests and decodes compressed responses itself; an explicit
+	// Accept-Encoding would return an encoded body
+	if compressed && deleteHeader(headers, "Accept-Encoding") {
+		warnings = append(warnings, "dropped Accept-Encoding; compression is negotiated automatically")
+	}
+
+	if len(data) > 0 {
+		body := strings.Join(data, "&")
+		if getData {
+			separator := "?"
+			if strings.Contains(req.URL, "?") {
+				separator = "&"
+			}
+			req.URL += separator + body
+			if req.Method == "" {
+				req.Method = http.MethodGet
+			}
+		} else {
+			req.Body = body
+			if req.Method == "" {
+				req.Method = http.MethodPost
+			}
+			if !hasHeader(headers, "Content-Type") && !removed["Content-Type"] {
+				headers["Content-Type"] = "application/x-www-form-urlencoded"
+			}
+		}
+	}
+	if req.Method == http.MethodGet {
+		req.Method = ""
+	}
+
+	// curl does not follow redirects unless -L is given
+	if !follow {
+		req.FollowRedirects = &follow
+	}
+	if len(headers) > 0 {
+		req.Headers = headers
+	}
+	return req, warnings, nil
+}
+
+// setHeader sets a header, replacing a value set under another case
+func setHeader(headers map[string]string, name, value string) {
+	deleteHeader(headers, name)
+	headers[name] = value
+}
+
+// deleteHeader removes a header in any case, reporting whether it was set
+func deleteHeader(headers map[string]string, name string) bool {
+	found := false
+	for existing := range headers {
+		if strings.EqualFold(existing, name) {
+			delete(headers, existing)
+			found = true
+		}
+	}
+	return found
+}
+
+// hasHeader reports whether a header is set in any case
+func hasHeader(headers map[string]string, name string) bool {
+	for existing := range headers {
+		if strings.EqualFold(existing, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// splitShellWords splits a POSIX shell command line into words, handling single quotes,
+// double quotes, $'...' strings, backslash escapes and line continuations
+func splitShellWords(s string) ([]string, error) {
+	var words []string
+	var word strings.Builder
+	inWord := false
+
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			if inWord {
+				words = append(words, word.String())
+				word.Reset()
+				inWord = false
+			}
+		case c == '\\':
+			if i+1 < len(s) {
+				i++
+				if s[i] == '\r' && i+1 < len(s) && s[i+1] == '\n' {
+					i++
+				}
+				if s[i] != '\n' && s[i] != '\r' {
+					word.WriteByte(s[i])
+					inWord = true
+				}
+			}
+		case c == '\'':
+			end := strings.IndexByte(s[i+1:], '\'')
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated single quote")
+			}
+			word.WriteString(s[i+1 : i+1+end])
+			i += end + 1
+			inWord = true
+		case c == '$' && i+1 < len(s) && s[i+1] == '\'':
+			value, n, err := ansiCString(s[i+2:])
+			if err != nil {
+				return nil, err
+			}
+			word.WriteString(value)
+			i += n + 1
+			inWord = true
+		case c == '"':
+			i++
+			for ; i < len(s) && s[i] != '"'; i++ {
+				if s[i] == '\\' && i+1 < len(s) && strings.IndexByte("\"\\$`\n", s[i+1]) >= 0 {
+					i++
+					if s[i] == '\n' {
+						continue
+					}
+				}
+				word.WriteByte(s[i])
+			}
+			if i >= len(s) {
+				return nil, fmt.Errorf("unterminated double quote")
+			}
+			inWord = true
+		default:
+			word.WriteByte(c)
+			inWord = true
+		}
+	}
+	if inWord {
+		words = append(words, word.String())
+	}
+	return words, nil
+}
+
+// ansiCString decodes the body of a $'...' string up to the closing quote and returns
+// the value and the number of bytes consumed, including the quote
+func ansiCString(s string) (string, int, error) {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\'':
+			return b.String(), i + 1, nil
+		case '\\':
+			if i+1 >= len(s) {
+				return "", 0, fmt.Errorf("unterminated $' quote")
+			}
+			i++
+			switch s[i] {
+			case 'n':
+				b.WriteByte('\n')
+			case 't':
+				b.WriteByte('\t')
+			case 'r':
+				b.WriteByte('\r')
+			case '0':
+				b.WriteByte(0)
+			case 'x', 'u', 'U':
+				size := map[byte]int{'x': 2, 'u': 4, 'U': 8}[s[i]]
+				end := i + 1
+				for end < len(s) && end < i+1+size && strings.IndexByte("0123456789abcdefABCDEF", s[end]) >= 0 {
+					end++
+				}
+				n, err := strconv.ParseUint(s[i+1:end], 16, 32)
+				if err != nil {
+					return "", 0, fmt.Errorf("invalid escape \\%s", s[i:end])
+				}
+				if s[i] == 'x' {
+					b.WriteByte(byte(n))
+				} else {
+					b.WriteRune(rune(n))
+				}
+				i = end - 1
+			default:
+				b.WriteByte(s[i]) // \\, \', \" and unknown escapes
+			}
+		default:
+			b.WriteByte(s[i])
+		}
+	}
+	return "", 0, fmt.Errorf("unterminated $' quote")
+}
+
+// testRequestBody is the body of POST /api/test: a test request, optionally given as a curl command
+type testRequestBody struct {
+	TestRequest
+	Curl string `json:"curl,omitempty"`
+}
+
+// request returns the test request of a body; fields set next to a curl command
+// override or extend what the command specifies
+func (b testRequestBody) request() (TestRequest, error) {
+	if b.Curl == "" {
+		return b.TestRequest, nil
+	}
+	if b.URL != "" {
+		return TestRequest{}, fmt.Errorf("use either url or curl")
+	}
+	req, _, err := parseCurl(b.Curl)
+	if err != nil {
+		return TestRequest{}, err
+	}
+
+	if b.Method != "" {
+		req.Method = b.Method
+	}
+	if b.Body != "" {
+		req.Body = b.Body
+	}
+	for name, value := range b.Headers {
+		if req.Headers == nil {
+			req.Headers = map[string]string{}
+		}
+		setHeader(req.Headers, name, value)
+	}
+	if b.FollowRedirects != nil {
+		req.FollowRedirects = b.FollowRedirects
+	}
+	if b.MaxRedirects != 0 {
+		req.MaxRedirects = b.MaxRedirects
+	}
+	req.SameHostOnly = b.SameHostOnly
+	req.NoDowngrade = b.NoDowngrade
+	req.Insecure = req.Insecure || b.Insecure
+	req.Resolve = append(req.Resolve, b.Resolve...)
+	req.Assert = b.Assert
+	return req, nil
+}
+
+// parseCurlHandler handles POST /api/parse-curl
+func parseCurlHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var body ParseCurlRequest
+	if err := json.NewDecoder(io.LimitReader(r.Body, maxCurlCommandBytes)).Decode(&body); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid JSON"})
+		return
+	}
+
+	req, warnings, err := parseCurl(body.Curl)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid curl command: " + err.Error()})
+		return
+	}
+	if validationErr := validateRequest(req); validationErr != "" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": validationErr})
+		return
+	}
+	writeJSON(w, http.StatusOK, ParseCurlResponse{Request: req, Warnings: warnings})
+}
@@ -0,0 +1,235 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSplitShellWords(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    []string
+		wantErr bool
+	}{
+		{`curl https://example.com`, []string{"curl", "https://example.com"}, false},
+		{`curl 'a b' "c \"d\"" e\ f`, []string{"curl", "a b", `c "d"`, "e f"}, false},
+		{"curl \\\n  -H 'X: 1' \\\r\n  url", []string{"curl", "-H", "X: 1", "url"}, false},
+		{`curl $'it\'s\n\x41é'`, []string{"curl", "it's\nAé"}, false},
+		{`curl 'it'\''s'`, []string{"curl", "it's"}, false},
+		{`curl ''`, []string{"curl", ""}, false},
+		{`curl 'open`, nil, true},
+		{`curl "open`, nil, true},
+		{`curl $'open`, nil, true},
+	}
+	for _, tt := range tests {
+		got, err := splitShellWords(tt.input)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("splitShellWords(%q) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+			continue
+		}
+		if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("splitShellWords(%q) = %q, want %q", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestParseCurl(t *testing.T) {
+	noFollow := false
+	tests := []struct {
+		name    string
+		command string
+		want    TestRequest
+		wantErr bool
+	}{
+		{
+			name:    "plain GET does not follow redirects",
+			command: `curl https://example.com/`,
+			want:    TestRequest{URL: "https://example.com/", FollowRedirects: &noFollow},
+		},
+		{
+			name:    "follow redirects",
+			command: `curl -sSL --max-redirs 3 https://example.com/`,
+			want:    TestRequest{URL: "https://example.com/", MaxRedirects: 3},
+		},
+		{
+			name: "browser copy as cURL",
+			command: `curl 'https://api.example.com/items?page=2' \
+  -H 'accept: application/json' \
+  -H 'accept-encoding: gzip, deflate, br' \
+  -b 'session=abc; theme=dark' \
+  -H 'content-type: application/json' \
+  --data-raw '{"name":"x"}' \
+  --compressed`,
+			want: TestRequest{
+				URL:    "https://api.example.com/items?page=2",
+				Method: http.MethodPost,
+				Body:   `{"name":"x"}`,
+				Headers: map[string]string{
+					"accept":       "application/json",
+					"Cookie":       "session=abc; theme=dark",
+					"content-type": "application/json",
+				},
+				FollowRedirects: &noFollow,
+			},
+		},
+		{
+			name:    "method, basic auth, insecure and resolve",
+			command: `curl -XPUT -u user:pass -k --resolve example.com:443:127.0.0.1 -L https://example.com`,
+			want: TestRequest{
+				URL:      "https://example.com",
+				Method:   http.MethodPut,
+				Headers:  map[string]string{"Authorization": "Basic dXNlcjpwYXNz"},
+				Insecure: true,
+				Resolve:  []string{"example.com:443:127.0.0.1"},
+			},
+		},
+		{
+			name:    "form data defaults to POST with a form content type",
+			command: `curl -d a=1 -d b=2 example.com`,
+			want: TestRequest{
+				URL:             "http://example.com",
+				Method:          http.MethodPost,
+				Body:            "a=1&b=2",
+				Headers:         map[string]string{"Content-Type": "application/x-www-form-urlencoded"},
+				FollowRedirects: &noFollow,
+			},
+		},
+		{
+			name:    "get puts data in the query",
+			command: `curl -G --data-urlencode 'q=a b' https://example.com/search?x=1`,
+			want:    TestRequest{URL: "https://example.com/search?x=1&q=a+b", FollowRedirects: &noFollow},
+		},
+		{
+			name:    "head and user agent",
+			command: `curl -I -A bot/1.0 --url https://example.com`,
+			want: TestRequest{
+				URL:             "https://example.com",
+				Method:          http.MethodHead,
+				Headers:         map[string]string{"User-Agent": "bot/1.0"},
+				FollowRedirects: &noFollow,
+			},
+		},
+		{
+			name:    "value option inside a group takes the rest of it",
+			command: `curl -sXPOST https://example.com`,
+			want:    TestRequest{URL: "https://example.com", Method: http.MethodPost, FollowRedirects: &noFollow},
+		},
+		{
+			name:    "value option ending a group takes the next argument",
+			command: `curl -sSLX POST https://example.com`,
+			want:    TestRequest{URL: "https://example.com", Method: http.MethodPost},
+		},
+		{name: "unknown option in a group", command: `curl -sZ https://example.com`, wantErr: true},
+		{name: "not curl", command: `wget https://example.com`, wantErr: true},
+		{name: "no URL", command: `curl -L`, wantErr: true},
+		{name: "two URLs", command: `curl https://a.example https://b.example`, wantErr: true},
+		{name: "missing value", command: `curl https://example.com -H`, wantErr: true},
+		{name: "data from file", command: `curl -d @body.json https://example.com`, wantErr: true},
+		{name: "unknown option", command: `curl --proxy http://p:8080 https://example.com`, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, _, err := parseCurl(tt.command)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseCurl() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseCurl() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseCurlRoundTrip(t *testing.T) {
+	// Commands built by the checker parse back into the same request
+	req := TestRequest{
+		URL:          "https://example.com/api",
+		Method:       http.MethodPost,
+		Headers:      map[string]string{"Content-Type": "application/json", "X-Note": "it's"},
+		Body:         `{"a":1}`,
+		MaxRedirects: 3,
+		Insecure:     true,
+		Resolve:      []string{"example.com:443:127.0.0.1"},
+	}
+	got, _, err := parseCurl(curlCommand(req))
+	if err != nil {
+		t.Fatalf("parseCurl() error = %v", err)
+	}
+	req.Headers["User-Agent"] = defaultUserAgent
+	if !reflect.DeepEqual(got, req) {
+		t.Errorf("parseCurl(curlCommand()) = %+v, want %+v", got, req)
+	}
+
+	// A body without a Content-Type keeps its method and gains no form Content-Type
+	req = TestRequest{URL: "https://example.com/api", Method: http.MethodGet, Body: "q"}
+	got, _, err = parseCurl(curlCommand(req))
+	if err != nil {
+		t.Fatalf("parseCurl() error = %v", err)
+	}
+	if requestMethod(got) != http.MethodGet || got.Body != "q" || hasHeader(got.Headers, "Content-Type") {
+		t.Errorf("parseCurl(curlCommand()) = %+v, want a GET with a body and no Content-Type", got)
+	}
+}
+
+func TestParseCurlHandler(t *testing.T) {
+	tests := []struct {
+		body       string
+		wantStatus int
+	}{
+		{`{"curl":"curl -L https://example.com"}`, http.StatusOK},
+		{`{"curl":"curl ftp://example.com/"}`, http.StatusBadRequest},
+		{`{"curl":"curl 'open"}`, http.StatusBadRequest},
+		{`not json`, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		parseCurlHandler(w, httptest.NewRequest(http.MethodPost, "/api/parse-curl", strings.NewReader(tt.body)))
+		if w.Code != tt.wantStatus {
+			t.Errorf("%s: expected %d, got %d: %s", tt.body, tt.wantStatus, w.Code, w.Body.String())
+		}
+	}
+
+	w := httptest.NewRecorder()
+	parseCurlHandler(w, httptest.NewRequest(http.MethodPost, "/api/parse-curl", strings.NewReader(`{"curl":"curl -s https://example.com"}`)))
+	var response ParseCurlResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("invalid response: %v", err)
+	}
+	if response.Request.URL != "https://example.com" || len(response.Warnings) != 1 {
+		t.Errorf("unexpected response %+v", response)
+	}
+}
+
+func TestTestURLHandlerCurl(t *testing.T) {
+	useTestResultStore(t, newMemoryResultStore(10, 0))
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Token") != "abc" {
+			w.WriteHeader(http.StatusForbidden)
+		}
+	}))
+	defer server.Close()
+
+	body, _ := json.Marshal(map[string]interface{}{
+		"curl":   "curl -H 'X-Token: abc' " + server.URL,
+		"assert": map[string]interface{}{"status": []string{"200"}},
+	})
+	w := httptest.NewRecorder()
+	testURLHandler(w, httptest.NewRequest(http.MethodPost, "/api/test", strings.NewReader(string(body))))
+	var response TestResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("invalid response: %v", err)
+	}
+	if response.StatusCode != http.StatusOK || response.Verdict != verdictPass {
+		t.Errorf("unexpected response %+v", response)
+	}
+
+	w = httptest.NewRecorder()
+	testURLHandler(w, httptest.NewRequest(http.MethodPost, "/api/test", strings.NewReader(`{"url":"`+server.URL+`","curl":"curl `+server.URL+`"}`)))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for url and curl, got %d", w.Code)
+	}
+}
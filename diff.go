@@ -0,0 +1,548 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// Diff limits
+const (
+	maxDiffRequestBytes = 1 << 20
+	maxDiffBodyBytes    = 256 << 10 // bytes of each body compared
+	maxDiffCells        = 4_000_000 // largest line LCS table; larger changes are shown as a full replacement
+	diffContextLines    = 3
+)
+
+// defaultIgnoredHeaders change on every response, so they are left out of header diffs by default
+var defaultIgnoredHeaders = []string{"Date", "Age", "Cf-Ray", "X-Request-Id"}
+
+// DiffTarget is one side of a diff: a stored result or a request to run
+type DiffTarget struct {
+	ID      string       `json:"id,omitempty"`
+	Request *TestRequest `json:"request,omitempty"`
+}
+
+// DiffRequest is the body of POST /api/diff
+type DiffRequest struct {
+	A DiffTarget `json:"a"`
+	B DiffTarget `json:"b"`
+	// IgnoreHeaders are left out of the header diff; nil means defaultIgnoredHeaders, [] compares all
+	IgnoreHeaders []string `json:"ignoreHeaders"`
+}
+
+// DiffSide summarizes one of the compared results
+type DiffSide struct {
+	ID            string `json:"id"`
+	Stored        bool   `json:"stored"` // loaded from the result store rather than run for this diff
+	URL           string `json:"url"`
+	Success       bool   `json:"success"`
+	StatusCode    int    `json:"statusCode,omitempty"`
+	FinalURL      string `json:"finalUrl,omitempty"`
+	Blocked       bool   `json:"blocked"`
+	ResponseTime  int64  `json:"responseTime,omitempty"` // milliseconds
+	Error         string `json:"error,omitempty"`
+	ErrorCode     string `json:"errorCode,omitempty"`
+	BodySize      int    `json:"bodySize"`
+	BodyHash      string `json:"bodyHash,omitempty"` // SHA-256 of the full decoded body; unknown for results stored without it
+	BodyTruncated bool   `json:"bodyTruncated"`      // only part of the body was compared
+}
+
+// StatusDiff compares the final status codes
+type StatusDiff struct {
+	A       int  `json:"a"`
+	B       int  `json:"b"`
+	Changed bool `json:"changed"`
+}
+
+// RedirectStep is one response of a redirect chain; the last step is the final response
+type RedirectStep struct {
+	URL        string `json:"url"`
+	StatusCode int    `json:"statusCode"`
+}
+
+// RedirectDiff compares the redirect chains, including the final URL
+type RedirectDiff struct {
+	A       []RedirectStep `json:"a"`
+	B       []RedirectStep `json:"b"`
+	Changed bool           `json:"changed"`
+}
+
+// HeaderChange is a header sent by both responses with different values
+type HeaderChange struct {
+	Name string `json:"name"`
+	A    string `json:"a"`
+	B    string `json:"b"`
+}
+
+// HeaderDiff compares the final response headers
+type HeaderDiff struct {
+	Added   map[string]string `json:"added"`   // only in B
+	Removed map[string]string `json:"removed"` // only in A
+	Changed []HeaderChange    `json:"changed"`
+	Ignored []string          `json:"ignored"`
+}
+
+// BodyDiff compares the decoded bodies
+type BodyDiff struct {
+	Changed bool   `json:"changed"`
+	Binary  bool   `json:"binary"`            // not text, so only compared for equality
+	Partial bool   `json:"partial"`           // a body was cut to its stored preview or to the diff limit
+	Unknown bool   `json:"unknown,omitempty"` // partial and without both hashes, so changes may be missed
+	Unified string `json:"unified,omitempty"` // unified diff of the lines
+}
+
+// DiffResponse is returned by POST /api/diff
+type DiffResponse struct {
+	A         DiffSide     `json:"a"`
+	B         DiffSide     `json:"b"`
+	Identical bool         `json:"identical"` // no status, redirect, header or body changes, and the bodies were fully compared
+	Status    StatusDiff   `json:"status"`
+	Redirects RedirectDiff `json:"redirects"`
+	Headers   HeaderDiff   `json:"headers"`
+	Body      BodyDiff     `json:"body"`
+}
+
+// errResultNotFound is returned by loadDiffInput for unknown or expired result IDs
+var errResultNotFound = errors.New("result not found or expired")
+
+// diffInput is a result ready to be compared
+type diffInput struct {
+	side     DiffSide
+	response TestResponse
+	body     []byte
+}
+
+// validateDiffTarget checks that a side names a stored result or a valid request
+func validateDiffTarget(name string, target DiffTarget) string {
+	if (target.ID == "") == (target.Request == nil) {
+		return fmt.Sprintf("%s needs either an id or a request", name)
+	}
+	if target.Request != nil {
+		if msg := validateRequest(*target.Request); msg != "" {
+			return name + ": " + msg
+		}
+	}
+	return ""
+}
+
+// loadDiffInput loads a stored result or runs a request for one side of a diff
+func loadDiffInput(ctx context.Context, target DiffTarget) (diffInput, error) {
+	if target.ID != "" {
+		stored, found, err := resultStore.Get(target.ID)
+		if err != nil {
+			return diffInput{}, err
+		}
+		if !found {
+			return diffInput{}, errResultNotFound
+		}
+		// Only the body preview is stored, along with the size and hash of the full body
+		input := diffInput{response: stored.Response, body: []byte(stored.Response.BodyPreview)}
+		input.side = newDiffSide(stored.ID, stored.Request.URL, stored.Response, input.body)
+		input.side.Stored = true
+		input.side.BodyTruncated = stored.Response.Truncated
+		if stored.Response.BodyHash != "" {
+			input.side.BodySize = stored.Response.BodySize
+		}
+		return input, nil
+	}
+
+	req := *target.Request
+	response, _, body := runTest(ctx, req)
+	stored := recordResult(ctx, sourceDiff, "", req, response)
+	input := diffInput{response: stored.Response, body: body}
+	input.side = newDiffSide(stored.ID, req.URL, stored.Response, body)
+	if len(body) > maxDiffBodyBytes {
+		input.body = body[:maxDiffBodyBytes]
+		input.side.BodyTruncated = true
+	}
+	return input, nil
+}
+
+// newDiffSide summarizes a response
+func newDiffSide(id, url string, response TestResponse, body []byte) DiffSide {
+	return DiffSide{
+		ID:           id,
+		URL:          url,
+		Success:      response.Success,
+		StatusCode:   response.StatusCode,
+		FinalURL:     response.FinalURL,
+		Blocked:      response.Blocked,
+		ResponseTime: response.ResponseTime,
+		Error:        response.Error,
+		ErrorCode:    response.ErrorCode,
+		BodySize:     len(body),
+		BodyHash:     response.BodyHash,
+	}
+}
+
+// bodyHash returns the hex SHA-256 of a body
+func bodyHash(body []byte) string {
+	sum := sha256.Sum256(body)
+	return hex.EncodeToString(sum[:])
+}
+
+// diffResults compares two results
+func diffResults(a, b diffInput, ignoreHeaders []string) DiffResponse {
+	diff := DiffResponse{
+		A:         a.side,
+		B:         b.side,
+		Status:    StatusDiff{A: a.response.StatusCode, B: b.response.StatusCode},
+		Redirects: RedirectDiff{A: redirectChain(a.response), B: redirectChain(b.response)},
+		Headers:   diffHeaders(a.response.Headers, b.response.Headers, ignoreHeaders),
+	}
+	if a.side.BodyTruncated || b.side.BodyTruncated {
+		diff.Body = diffPartialBodies(a, b)
+	} else {
+		diff.Body = diffBodies(a.body, b.body)
+	}
+	diff.Status.Changed = diff.Status.A != diff.Status.B
+	diff.Redirects.Changed = !equalRedirectChains(diff.Redirects.A, diff.Redirects.B)
+	diff.Identical = !diff.Status.Changed && !diff.Redirects.Changed && !diff.Body.Changed && !diff.Body.Unknown &&
+		len(diff.Headers.Added) == 0 && len(diff.Headers.Removed) == 0 && len(diff.Headers.Changed) == 0
+	return diff
+}
+
+// diffPartialBodies compares bodies of which only a prefix is known
+// Both are cut to the same length so the diff does not show the cut as a change; whether
+// the bodies changed is decided by their hashes, never by the prefixes alone
+func diffPartialBodies(a, b diffInput) BodyDiff {
+	n := maxDiffBodyBytes
+	if a.side.BodyTruncated {
+		n = min(n, len(a.body))
+	}
+	if b.side.BodyTruncated {
+		n = min(n, len(b.body))
+	}
+	bodyA, bodyB := trimPartialRune(truncateBody(a.body, n)), trimPartialRune(truncateBody(b.body, n))
+
+	diff := BodyDiff{Partial: true, Binary: isBinary(bodyA) || isBinary(bodyB)}
+	if a.side.BodyHash == "" || b.side.BodyHash == "" {
+		diff.Unknown = true
+		return diff
+	}
+	diff.Changed = a.side.BodyHash != b.side.BodyHash
+	if diff.Changed && !diff.Binary && !bytes.Equal(bodyA, bodyB) {
+		diff.Unified = unifiedDiff(string(bodyA), string(bodyB), "a", "b")
+	}
+	return diff
+}
+
+// truncateBody returns at most the first n bytes of a body
+func truncateBody(body []byte, n int) []byte {
+	if len(body) > n {
+		return body[:n]
+	}
+	return body
+}
+
+// trimPartialRune drops a UTF-8 sequence cut off at the end of a body
+func trimPartialRune(body []byte) []byte {
+	start := len(body) - 1
+	for start > 0 && start > len(body)-utf8.UTFMax && !utf8.RuneStart(body[start]) {
+		start--
+	}
+	if start >= 0 && !utf8.FullRune(body[start:]) {
+		return body[:start]
+	}
+	return body
+}
+
+// redirectChain lists the redirect hops of a response followed by its final URL
+func redirectChain(response TestResponse) []RedirectStep {
+	chain := []RedirectStep{}
+	for _, hop := range response.Redirects {
+		chain = append(chain, RedirectStep{URL: hop.URL, StatusCode: hop.StatusCode})
+	}
+	if response.FinalURL != "" {
+		chain = append(chain, RedirectStep{URL: response.FinalURL, StatusCode: response.StatusCode})
+	}
+	return chain
+}
+
+// equalRedirectChains reports whether two chains visit the same URLs with the same statuses
+func equalRedirectChains(a, b []RedirectStep) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// diffHeaders compares two header maps, skipping ignored headers
+func diffHeaders(a, b map[string]string, ignore []string) HeaderDiff {
+	diff := HeaderDiff{Added: map[string]string{}, Removed: map[string]string{}, Changed: []HeaderChange{}, Ignored: []string{}}
+	ignored := map[string]bool{}
+	for _, name := range ignore {
+		name = http.CanonicalHeaderKey(name)
+		ignored[name] = true
+		diff.Ignored = append(diff.Ignored, name)
+	}
+
+	for name, value := range a {
+		if ignored[http.CanonicalHeaderKey(name)] {
+			continue
+		}
+		other, ok := b[name]
+		switch {
+		case !ok:
+			diff.Removed[name] = value
+		case other != value:
+			diff.Changed = append(diff.Changed, HeaderChange{Name: name, A: value, B: other})
+		}
+	}
+	for name, value := range b {
+		if _, ok := a[name]; !ok && !ignored[http.CanonicalHeaderKey(name)] {
+			diff.Added[name] = value
+		}
+	}
+	sort.Slice(diff.Changed, func(i, j int) bool { return diff.Changed[i].Name < diff.Changed[j].Name })
+	return diff
+}
+
+// diffBodies compares two bodies, as a unified line diff when both are text
+func diffBodies(a, b []byte) BodyDiff {
+	diff := BodyDiff{Changed: !bytes.Equal(a, b)}
+	if isBinary(a) || isBinary(b) {
+		diff.Binary = true
+		return diff
+	}
+	if diff.Changed {
+		diff.Unified = unifiedDiff(string(a), string(b), "a", "b")
+	}
+	return diff
+}
+
+// isBinary reports whether a body is not UTF-8 text
+func isBinary(body []byte) bool {
+	return bytes.IndexByte(body, 0) >= 0 || !utf8.Valid(body)
+}
+
+// diffLine is a line of an edit script: ' ' kept, '-' only in a, '+' only in b
+type diffLine struct {
+	op   byte
+	text string
+}
+
+// splitLines splits text into lines without their newlines
+func splitLines(text string) []string {
+	if text == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(text, "\n"), "\n")
+}
+
+// diffLines returns an edit script turning a into b, based on their longest common subsequence
+func diffLines(a, b []string) []diffLine {
+	// Common prefix and suffix keep the LCS table small for the usual local changes
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	script := make([]diffLine, 0, len(a)+len(b))
+	for _, line := range a[:prefix] {
+		script = append(script, diffLine{' ', line})
+	}
+	x, y := a[prefix:len(a)-suffix], b[prefix:len(b)-suffix]
+
+	if len(x)*len(y) > maxDiffCells {
+		for _, line := range x {
+			script = append(script, diffLine{'-', line})
+		}
+		for _, line := range y {
+			script = append(script, diffLine{'+', line})
+		}
+	} else {
+		// lcs[i][j] is the LCS length of x[i:] and y[j:]
+		lcs := make([][]int32, len(x)+1)
+		for i := range lcs {
+			lcs[i] = make([]int32, len(y)+1)
+		}
+		for i := len(x) - 1; i >= 0; i-- {
+			for j := len(y) - 1; j >= 0; j-- {
+				if x[i] == y[j] {
+					lcs[i][j] = lcs[i+1][j+1] + 1
+				} else if lcs[i+1][j] >= lcs[i][j+1] {
+					lcs[i][j] = lcs[i+1][j]
+				} else {
+					lcs[i][j] = lcs[i][j+1]
+				}
+			}
+		}
+		i, j := 0, 0
+		for i < len(x) && j < len(y) {
+			switch {
+			case x[i] == y[j]:
+				script = append(script, diffLine{' ', x[i]})
+				i++
+				j++
+			case lcs[i+1][j] >= lcs[i][j+1]:
+				script = append(script, diffLine{'-', x[i]})
+				i++
+			default:
+				script = append(script, diffLine{'+', y[j]})
+				j++
+			}
+		}
+		for ; i < len(x); i++ {
+			script = append(script, diffLine{'-', x[i]})
+		}
+		for ; j < len(y); j++ {
+			script = append(script, diffLine{'+', y[j]})
+		}
+	}
+
+	for _, line := range a[len(a)-suffix:] {
+		script = append(script, diffLine{' ', line})
+	}
+	return script
+}
+
+// unifiedDiff formats the line differences of a and b as a unified diff with three lines of context
+func unifiedDiff(a, b, nameA, nameB string) string {
+	script := diffLines(splitLines(a), splitLines(b))
+
+	var out strings.Builder
+	fmt.Fprintf(&out, "--- %s\n+++ %s\n", nameA, nameB)
+
+	// aLine and bLine count the lines of a and b before script[k]
+	aLine, bLine := 0, 0
+	for k := 0; k < len(script); {
+		if script[k].op == ' ' {
+			aLine++
+			bLine++
+			k++
+			continue
+		}
+
+		// A hunk runs from the context before this change to the context after the last
+		// change that is no more than two contexts away
+		start := k - diffContextLines
+		if start < 0 {
+			start = 0
+		}
+		end := k
+		for end < len(script) {
+			if script[end].op != ' ' {
+				end++
+				continue
+			}
+			next := end
+			for next < len(script) && script[next].op == ' ' {
+				next++
+			}
+			if next == len(script) || next-end > 2*diffContextLines {
+				break
+			}
+			end = next
+		}
+		stop := end + diffContextLines
+		if stop > len(script) {
+			stop = len(script)
+		}
+
+		aStart, bStart := aLine-(k-start), bLine-(k-start)
+		aCount, bCount := 0, 0
+		for _, line := range script[start:stop] {
+			if line.op != '+' {
+				aCount++
+			}
+			if line.op != '-' {
+				bCount++
+			}
+		}
+		fmt.Fprintf(&out, "@@ -%s +%s @@\n", hunkRange(aStart, aCount), hunkRange(bStart, bCount))
+		for _, line := range script[start:stop] {
+			out.WriteByte(line.op)
+			out.WriteString(line.text)
+			out.WriteByte('\n')
+		}
+
+		aLine += aCount - (k - start)
+		bLine += bCount - (k - start)
+		k = stop
+	}
+	return out.String()
+}
+
+// hunkRange formats the line range of a hunk; an empty range names the line before it
+func hunkRange(start, count int) string {
+	if count == 0 {
+		return fmt.Sprintf("%d,0", start)
+	}
+	if count == 1 {
+		return fmt.Sprintf("%d", start+1)
+	}
+	return fmt.Sprintf("%d,%d", start+1, count)
+}
+
+// diffHandler handles POST /api/diff
+func diffHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req DiffRequest
+	if err := json.NewDecoder(io.LimitReader(r.Body, maxDiffRequestBytes)).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid JSON"})
+		return
+	}
+	msg := validateDiffTarget("a", req.A)
+	if msg == "" {
+		msg = validateDiffTarget("b", req.B)
+	}
+	if msg != "" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": msg})
+		return
+	}
+	ignore := req.IgnoreHeaders
+	if ignore == nil {
+		ignore = defaultIgnoredHeaders
+	}
+
+	// Run both sides at once so they see the site in the same state
+	var inputs [2]diffInput
+	var errs [2]error
+	var wg sync.WaitGroup
+	for i, target := range []DiffTarget{req.A, req.B} {
+		wg.Add(1)
+		go func(i int, target DiffTarget) {
+			defer wg.Done()
+			inputs[i], errs[i] = loadDiffInput(r.Context(), target)
+		}(i, target)
+	}
+	wg.Wait()
+
+	ids := [2]string{req.A.ID, req.B.ID}
+	for i, err := range errs {
+		if errors.Is(err, errResultNotFound) {
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": "Result " + ids[i] + " not found or expired"})
+			return
+		}
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to read result"})
+			return
+		}
+	}
+	writeJSON(w, http.StatusOK, diffResults(inputs[0], inputs[1], ignore))
+}
@@ -0,0 +1,234 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestUnifiedDiff(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b string
+		want string
+	}{
+		{
+			name: "changed line",
+			a:    "a\nb\nc\n",
+			b:    "a\nB\nc\n",
+			want: "--- a\n+++ b\n@@ -1,3 +1,3 @@\n a\n-b\n+B\n c\n",
+		},
+		{
+			name: "added to empty",
+			a:    "",
+			b:    "x\n",
+			want: "--- a\n+++ b\n@@ -0,0 +1 @@\n+x\n",
+		},
+		{
+			name: "separate hunks",
+			a:    "1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\n12\n",
+			b:    "one\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\ntwelve\n",
+			want: "--- a\n+++ b\n@@ -1,4 +1,4 @@\n-1\n+one\n 2\n 3\n 4\n@@ -9,4 +9,4 @@\n 9\n 10\n 11\n-12\n+twelve\n",
+		},
+		{
+			name: "nearby changes share a hunk",
+			a:    "1\n2\n3\n4\n5\n6\n7\n8\n",
+			b:    "1\nx\n3\n4\n5\n6\ny\n8\n",
+			want: "--- a\n+++ b\n@@ -1,8 +1,8 @@\n 1\n-2\n+x\n 3\n 4\n 5\n 6\n-7\n+y\n 8\n",
+		},
+		{
+			name: "removed lines",
+			a:    "keep\ndrop1\ndrop2\nkeep\n",
+			b:    "keep\nkeep\n",
+			want: "--- a\n+++ b\n@@ -1,4 +1,2 @@\n keep\n-drop1\n-drop2\n keep\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := unifiedDiff(tt.a, tt.b, "a", "b"); got != tt.want {
+				t.Errorf("unexpected diff:\n%s\nwant:\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDiffLinesUsesLCS(t *testing.T) {
+	script := diffLines(strings.Split("a b c a b b a", " "), strings.Split("c b a b a c", " "))
+	kept := 0
+	for _, line := range script {
+		if line.op == ' ' {
+			kept++
+		}
+	}
+	if kept != 4 {
+		t.Errorf("expected the 4 lines of the longest common subsequence to be kept, got %d: %v", kept, script)
+	}
+}
+
+func TestDiffHeaders(t *testing.T) {
+	a := map[string]string{"Server": "nginx", "Date": "Mon", "X-Cache": "HIT", "Content-Type": "text/html"}
+	b := map[string]string{"Server": "cloudflare", "Date": "Tue", "Cf-Mitigated": "challenge", "Content-Type": "text/html"}
+
+	diff := diffHeaders(a, b, []string{"date"})
+	if len(diff.Changed) != 1 || diff.Changed[0] != (HeaderChange{Name: "Server", A: "nginx", B: "cloudflare"}) {
+		t.Errorf("unexpected changes %+v", diff.Changed)
+	}
+	if len(diff.Added) != 1 || diff.Added["Cf-Mitigated"] != "challenge" {
+		t.Errorf("unexpected added headers %v", diff.Added)
+	}
+	if len(diff.Removed) != 1 || diff.Removed["X-Cache"] != "HIT" {
+		t.Errorf("unexpected removed headers %v", diff.Removed)
+	}
+	if len(diff.Ignored) != 1 || diff.Ignored[0] != "Date" {
+		t.Errorf("unexpected ignored headers %v", diff.Ignored)
+	}
+}
+
+func TestDiffBodies(t *testing.T) {
+	if diff := diffBodies([]byte("same"), []byte("same")); diff.Changed || diff.Unified != "" {
+		t.Errorf("expected no change, got %+v", diff)
+	}
+	if diff := diffBodies([]byte("\x89PNG\x00"), []byte("text")); !diff.Changed || !diff.Binary || diff.Unified != "" {
+		t.Errorf("expected a binary change without a text diff, got %+v", diff)
+	}
+}
+
+func TestDiffPartialBodies(t *testing.T) {
+	full := []byte(strings.Repeat("é\n", 500))
+	stored := diffInput{body: full[:1000], side: DiffSide{BodyTruncated: true, BodyHash: bodyHash(full)}}
+	live := diffInput{body: full, side: DiffSide{BodyHash: bodyHash(full)}}
+
+	// The preview ends inside a rune; it is still text and no change
+	if diff := diffPartialBodies(stored, live); diff.Changed || diff.Binary || diff.Unknown || !diff.Partial || diff.Unified != "" {
+		t.Errorf("expected an unchanged partial text body, got %+v", diff)
+	}
+
+	changed := append(append([]byte{}, full...), "more\n"...)
+	live = diffInput{body: changed, side: DiffSide{BodyHash: bodyHash(changed)}}
+	if diff := diffPartialBodies(stored, live); !diff.Changed || diff.Unified != "" {
+		t.Errorf("expected a change past the preview without a diff of equal previews, got %+v", diff)
+	}
+
+	// Without a hash the change cannot be told from the preview
+	stored.side.BodyHash = ""
+	live = diffInput{body: []byte("other\n"), side: DiffSide{BodyHash: bodyHash([]byte("other\n"))}}
+	if diff := diffPartialBodies(stored, live); diff.Changed || !diff.Unknown {
+		t.Errorf("expected an unknown body change, got %+v", diff)
+	}
+}
+
+func TestTrimPartialRune(t *testing.T) {
+	tests := []struct {
+		body, want string
+	}{
+		{"", ""},
+		{"abc", "abc"},
+		{"aé", "aé"},
+		{"a\xc3", "a"},
+		{"a\xe2\x82", "a"},
+		{"\xff", "\xff"},
+	}
+	for _, tt := range tests {
+		if got := string(trimPartialRune([]byte(tt.body))); got != tt.want {
+			t.Errorf("trimPartialRune(%q) = %q, want %q", tt.body, got, tt.want)
+		}
+	}
+}
+
+func TestDiffHandler(t *testing.T) {
+	useTestResultStore(t, newMemoryResultStore(100, 0))
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/long" {
+			w.Write([]byte(strings.Repeat("é\n", 800)))
+			return
+		}
+		if strings.HasPrefix(r.Header.Get("User-Agent"), "curl/") {
+			w.Header().Set("Server", "waf")
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte("<h1>Access denied</h1>\n<p>curl</p>\n"))
+			return
+		}
+		w.Header().Set("Server", "origin")
+		w.Write([]byte("<h1>Welcome</h1>\n<p>browser</p>\n"))
+	}))
+	defer server.Close()
+
+	post := func(body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		diffHandler(w, httptest.NewRequest(http.MethodPost, "/api/diff", strings.NewReader(body)))
+		return w
+	}
+
+	w := post(`{"a": {"request": {"url": "` + server.URL + `"}}, "b": {"request": {"url": "` + server.URL + `", "headers": {"User-Agent": "curl/8.5.0"}}}}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var diff DiffResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &diff); err != nil {
+		t.Fatal(err)
+	}
+	if diff.Identical || !diff.Status.Changed || diff.Status.A != 200 || diff.Status.B != 403 {
+		t.Errorf("unexpected status diff %+v", diff.Status)
+	}
+	// Content-Length and Server differ; Date is ignored by default
+	if len(diff.Headers.Changed) != 2 || diff.Headers.Changed[1] != (HeaderChange{Name: "Server", A: "origin", B: "waf"}) {
+		t.Errorf("unexpected header diff %+v", diff.Headers)
+	}
+	if !strings.Contains(diff.Body.Unified, "-<h1>Welcome</h1>\n") || !strings.Contains(diff.Body.Unified, "+<h1>Access denied</h1>\n") {
+		t.Errorf("unexpected body diff:\n%s", diff.Body.Unified)
+	}
+	if diff.A.ID == "" || diff.A.Stored || diff.A.BodyHash == "" {
+		t.Errorf("unexpected side %+v", diff.A)
+	}
+
+	// A stored result compared with itself is identical
+	w = post(`{"a": {"id": "` + diff.A.ID + `"}, "b": {"id": "` + diff.A.ID + `"}}`)
+	var same DiffResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &same); err != nil {
+		t.Fatal(err)
+	}
+	if !same.Identical || !same.A.Stored || same.A.URL != server.URL {
+		t.Errorf("expected identical stored results, got %+v", same)
+	}
+
+	// A stored result of a long page compared with a new run only has its preview, but the
+	// hashes show that the body did not change
+	w = post(`{"a": {"request": {"url": "` + server.URL + `/long"}}, "b": {"request": {"url": "` + server.URL + `/long"}}}`)
+	var long DiffResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &long); err != nil {
+		t.Fatal(err)
+	}
+	w = post(`{"a": {"id": "` + long.A.ID + `"}, "b": {"request": {"url": "` + server.URL + `/long"}}}`)
+	var partial DiffResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &partial); err != nil {
+		t.Fatal(err)
+	}
+	if !partial.Identical || partial.Body.Changed || partial.Body.Binary || !partial.Body.Partial || partial.Body.Unknown {
+		t.Errorf("expected an identical partial body, got %+v", partial.Body)
+	}
+	if partial.A.BodySize != 2400 || partial.A.BodyHash != partial.B.BodyHash || !partial.A.BodyTruncated {
+		t.Errorf("expected the stored side to keep the full body size and hash, got %+v", partial.A)
+	}
+
+	tests := []struct {
+		name       string
+		body       string
+		wantStatus int
+	}{
+		{"invalid JSON", "{", http.StatusBadRequest},
+		{"missing side", `{"a": {"id": "x"}}`, http.StatusBadRequest},
+		{"both id and request", `{"a": {"id": "x", "request": {"url": "https://example.com"}}, "b": {"id": "y"}}`, http.StatusBadRequest},
+		{"invalid request", `{"a": {"id": "x"}, "b": {"request": {"url": "ftp://example.com"}}}`, http.StatusBadRequest},
+		{"unknown id", `{"a": {"id": "` + diff.A.ID + `"}, "b": {"id": "missing"}}`, http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if w := post(tt.body); w.Code != tt.wantStatus {
+				t.Errorf("expected %d, got %d: %s", tt.wantStatus, w.Code, w.Body.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"syscall"
+)
+
+// Phases in which a test can fail, reported in TestResponse.ErrorPhase
+const (
+	phaseRequest  = "request"
+	phasePolicy   = "policy"
+	phaseRedirect = "redirect"
+	phaseDNS      = "dns"
+	phaseConnect  = "connect"
+	phaseTLS      = "tls"
+	phaseResponse = "response"
+)
+
+// errorClass is the machine-readable classification of a failed test
+type errorClass struct {
+	Code    string // e.g. dns_not_found, connect_refused, tls_expired
+	Phase   string
+	Message string // human-readable message shown to the user
+}
+
+// maxErrorMessageLength limits unclassified error messages shown to the user
+const maxErrorMessageLength = 200
+
+// classifyError maps an error returned by the HTTP client to an error class
+// The client wraps every failure in *url.Error, so all checks unwrap with errors.As/errors.Is
+func classifyError(err error) errorClass {
+	if err == nil {
+		return errorClass{}
+	}
+
+	// Policy violations raised by this service
+	var policyErr *policyError
+	if errors.As(err, &policyErr) {
+		return errorClass{"blocked_by_policy", phasePolicy, "blocked by policy: " + policyErr.Error()}
+	}
+	var redirectErr *redirectError
+	if errors.As(err, &redirectErr) {
+		return errorClass{redirectErr.Reason, phaseRedirect, "redirect error: " + redirectErr.Error()}
+	}
+
+	if errors.Is(err, context.Canceled) {
+		return errorClass{"canceled", phaseRequest, "request canceled"}
+	}
+
+	// DNS errors
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		switch {
+		case dnsErr.IsNotFound:
+			return errorClass{"dns_not_found", phaseDNS, fmt.Sprintf("DNS error: host not found (%s)", dnsErr.Name)}
+		case dnsErr.IsTimeout:
+			return errorClass{"dns_timeout", phaseDNS, fmt.Sprintf("DNS error: lookup of %s timed out", dnsErr.Name)}
+		}
+		return errorClass{"dns_error", phaseDNS, fmt.Sprintf("DNS error: %s", dnsErr.Err)}
+	}
+
+	// Certificate errors
+	var unknownAuthorityErr x509.UnknownAuthorityError
+	if errors.As(err, &unknownAuthorityErr) {
+		return errorClass{"tls_unknown_authority", phaseTLS, "SSL/TLS error: certificate signed by unknown authority"}
+	}
+	var hostnameErr x509.HostnameError
+	if errors.As(err, &hostnameErr) {
+		return errorClass{"tls_hostname_mismatch", phaseTLS, "SSL/TLS error: " + hostnameErr.Error()}
+	}
+	var invalidErr x509.CertificateInvalidError
+	if errors.As(err, &invalidErr) {
+		if invalidErr.Reason == x509.Expired {
+			return errorClass{"tls_expired", phaseTLS, "SSL/TLS error: " + invalidErr.Error()}
+		}
+		return errorClass{"tls_invalid_certificate", phaseTLS, "SSL/TLS error: " + invalidErr.Error()}
+	}
+	var verificationErr *tls.CertificateVerificationError
+	if errors.As(err, &verificationErr) {
+		return errorClass{"tls_invalid_certificate", phaseTLS, "SSL/TLS error: certificate verification failed"}
+	}
+
+	// TLS protocol errors; net/http replaces the RecordHeaderError with a plain error when the server speaks HTTP
+	var recordHeaderErr tls.RecordHeaderError
+	if errors.As(err, &recordHeaderErr) || strings.Contains(err.Error(), "server gave HTTP response to HTTPS client") {
+		return errorClass{"tls_protocol_error", phaseTLS, "SSL/TLS error: server did not respond with TLS (is this an http port?)"}
+	}
+	var alertErr tls.AlertError
+	if errors.As(err, &alertErr) {
+		return errorClass{"tls_handshake_failed", phaseTLS, "SSL/TLS error: handshake failed: " + alertErr.Error()}
+	}
+
+	// Timeouts, by phase
+	var opErr *net.OpError
+	isDial := errors.As(err, &opErr) && opErr.Op == "dial"
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		switch {
+		case isDial:
+			return errorClass{"connect_timeout", phaseConnect, "connection error: timed out connecting to host"}
+		case strings.Contains(err.Error(), "TLS handshake timeout"):
+			return errorClass{"tls_timeout", phaseTLS, "SSL/TLS error: handshake timed out"}
+		}
+		return errorClass{"timeout", phaseResponse, "timeout: request exceeded 30 seconds"}
+	}
+
+	// Connection errors
+	switch {
+	case errors.Is(err, syscall.ECONNREFUSED):
+		return errorClass{"connect_refused", phaseConnect, "connection error: connection refused"}
+	case errors.Is(err, syscall.EHOSTUNREACH), errors.Is(err, syscall.ENETUNREACH):
+		return errorClass{"connect_unreachable", phaseConnect, "connection error: host unreachable"}
+	case errors.Is(err, syscall.ECONNRESET):
+		return errorClass{"reset", phaseResponse, "connection error: connection reset by peer"}
+	case errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF):
+		return errorClass{"eof", phaseResponse, "connection error: server closed the connection without a response"}
+	case isDial:
+		return errorClass{"connect_error", phaseConnect, fmt.Sprintf("connection error: %s", opErr.Err)}
+	}
+
+	// Generic error message
+	errStr := err.Error()
+	// Truncate very long error messages
+	if len(errStr) > maxErrorMessageLength {
+		errStr = errStr[:maxErrorMessageLength] + "..."
+	}
+	return errorClass{"unknown", phaseResponse, errStr}
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// timeoutError is a net.Error that reports a timeout
+type timeoutError struct{ msg string }
+
+func (e timeoutError) Error() string   { return e.msg }
+func (e timeoutError) Timeout() bool   { return true }
+func (e timeoutError) Temporary() bool { return true }
+
+// clientError wraps err the way http.Client.Do does
+func clientError(err error) error {
+	return &url.Error{Op: "Get", URL: "https://example.com/", Err: err}
+}
+
+func TestClassifyError(t *testing.T) {
+	cert, _ := newTestCertificate(t, &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "example.com"},
+		DNSNames:     []string{"example.com"},
+		NotBefore:    time.Now().Add(-48 * time.Hour),
+		NotAfter:     time.Now().Add(-24 * time.Hour),
+	}, nil, nil)
+
+	dialErr := func(err error) error {
+		return &net.OpError{Op: "dial", Net: "tcp", Err: &os.SyscallError{Syscall: "connect", Err: err}}
+	}
+	readErr := func(err error) error {
+		return &net.OpError{Op: "read", Net: "tcp", Err: &os.SyscallError{Syscall: "read", Err: err}}
+	}
+
+	tests := []struct {
+		name  string
+		err   error
+		code  string
+		phase string
+	}{
+		{"canceled", context.Canceled, "canceled", phaseRequest},
+		{"dns not found", &net.DNSError{Err: "no such host", Name: "nope.example", IsNotFound: true}, "dns_not_found", phaseDNS},
+		{"dns timeout", &net.DNSError{Err: "i/o timeout", Name: "slow.example", IsTimeout: true}, "dns_timeout", phaseDNS},
+		{"dns other", &net.DNSError{Err: "server misbehaving", Name: "bad.example"}, "dns_error", phaseDNS},
+		{"connect refused", dialErr(syscall.ECONNREFUSED), "connect_refused", phaseConnect},
+		{"connect timeout", &net.OpError{Op: "dial", Net: "tcp", Err: timeoutError{"i/o timeout"}}, "connect_timeout", phaseConnect},
+		{"host unreachable", dialErr(syscall.EHOSTUNREACH), "connect_unreachable", phaseConnect},
+		{"network unreachable", dialErr(syscall.ENETUNREACH), "connect_unreachable", phaseConnect},
+		{"tls unknown authority", &tls.CertificateVerificationError{Err: x509.UnknownAuthorityError{Cert: cert}}, "tls_unknown_authority", phaseTLS},
+		{"tls expired", &tls.CertificateVerificationError{Err: x509.CertificateInvalidError{Cert: cert, Reason: x509.Expired}}, "tls_expired", phaseTLS},
+		{"tls hostname mismatch", &tls.CertificateVerificationError{Err: x509.HostnameError{Certificate: cert, Host: "other.com"}}, "tls_hostname_mismatch", phaseTLS},
+		{"tls invalid certificate", &tls.CertificateVerificationError{Err: x509.CertificateInvalidError{Cert: cert, Reason: x509.NotAuthorizedToSign}}, "tls_invalid_certificate", phaseTLS},
+		{"tls protocol error", tls.RecordHeaderError{Msg: "first record does not look like a TLS handshake"}, "tls_protocol_error", phaseTLS},
+		{"tls alert", tls.AlertError(40), "tls_handshake_failed", phaseTLS},
+		{"tls handshake timeout", timeoutError{"net/http: TLS handshake timeout"}, "tls_timeout", phaseTLS},
+		{"response timeout", timeoutError{"context deadline exceeded (Client.Timeout exceeded while awaiting headers)"}, "timeout", phaseResponse},
+		{"connection reset", readErr(syscall.ECONNRESET), "reset", phaseResponse},
+		{"eof", io.EOF, "eof", phaseResponse},
+		{"unexpected eof", io.ErrUnexpectedEOF, "eof", phaseResponse},
+		{"too many redirects", &redirectError{Reason: redirectTooMany, Limit: 10}, "too_many_redirects", phaseRedirect},
+		{"redirect loop", &redirectError{Reason: redirectLoop, To: "https://example.com/"}, "redirect_loop", phaseRedirect},
+		{"blocked by policy", &net.OpError{Op: "dial", Net: "tcp", Err: &policyError{IP: net.ParseIP("10.0.0.1")}}, "blocked_by_policy", phasePolicy},
+		{"unknown", errors.New("something odd"), "unknown", phaseResponse},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := classifyError(clientError(tt.err))
+			if result.Code != tt.code {
+				t.Errorf("expected code %q, got %q (%s)", tt.code, result.Code, result.Message)
+			}
+			if result.Phase != tt.phase {
+				t.Errorf("expected phase %q, got %q", tt.phase, result.Phase)
+			}
+			if result.Message == "" {
+				t.Errorf("expected a message")
+			}
+		})
+	}
+
+	// Test long unknown errors are truncated
+	t.Run("long message truncated", func(t *testing.T) {
+		long := make([]byte, 500)
+		for i := range long {
+			long[i] = 'x'
+		}
+		result := classifyError(errors.New(string(long)))
+		if len(result.Message) != maxErrorMessageLength+3 {
+			t.Errorf("expected truncated message, got length %d", len(result.Message))
+		}
+	})
+
+	// Test nil error
+	t.Run("nil error", func(t *testing.T) {
+		if result := classifyError(nil); result.Code != "" {
+			t.Errorf("expected empty class, got %+v", result)
+		}
+	})
+}
+
+func TestErrorCodeInResponse(t *testing.T) {
+	// Test a real refused connection
+	t.Run("connect refused", func(t *testing.T) {
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatalf("failed to listen: %v", err)
+		}
+		addr := listener.Addr().String()
+		listener.Close()
+
+		response := testURL(TestRequest{URL: "http://" + addr})
+
+		if response.ErrorCode != "connect_refused" || response.ErrorPhase != phaseConnect {
+			t.Errorf("expected connect_refused/connect, got %q/%q (%s)", response.ErrorCode, response.ErrorPhase, response.Error)
+		}
+	})
+
+	// Test a real untrusted certificate
+	t.Run("tls unknown authority", func(t *testing.T) {
+		server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+		defer server.Close()
+
+		response := testURL(TestRequest{URL: server.URL})
+
+		if response.ErrorCode != "tls_unknown_authority" || response.ErrorPhase != phaseTLS {
+			t.Errorf("expected tls_unknown_authority/tls, got %q/%q (%s)", response.ErrorCode, response.ErrorPhase, response.Error)
+		}
+	})
+
+	// Test plain HTTP server answering an https URL
+	t.Run("tls protocol error", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+		defer server.Close()
+
+		response := testURL(TestRequest{URL: "https://" + server.Listener.Addr().String()})
+
+		if response.ErrorCode != "tls_protocol_error" {
+			t.Errorf("expected tls_protocol_error, got %q (%s)", response.ErrorCode, response.Error)
+		}
+	})
+
+	// Test server closing the connection without a response
+	t.Run("eof", func(t *testing.T) {
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatalf("failed to listen: %v", err)
+		}
+		defer listener.Close()
+		go func() {
+			for {
+				conn, err := listener.Accept()
+				if err != nil {
+					return
+				}
+				buf := make([]byte, 1024)
+				conn.Read(buf)
+				conn.Close()
+			}
+		}()
+
+		response := testURL(TestRequest{URL: "http://" + listener.Addr().String()})
+
+		if response.ErrorCode != "eof" {
+			t.Errorf("expected eof, got %q (%s)", response.ErrorCode, response.Error)
+		}
+	})
+}
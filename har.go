@@ -0,0 +1,348 @@
+package main
+
+import (
+	"encoding/base64"
+	"fmt"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// maxHARBodyBytes is the most response body content included in a HAR document
+const maxHARBodyBytes = 1 << 20
+
+// HAR is an HTTP Archive 1.2 document, see http://www.softwareishard.com/blog/har-12-spec/
+type HAR struct {
+	Log HARLog `json:"log"`
+}
+
+// HARLog is the root of a HAR document
+type HARLog struct {
+	Version string     `json:"version"`
+	Creator HARCreator `json:"creator"`
+	Entries []HAREntry `json:"entries"`
+	Comment string     `json:"comment,omitempty"`
+}
+
+// HARCreator names the application that created the document
+type HARCreator struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+// HAREntry is one request/response exchange: the first request or a redirect hop
+type HAREntry struct {
+	StartedDateTime string      `json:"startedDateTime"`
+	Time            float64     `json:"time"` // milliseconds
+	Request         HARRequest  `json:"request"`
+	Response        HARResponse `json:"response"`
+	Cache           struct{}    `json:"cache"`
+	Timings         HARTimings  `json:"timings"`
+	ServerIPAddress string      `json:"serverIPAddress,omitempty"`
+}
+
+// HARRequest is the request of an entry
+type HARRequest struct {
+	Method      string         `json:"method"`
+	URL         string         `json:"url"`
+	HTTPVersion string         `json:"httpVersion"`
+	Cookies     []HARCookie    `json:"cookies"`
+	Headers     []HARNameValue `json:"headers"`
+	QueryString []HARNameValue `json:"queryString"`
+	PostData    *HARPostData   `json:"postData,omitempty"`
+	HeadersSize int            `json:"headersSize"`
+	BodySize    int64          `json:"bodySize"`
+}
+
+// HARResponse is the response of an entry; Status is 0 when no response was received
+type HARResponse struct {
+	Status      int            `json:"status"`
+	StatusText  string         `json:"statusText"`
+	HTTPVersion string         `json:"httpVersion"`
+	Cookies     []HARCookie    `json:"cookies"`
+	Headers     []HARNameValue `json:"headers"`
+	Content     HARContent     `json:"content"`
+	RedirectURL string         `json:"redirectURL"`
+	HeadersSize int            `json:"headersSize"`
+	BodySize    int64          `json:"bodySize"`
+	Error       string         `json:"_error,omitempty"` // why no response was received
+}
+
+// HARNameValue is a header or query parameter
+type HARNameValue struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// HARCookie is a request or response cookie
+type HARCookie struct {
+	Name     string `json:"name"`
+	Value    string `json:"value"`
+	Path     string `json:"path,omitempty"`
+	Domain   string `json:"domain,omitempty"`
+	Expires  string `json:"expires,omitempty"`
+	HTTPOnly bool   `json:"httpOnly,omitempty"`
+	Secure   bool   `json:"secure,omitempty"`
+}
+
+// HARPostData is the body of a request
+type HARPostData struct {
+	MimeType string         `json:"mimeType"`
+	Params   []HARNameValue `json:"params"`
+	Text     string         `json:"text"`
+}
+
+// HARContent is the body of a response
+type HARContent struct {
+	Size     int64  `json:"size"`
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text,omitempty"`
+	Encoding string `json:"encoding,omitempty"` // base64 for binary content
+	Comment  string `json:"comment,omitempty"`
+}
+
+// HARTimings are the phases of an entry in milliseconds; -1 means the phase did not apply
+// Connect includes SSL, as the specification requires
+type HARTimings struct {
+	Blocked float64 `json:"blocked"`
+	DNS     float64 `json:"dns"`
+	Connect float64 `json:"connect"`
+	Send    float64 `json:"send"`
+	Wait    float64 `json:"wait"`
+	Receive float64 `json:"receive"`
+	SSL     float64 `json:"ssl"`
+}
+
+// buildHAR converts the trace of a test into a HAR document with one entry per hop
+// Only the final response has body content; redacted request headers and cookies are masked
+func buildHAR(testReq TestRequest, response TestResponse, tracer *tracingTransport, body []byte) *HAR {
+	har := &HAR{Log: HARLog{
+		Version: "1.2",
+		Creator: HARCreator{Name: "url-checker", Version: "1.0"},
+		Entries: []HAREntry{},
+	}}
+	if !response.Success {
+		har.Log.Comment = response.Error
+	}
+
+	tracer.mu.Lock()
+	hops := tracer.hops
+	tracer.mu.Unlock()
+
+	for i, hop := range hops {
+		last := i == len(hops)-1
+		var hopBody []byte
+		if last && response.Success {
+			hopBody = body
+		}
+		entry := hop.harEntry(testReq, hopBody)
+		if last && entry.Response.Status == 0 {
+			entry.Response.Error = response.Error
+		}
+		har.Log.Entries = append(har.Log.Entries, entry)
+	}
+	return har
+}
+
+// harEntry converts one hop into a HAR entry; body is the response content if it was read
+func (h *hopTimer) harEntry(testReq TestRequest, body []byte) HAREntry {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	entry := HAREntry{
+		StartedDateTime: h.start.Format("2006-01-02T15:04:05.000Z07:00"),
+		Request:         h.harRequest(testReq),
+		Response:        h.harResponse(body),
+		Timings:         h.harTimings(),
+	}
+	for _, phase := range []float64{entry.Timings.Blocked, entry.Timings.DNS, entry.Timings.Connect, entry.Timings.Send, entry.Timings.Wait, entry.Timings.Receive} {
+		if phase > 0 {
+			entry.Time += phase
+		}
+	}
+	if host, _, err := net.SplitHostPort(h.remoteAddr); err == nil {
+		entry.ServerIPAddress = host
+	}
+	return entry
+}
+
+// harRequest converts the recorded request of a hop
+func (h *hopTimer) harRequest(testReq TestRequest) HARRequest {
+	request := HARRequest{
+		Method:      h.method,
+		URL:         h.url,
+		HTTPVersion: "HTTP/1.1",
+		Cookies:     []HARCookie{},
+		Headers:     []HARNameValue{{Name: "Host", Value: h.host}},
+		QueryString: []HARNameValue{},
+		HeadersSize: -1,
+		BodySize:    0,
+	}
+	if h.proto != "" {
+		request.HTTPVersion = h.proto
+	}
+
+	header := h.requestHeader.Clone()
+	for name := range header {
+		if redactedHeaders[name] {
+			header[name] = []string{redactedValue}
+		}
+	}
+	request.Headers = append(request.Headers, harHeaders(header)...)
+	for _, cookie := range (&http.Request{Header: h.requestHeader}).Cookies() {
+		value := cookie.Value
+		if redactedHeaders["Cookie"] {
+			value = redactedValue
+		}
+		request.Cookies = append(request.Cookies, HARCookie{Name: cookie.Name, Value: value})
+	}
+
+	if parsed, err := url.Parse(h.url); err == nil {
+		query := parsed.Query()
+		for _, name := range sortedQueryKeys(query) {
+			for _, value := range query[name] {
+				request.QueryString = append(request.QueryString, HARNameValue{Name: name, Value: value})
+			}
+		}
+	}
+
+	// The body is sent on the first request and on 307/308 redirects, which keep the method
+	if h.requestSize != 0 && testReq.Body != "" {
+		request.BodySize = int64(len(testReq.Body))
+		request.PostData = &HARPostData{
+			MimeType: h.requestHeader.Get("Content-Type"),
+			Params:   []HARNameValue{},
+			Text:     testReq.Body,
+		}
+	}
+	return request
+}
+
+// harResponse converts the recorded response of a hop
+func (h *hopTimer) harResponse(body []byte) HARResponse {
+	response := HARResponse{
+		Status:      h.statusCode,
+		HTTPVersion: h.proto,
+		Cookies:     []HARCookie{},
+		Headers:     harHeaders(h.header),
+		HeadersSize: -1,
+		BodySize:    -1,
+		Content:     HARContent{MimeType: "x-unknown"},
+	}
+	if h.statusCode == 0 {
+		return response
+	}
+	response.StatusText = http.StatusText(h.statusCode)
+	response.RedirectURL = h.header.Get("Location")
+	if contentType := h.header.Get("Content-Type"); contentType != "" {
+		response.Content.MimeType = contentType
+	}
+
+	for _, cookie := range (&http.Response{Header: h.header}).Cookies() {
+		c := HARCookie{Name: cookie.Name, Value: cookie.Value, Path: cookie.Path, Domain: cookie.Domain, HTTPOnly: cookie.HttpOnly, Secure: cookie.Secure}
+		if !cookie.Expires.IsZero() {
+			c.Expires = cookie.Expires.UTC().Format(time.RFC3339)
+		}
+		response.Cookies = append(response.Cookies, c)
+	}
+
+	if body == nil {
+		response.Content.Comment = "body of redirect responses is not captured"
+		return response
+	}
+	response.BodySize = int64(len(body))
+	response.Content.Size = int64(len(body))
+	if len(body) > maxHARBodyBytes {
+		body = body[:maxHARBodyBytes]
+		response.Content.Comment = fmt.Sprintf("truncated to %d of %d bytes", maxHARBodyBytes, response.Content.Size)
+	}
+	if isTextContent(response.Content.MimeType) && utf8.Valid(body) {
+		response.Content.Text = string(body)
+	} else {
+		response.Content.Text = base64.StdEncoding.EncodeToString(body)
+		response.Content.Encoding = "base64"
+	}
+	return response
+}
+
+// harTimings converts the recorded events of a hop into HAR timings
+func (h *hopTimer) harTimings() HARTimings {
+	optional := func(start, end time.Time) float64 {
+		if start.IsZero() {
+			return -1
+		}
+		return phaseMillis(start, end)
+	}
+	connectEnd := h.connectDone
+	if h.tlsDone.After(connectEnd) {
+		connectEnd = h.tlsDone
+	}
+	return HARTimings{
+		Blocked: -1,
+		DNS:     optional(h.dnsStart, h.dnsDone),
+		Connect: optional(h.connectStart, connectEnd),
+		Send:    phaseMillis(h.gotConn, h.wroteRequest),
+		Wait:    phaseMillis(h.wroteRequest, h.firstByte),
+		Receive: durationMillis(h.transfer),
+		SSL:     optional(h.tlsStart, h.tlsDone),
+	}
+}
+
+// harHeaders lists every header value, sorted by name
+func harHeaders(header http.Header) []HARNameValue {
+	names := make([]string, 0, len(header))
+	for name := range header {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	list := []HARNameValue{}
+	for _, name := range names {
+		for _, value := range header[name] {
+			list = append(list, HARNameValue{Name: name, Value: value})
+		}
+	}
+	return list
+}
+
+// sortedQueryKeys returns the parameter names of a query in order
+func sortedQueryKeys(query url.Values) []string {
+	keys := make([]string, 0, len(query))
+	for key := range query {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// isTextContent reports whether a media type is text that can be included as is
+func isTextContent(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	return strings.HasPrefix(mediaType, "text/") ||
+		strings.HasSuffix(mediaType, "+json") || strings.HasSuffix(mediaType, "+xml") ||
+		mediaType == "application/json" || mediaType == "application/xml" ||
+		mediaType == "application/javascript" || mediaType == "application/x-www-form-urlencoded"
+}
+
+// harFilename returns the download name of the HAR document of a test
+func harFilename(rawURL string, now time.Time) string {
+	host := "result"
+	if parsed, err := url.Parse(rawURL); err == nil && parsed.Hostname() != "" {
+		host = parsed.Hostname()
+	}
+	host = strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '.' || r == '-' {
+			return r
+		}
+		return '_'
+	}, host)
+	return fmt.Sprintf("url-checker-%s-%s.har", host, now.UTC().Format("20060102-150405"))
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// harHeader returns the first value of a HAR header, or ""
+func harHeader(headers []HARNameValue, name string) string {
+	for _, h := range headers {
+		if strings.EqualFold(h.Name, name) {
+			return h.Value
+		}
+	}
+	return ""
+}
+
+func TestBuildHAR(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/start":
+			http.SetCookie(w, &http.Cookie{Name: "session", Value: "abc", Path: "/", HttpOnly: true})
+			http.Redirect(w, r, "/final?lang=en&lang=de", http.StatusTemporaryRedirect)
+		case "/final":
+			w.Header().Set("Content-Type", "application/json")
+			w.Header().Add("X-Multi", "one")
+			w.Header().Add("X-Multi", "two")
+			w.Write([]byte(`{"ok":true}`))
+		case "/binary":
+			w.Header().Set("Content-Type", "application/octet-stream")
+			w.Write([]byte{0xff, 0x00, 0xfe})
+		case "/large":
+			w.Header().Set("Content-Type", "text/plain")
+			w.Write(bytes.Repeat([]byte("a"), maxHARBodyBytes+10))
+		}
+	}))
+	defer server.Close()
+
+	t.Run("records every hop", func(t *testing.T) {
+		response, har := testURLHAR(context.Background(), TestRequest{
+			URL:     server.URL + "/start",
+			Method:  http.MethodPost,
+			Body:    `{"q":1}`,
+			Headers: map[string]string{"Content-Type": "application/json", "Authorization": "Bearer secret", "Cookie": "id=42"},
+		})
+		if !response.Success {
+			t.Fatalf("test failed: %s", response.Error)
+		}
+		if har.Log.Version != "1.2" || len(har.Log.Entries) != 2 {
+			t.Fatalf("expected HAR 1.2 with 2 entries, got %+v", har.Log)
+		}
+
+		first, final := har.Log.Entries[0], har.Log.Entries[1]
+		if first.Request.Method != http.MethodPost || first.Response.Status != http.StatusTemporaryRedirect ||
+			first.Response.RedirectURL != "/final?lang=en&lang=de" {
+			t.Errorf("unexpected first entry %+v", first)
+		}
+		if first.Request.PostData == nil || first.Request.PostData.Text != `{"q":1}` || first.Request.PostData.MimeType != "application/json" {
+			t.Errorf("unexpected post data %+v", first.Request.PostData)
+		}
+		if got := harHeader(first.Request.Headers, "Authorization"); got != redactedValue {
+			t.Errorf("expected redacted Authorization, got %q", got)
+		}
+		if len(first.Request.Cookies) != 1 || first.Request.Cookies[0].Value != redactedValue {
+			t.Errorf("expected redacted request cookie, got %+v", first.Request.Cookies)
+		}
+		if got := harHeader(first.Request.Headers, "User-Agent"); got != defaultUserAgent {
+			t.Errorf("expected User-Agent, got %q", got)
+		}
+		if len(first.Response.Cookies) != 1 || first.Response.Cookies[0].Name != "session" || !first.Response.Cookies[0].HTTPOnly {
+			t.Errorf("unexpected response cookies %+v", first.Response.Cookies)
+		}
+		if first.Response.Content.Text != "" || first.Response.BodySize != -1 {
+			t.Errorf("redirect body should not be captured: %+v", first.Response.Content)
+		}
+		if first.Timings.Connect < 0 || first.Timings.SSL != -1 || first.ServerIPAddress != "127.0.0.1" {
+			t.Errorf("unexpected timings %+v or server IP %q", first.Timings, first.ServerIPAddress)
+		}
+
+		// 307 keeps the method and body
+		if final.Request.Method != http.MethodPost || final.Request.PostData == nil {
+			t.Errorf("expected POST with body after 307, got %+v", final.Request)
+		}
+		if len(final.Request.QueryString) != 2 || final.Request.QueryString[1].Value != "de" {
+			t.Errorf("unexpected query string %+v", final.Request.QueryString)
+		}
+		if final.Response.Status != http.StatusOK || final.Response.Content.Text != `{"ok":true}` || final.Response.Content.Size != 11 {
+			t.Errorf("unexpected final response %+v", final.Response)
+		}
+		multi := 0
+		for _, h := range final.Response.Headers {
+			if h.Name == "X-Multi" {
+				multi++
+			}
+		}
+		if multi != 2 {
+			t.Errorf("expected both X-Multi values, got %+v", final.Response.Headers)
+		}
+		if _, err := time.Parse(time.RFC3339, final.StartedDateTime); err != nil {
+			t.Errorf("invalid startedDateTime %q", final.StartedDateTime)
+		}
+	})
+
+	t.Run("binary body", func(t *testing.T) {
+		_, har := testURLHAR(context.Background(), TestRequest{URL: server.URL + "/binary"})
+		content := har.Log.Entries[0].Response.Content
+		if content.Encoding != "base64" || content.Text != base64.StdEncoding.EncodeToString([]byte{0xff, 0x00, 0xfe}) {
+			t.Errorf("unexpected content %+v", content)
+		}
+	})
+
+	t.Run("large body is truncated", func(t *testing.T) {
+		_, har := testURLHAR(context.Background(), TestRequest{URL: server.URL + "/large"})
+		content := har.Log.Entries[0].Response.Content
+		if len(content.Text) != maxHARBodyBytes || content.Size != maxHARBodyBytes+10 || content.Comment == "" {
+			t.Errorf("unexpected content size %d/%d, comment %q", len(content.Text), content.Size, content.Comment)
+		}
+	})
+
+	t.Run("failed request", func(t *testing.T) {
+		_, har := testURLHAR(context.Background(), TestRequest{URL: "http://localhost:1/"})
+		if len(har.Log.Entries) != 1 {
+			t.Fatalf("expected 1 entry, got %d", len(har.Log.Entries))
+		}
+		if entry := har.Log.Entries[0]; entry.Response.Status != 0 || entry.Response.Error == "" || har.Log.Comment == "" {
+			t.Errorf("expected failed entry with error, got %+v", entry.Response)
+		}
+	})
+}
+
+func TestIsTextContent(t *testing.T) {
+	tests := []struct {
+		contentType string
+		want        bool
+	}{
+		{"text/html; charset=utf-8", true},
+		{"application/json", true},
+		{"application/problem+json", true},
+		{"image/svg+xml", true},
+		{"image/png", false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		if got := isTextContent(tt.contentType); got != tt.want {
+			t.Errorf("isTextContent(%q) = %v, want %v", tt.contentType, got, tt.want)
+		}
+	}
+}
+
+func TestHARFilename(t *testing.T) {
+	now := time.Date(2025, 1, 15, 10, 0, 0, 0, time.UTC)
+	if got := harFilename("https://example.com:8443/path", now); got != "url-checker-example.com-20250115-100000.har" {
+		t.Errorf("unexpected filename %q", got)
+	}
+	if got := harFilename("://bad", now); got != "url-checker-result-20250115-100000.har" {
+		t.Errorf("unexpected filename %q", got)
+	}
+}
+
+func TestTestURLHandlerHAR(t *testing.T) {
+	useTestResultStore(t, newMemoryResultStore(10, 0))
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("hello"))
+	}))
+	defer server.Close()
+
+	w := httptest.NewRecorder()
+	testURLHandler(w, httptest.NewRequest(http.MethodPost, "/api/test?format=har", strings.NewReader(`{"url":"`+server.URL+`"}`)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if !strings.HasPrefix(w.Header().Get("Content-Disposition"), `attachment; filename="url-checker-127.0.0.1-`) {
+		t.Errorf("unexpected Content-Disposition %q", w.Header().Get("Content-Disposition"))
+	}
+	var har HAR
+	if err := json.Unmarshal(w.Body.Bytes(), &har); err != nil {
+		t.Fatalf("invalid HAR: %v", err)
+	}
+	if len(har.Log.Entries) != 1 || har.Log.Entries[0].Response.Content.Text != "hello" {
+		t.Errorf("unexpected HAR %+v", har.Log)
+	}
+	if !strings.HasPrefix(har.Log.Comment, "Result /r/") {
+		t.Errorf("expected permalink in comment, got %q", har.Log.Comment)
+	}
+
+	// The test is still recorded in history
+	results, _ := resultStore.Query(ResultQuery{Limit: 10})
+	if len(results) != 1 {
+		t.Errorf("expected 1 stored result, got %d", len(results))
+	}
+
+	w = httptest.NewRecorder()
+	testURLHandler(w, httptest.NewRequest(http.MethodPost, "/api/test?format=xml", strings.NewReader(`{"url":"`+server.URL+`"}`)))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for unknown format, got %d", w.Code)
+	}
+}
@@ -0,0 +1,445 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// History limits
+const (
+	maxHistoryEntries   = 10000 // results kept by a store
+	defaultHistoryLimit = 100
+	maxHistoryLimit     = 1000
+	maxHistoryLineBytes = 16 << 20
+)
+
+// Where a stored result came from
+const (
+	sourceTest    = "test"
+	sourceBatch   = "batch"
+	sourceMatrix  = "matrix"
+	sourceDiff    = "diff"
+	sourceMonitor = "monitor"
+)
+
+// Outcomes of a stored result, used to filter history
+const (
+	outcomeOK      = "ok"      // 2xx/3xx response, or all assertions passed
+	outcomeFail    = "fail"    // unexpected status or failed assertions
+	outcomeBlocked = "blocked" // 403/429 or a block page
+	outcomeError   = "error"   // no response
+)
+
+// StoredResult is a test result kept in the result store
+type StoredResult struct {
+	ID        string       `json:"id"`
+	Time      time.Time    `json:"time"`
+	Source    string       `json:"source"` // test, batch, matrix, diff or monitor
+	MonitorID string       `json:"monitorId,omitempty"`
+	Outcome   string       `json:"outcome"`
+	Request   TestRequest  `json:"request"`
+	Response  TestResponse `json:"response"`
+}
+
+// ResultQuery filters stored results; zero fields match everything
+type ResultQuery struct {
+	URL       string
+	Since     time.Time
+	Until     time.Time
+	Outcomes  []string
+	Source    string
+	MonitorID string
+	Limit     int
+}
+
+// ResultStore keeps test results
+type ResultStore interface {
+	// Save stores a result
+	Save(result StoredResult) error
+	// Get returns the result with the given ID, reporting whether it was found
+	Get(id string) (StoredResult, bool, error)
+	// Query returns matching results, newest first
+	Query(q ResultQuery) ([]StoredResult, error)
+	// Close releases the store's resources
+	Close() error
+}
+
+// resultStore stores the results of every check run by this server
+var resultStore ResultStore = newMemoryResultStore(maxHistoryEntries, 0)
+
+// resultOutcome classifies a test response for history filtering
+func resultOutcome(response TestResponse) string {
+	switch {
+	case !response.Success:
+		return outcomeError
+	case response.Blocked && response.Verdict != verdictPass:
+		return outcomeBlocked
+	case isUp(response):
+		return outcomeOK
+	}
+	return outcomeFail
+}
+
+// recordResult saves a check in the result store, logs it and returns the stored result
+// The response gets the result's ID and commands to reproduce it; sensitive request headers
+// are redacted before storage and in the commands
+func recordResult(ctx context.Context, source, monitorID string, req TestRequest, response TestResponse) StoredResult {
+	id := newID()
+	redacted := redactRequest(req)
+	response.ID = id
+	response.Commands = buildCommands(redacted)
+	result := StoredResult{
+		ID:        id,
+		Time:      time.Now().UTC(),
+		Source:    source,
+		MonitorID: monitorID,
+		Outcome:   resultOutcome(response),
+		Request:   redacted,
+		Response:  response,
+	}
+	metrics.observe(source, response)
+
+	logger := loggerFrom(ctx)
+	logger.Info("check",
+		"result_id", id,
+		"source", source,
+		"url", req.URL,
+		"outcome", result.Outcome,
+		"status", response.StatusCode,
+		"error_code", response.ErrorCode,
+		"response_time_ms", response.ResponseTime,
+	)
+	if err := resultStore.Save(result); err != nil {
+		logger.Error("Failed to store result", "url", req.URL, "error", err)
+	}
+	return result
+}
+
+// matches reports whether result passes the query filters
+func (q ResultQuery) matches(result StoredResult) bool {
+	if q.URL != "" && result.Request.URL != q.URL {
+		return false
+	}
+	if !q.Since.IsZero() && result.Time.Before(q.Since) {
+		return false
+	}
+	if !q.Until.IsZero() && result.Time.After(q.Until) {
+		return false
+	}
+	if q.Source != "" && result.Source != q.Source {
+		return false
+	}
+	if q.MonitorID != "" && result.MonitorID != q.MonitorID {
+		return false
+	}
+	if len(q.Outcomes) > 0 {
+		for _, outcome := range q.Outcomes {
+			if result.Outcome == outcome {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+// memoryResultStore keeps the newest results in memory
+type memoryResultStore struct {
+	mu         sync.Mutex
+	entries    []StoredResult // oldest first
+	maxEntries int
+	retention  time.Duration // results older than this are dropped; 0 keeps them
+}
+
+// newMemoryResultStore creates a store keeping at most maxEntries results for up to retention
+func newMemoryResultStore(maxEntries int, retention time.Duration) *memoryResultStore {
+	return &memoryResultStore{maxEntries: maxEntries, retention: retention}
+}
+
+func (s *memoryResultStore) Save(result StoredResult) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.entries = append(s.entries, result)
+	s.pruneLocked(time.Now())
+	return nil
+}
+
+func (s *memoryResultStore) Get(id string) (StoredResult, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.pruneLocked(time.Now())
+	for i := len(s.entries) - 1; i >= 0; i-- {
+		if s.entries[i].ID == id {
+			return s.entries[i], true, nil
+		}
+	}
+	return StoredResult{}, false, nil
+}
+
+func (s *memoryResultStore) Query(q ResultQuery) ([]StoredResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.pruneLocked(time.Now())
+	matched := []StoredResult{}
+	for i := len(s.entries) - 1; i >= 0; i-- {
+		if q.Limit > 0 && len(matched) >= q.Limit {
+			break
+		}
+		if q.matches(s.entries[i]) {
+			matched = append(matched, s.entries[i])
+		}
+	}
+	return matched, nil
+}
+
+// pruneLocked drops results beyond maxEntries and results older than the retention period
+func (s *memoryResultStore) pruneLocked(now time.Time) {
+	drop := 0
+	if len(s.entries) > s.maxEntries {
+		drop = len(s.entries) - s.maxEntries
+	}
+	if s.retention > 0 {
+		cutoff := now.Add(-s.retention)
+		for drop < len(s.entries) && s.entries[drop].Time.Before(cutoff) {
+			drop++
+		}
+	}
+	if drop > 0 {
+		// Reslicing instead of copying keeps Save cheap on a full store; append moves the kept
+		// results to a new array once the capacity runs out, and clearing lets dropped results be freed
+		clear(s.entries[:drop])
+		s.entries = s.entries[drop:]
+	}
+}
+
+func (s *memoryResultStore) Close() error {
+	return nil
+}
+
+// count returns the number of kept results
+func (s *memoryResultStore) count() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.entries)
+}
+
+// snapshot returns a copy of all entries, oldest first
+func (s *memoryResultStore) snapshot() []StoredResult {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]StoredResult(nil), s.entries...)
+}
+
+// fileResultStore persists results as append-only JSON lines and serves queries from memory
+// The file is compacted to the kept results once it holds maxEntries lines that are no longer kept
+type fileResultStore struct {
+	mu     sync.Mutex
+	path   string
+	file   *os.File
+	lines  int // lines in the file, including results no longer kept
+	memory *memoryResultStore
+}
+
+// openFileResultStore opens or creates the JSONL file at path, keeping at most maxEntries results for up to retention
+func openFileResultStore(path string, maxEntries int, retention time.Duration) (*fileResultStore, error) {
+	s := &fileResultStore{path: path, memory: newMemoryResultStore(maxEntries, retention)}
+
+	if f, err := os.Open(path); err == nil {
+		scanner := bufio.NewScanner(f)
+		scanner.Buffer(make([]byte, 64*1024), maxHistoryLineBytes)
+		for scanner.Scan() {
+			s.lines++
+			var result StoredResult
+			if err := json.Unmarshal(scanner.Bytes(), &result); err != nil {
+				slog.Warn("Skipping invalid history line", "file", path, "line", s.lines, "error", err)
+				continue
+			}
+			s.memory.Save(result)
+		}
+		err := scanner.Err()
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %v", path, err)
+		}
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	if s.lines > s.memory.count() {
+		if err := s.compactLocked(); err != nil {
+			return nil, err
+		}
+		return s, nil
+	}
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	s.file = f
+	return s, nil
+}
+
+func (s *fileResultStore) Save(result StoredResult) error {
+	line, err := json.Marshal(result)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, err := s.file.Write(append(line, '\n')); err != nil {
+		return err
+	}
+	s.lines++
+	s.memory.Save(result)
+
+	if s.lines-s.memory.count() >= s.memory.maxEntries {
+		return s.compactLocked()
+	}
+	return nil
+}
+
+func (s *fileResultStore) Get(id string) (StoredResult, bool, error) {
+	return s.memory.Get(id)
+}
+
+func (s *fileResultStore) Query(q ResultQuery) ([]StoredResult, error) {
+	return s.memory.Query(q)
+}
+
+func (s *fileResultStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.file.Close()
+}
+
+// compactLocked rewrites the file with only the kept results and reopens it for appending
+func (s *fileResultStore) compactLocked() error {
+	entries := s.memory.snapshot()
+
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), ".history-*.jsonl")
+	if err != nil {
+		return err
+	}
+	writer := bufio.NewWriter(tmp)
+	encoder := json.NewEncoder(writer)
+	for _, entry := range entries {
+		if err := encoder.Encode(entry); err != nil {
+			tmp.Close()
+			os.Remove(tmp.Name())
+			return err
+		}
+	}
+	if err := writer.Flush(); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	// The old file stays open until the new one is in place, so a failed compaction
+	// leaves the store appending as before
+	if err := os.Rename(tmp.Name(), s.path); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	f, err := os.OpenFile(s.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+	if err != nil {
+		return err
+	}
+	if s.file != nil {
+		s.file.Close()
+	}
+	s.file = f
+	s.lines = len(entries)
+	return nil
+}
+
+// historyHandler handles GET /api/history
+// Filters: url, since and until (RFC 3339 or a duration ago like 1h), outcome (comma-separated),
+// source, monitorId and limit
+func historyHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	q, errMsg := parseResultQuery(r, time.Now())
+	if errMsg != "" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": errMsg})
+		return
+	}
+
+	results, err := resultStore.Query(q)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to read history"})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"results": results})
+}
+
+// parseResultQuery reads history filters from the query string
+func parseResultQuery(r *http.Request, now time.Time) (ResultQuery, string) {
+	values := r.URL.Query()
+	q := ResultQuery{
+		URL:       values.Get("url"),
+		Source:    values.Get("source"),
+		MonitorID: values.Get("monitorId"),
+		Limit:     defaultHistoryLimit,
+	}
+
+	var err error
+	if q.Since, err = parseTimeFilter(values.Get("since"), now); err != nil {
+		return q, "Invalid since: " + err.Error()
+	}
+	if q.Until, err = parseTimeFilter(values.Get("until"), now); err != nil {
+		return q, "Invalid until: " + err.Error()
+	}
+
+	for _, outcome := range splitList(values.Get("outcome")) {
+		switch outcome {
+		case outcomeOK, outcomeFail, outcomeBlocked, outcomeError:
+			q.Outcomes = append(q.Outcomes, outcome)
+		default:
+			return q, fmt.Sprintf("Invalid outcome %q (use %s, %s, %s or %s)", outcome, outcomeOK, outcomeFail, outcomeBlocked, outcomeError)
+		}
+	}
+
+	if value := values.Get("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit < 1 || limit > maxHistoryLimit {
+			return q, fmt.Sprintf("limit must be between 1 and %d", maxHistoryLimit)
+		}
+		q.Limit = limit
+	}
+	return q, ""
+}
+
+// parseTimeFilter parses an RFC 3339 time, or a duration meaning that long before now
+func parseTimeFilter(value string, now time.Time) (time.Time, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	if d, err := time.ParseDuration(value); err == nil && d >= 0 {
+		return now.Add(-d), nil
+	}
+	return time.Time{}, fmt.Errorf("expected an RFC 3339 time or a duration like 24h, got %q", value)
+}
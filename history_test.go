@@ -0,0 +1,310 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// useTestResultStore replaces the global result store for the duration of a test
+func useTestResultStore(t *testing.T, store ResultStore) {
+	t.Helper()
+	saved := resultStore
+	resultStore = store
+	t.Cleanup(func() {
+		store.Close()
+		resultStore = saved
+	})
+}
+
+// testResult builds a stored result at the given minute offset from base
+func testResult(id, url, outcome string, base time.Time, minute int) StoredResult {
+	return StoredResult{
+		ID:      id,
+		Time:    base.Add(time.Duration(minute) * time.Minute),
+		Source:  sourceTest,
+		Outcome: outcome,
+		Request: TestRequest{URL: url},
+	}
+}
+
+// countLines returns the number of lines in a file
+func countLines(t *testing.T, path string) int {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("failed to open %s: %v", path, err)
+	}
+	defer f.Close()
+	lines := 0
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), maxHistoryLineBytes)
+	for scanner.Scan() {
+		lines++
+	}
+	return lines
+}
+
+func TestResultOutcome(t *testing.T) {
+	tests := []struct {
+		name     string
+		response TestResponse
+		outcome  string
+	}{
+		{"ok", TestResponse{Success: true, StatusCode: 200}, outcomeOK},
+		{"server error", TestResponse{Success: true, StatusCode: 500}, outcomeFail},
+		{"blocked", TestResponse{Success: true, StatusCode: 403, Blocked: true}, outcomeBlocked},
+		{"expected block", TestResponse{Success: true, StatusCode: 403, Blocked: true, Verdict: verdictPass}, outcomeOK},
+		{"assertion failed", TestResponse{Success: true, StatusCode: 200, Verdict: verdictFail}, outcomeFail},
+		{"no response", TestResponse{Success: false, Verdict: verdictFail}, outcomeError},
+	}
+
+	for _, tt := range tests {
+		if got := resultOutcome(tt.response); got != tt.outcome {
+			t.Errorf("%s: expected %q, got %q", tt.name, tt.outcome, got)
+		}
+	}
+}
+
+func TestMemoryResultStore(t *testing.T) {
+	base := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	store := newMemoryResultStore(4, 0)
+	store.Save(testResult("1", "https://a.example", outcomeOK, base, 0))
+	store.Save(testResult("2", "https://b.example", outcomeFail, base, 1))
+	store.Save(testResult("3", "https://a.example", outcomeError, base, 2))
+	store.Save(testResult("4", "https://a.example", outcomeOK, base, 3))
+	store.Save(testResult("5", "https://b.example", outcomeBlocked, base, 4))
+
+	tests := []struct {
+		name  string
+		query ResultQuery
+		ids   string
+	}{
+		{"all newest first, oldest dropped", ResultQuery{}, "5,4,3,2"},
+		{"by url", ResultQuery{URL: "https://a.example"}, "4,3"},
+		{"by outcome", ResultQuery{Outcomes: []string{outcomeFail, outcomeError}}, "3,2"},
+		{"since", ResultQuery{Since: base.Add(3 * time.Minute)}, "5,4"},
+		{"until", ResultQuery{Until: base.Add(2 * time.Minute)}, "3,2"},
+		{"limit", ResultQuery{Limit: 2}, "5,4"},
+		{"no match", ResultQuery{URL: "https://c.example"}, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			results, err := store.Query(tt.query)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			var ids []string
+			for _, r := range results {
+				ids = append(ids, r.ID)
+			}
+			if got := strings.Join(ids, ","); got != tt.ids {
+				t.Errorf("expected %q, got %q", tt.ids, got)
+			}
+		})
+	}
+}
+
+func TestMemoryResultStoreFullSave(t *testing.T) {
+	base := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	store := newMemoryResultStore(1000, 0)
+	for i := 0; i < 1000; i++ {
+		store.Save(testResult(strconv.Itoa(i), "https://a.example", outcomeOK, base, 0))
+	}
+
+	// A full store does not copy its results on every save
+	result := testResult("new", "https://a.example", outcomeOK, base, 0)
+	if allocs := testing.AllocsPerRun(1000, func() { store.Save(result) }); allocs > 0.1 {
+		t.Errorf("expected saves to rarely allocate, got %.2f allocations per save", allocs)
+	}
+	if n := store.count(); n != 1000 {
+		t.Errorf("expected 1000 results, got %d", n)
+	}
+	if _, found, _ := store.Get("999"); found {
+		t.Errorf("expected the old results to be dropped")
+	}
+}
+
+func TestFileResultStore(t *testing.T) {
+	base := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	path := filepath.Join(t.TempDir(), "history.jsonl")
+
+	store, err := openFileResultStore(path, 3, 0)
+	if err != nil {
+		t.Fatalf("failed to open store: %v", err)
+	}
+	for i := 1; i <= 5; i++ {
+		if err := store.Save(testResult(fmt.Sprint(i), "https://a.example", outcomeOK, base, i)); err != nil {
+			t.Fatalf("failed to save: %v", err)
+		}
+	}
+	if lines := countLines(t, path); lines != 5 {
+		t.Errorf("expected 5 appended lines, got %d", lines)
+	}
+
+	// Reaching twice the kept results compacts the file
+	store.Save(testResult("6", "https://a.example", outcomeOK, base, 6))
+	if lines := countLines(t, path); lines != 3 {
+		t.Errorf("expected 3 lines after compaction, got %d", lines)
+	}
+	store.Save(testResult("7", "https://b.example", outcomeFail, base, 7))
+	store.Close()
+
+	// Append a broken line, then reopen
+	f, _ := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0o644)
+	f.WriteString("{not json\n")
+	f.Close()
+
+	reopened, err := openFileResultStore(path, 3, 0)
+	if err != nil {
+		t.Fatalf("failed to reopen store: %v", err)
+	}
+	defer reopened.Close()
+
+	results, _ := reopened.Query(ResultQuery{})
+	var ids []string
+	for _, r := range results {
+		ids = append(ids, r.ID)
+	}
+	if got := strings.Join(ids, ","); got != "7,6,5" {
+		t.Errorf("expected 7,6,5 after reopening, got %q", got)
+	}
+	if results[0].Outcome != outcomeFail || !results[0].Time.Equal(base.Add(7*time.Minute)) {
+		t.Errorf("unexpected result: %+v", results[0])
+	}
+	// Reopening drops the broken and no longer kept lines
+	if lines := countLines(t, path); lines != 3 {
+		t.Errorf("expected 3 lines after reopening, got %d", lines)
+	}
+	if err := reopened.Save(testResult("8", "https://a.example", outcomeOK, base, 8)); err != nil {
+		t.Errorf("failed to save after reopening: %v", err)
+	}
+}
+
+func TestFileResultStoreFailedCompaction(t *testing.T) {
+	base := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	path := filepath.Join(t.TempDir(), "history.jsonl")
+
+	store, err := openFileResultStore(path, 2, 0)
+	if err != nil {
+		t.Fatalf("failed to open store: %v", err)
+	}
+	defer store.Close()
+	for i := 1; i <= 3; i++ {
+		store.Save(testResult(fmt.Sprint(i), "https://a.example", outcomeOK, base, i))
+	}
+
+	// A directory in place of the file makes the rename fail
+	os.Remove(path)
+	if err := os.MkdirAll(filepath.Join(path, "blocker"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Save(testResult("4", "https://a.example", outcomeOK, base, 4)); err == nil {
+		t.Fatalf("expected the compaction to fail")
+	}
+
+	// Once the path is usable again the store recovers
+	os.RemoveAll(path)
+	if err := store.Save(testResult("5", "https://a.example", outcomeOK, base, 5)); err != nil {
+		t.Fatalf("expected the store to recover, got %v", err)
+	}
+	if lines := countLines(t, path); lines != 2 {
+		t.Errorf("expected 2 lines after compaction, got %d", lines)
+	}
+}
+
+func TestParseTimeFilter(t *testing.T) {
+	now := time.Date(2025, 1, 2, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		value   string
+		want    time.Time
+		wantErr bool
+	}{
+		{value: ""},
+		{value: "2025-01-01T10:00:00Z", want: time.Date(2025, 1, 1, 10, 0, 0, 0, time.UTC)},
+		{value: "24h", want: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{value: "90m", want: now.Add(-90 * time.Minute)},
+		{value: "yesterday", wantErr: true},
+		{value: "-1h", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := parseTimeFilter(tt.value, now)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("%q: expected error", tt.value)
+			}
+			continue
+		}
+		if err != nil || !got.Equal(tt.want) {
+			t.Errorf("%q: expected %v, got %v (%v)", tt.value, tt.want, got, err)
+		}
+	}
+}
+
+func TestHistoryHandler(t *testing.T) {
+	useTestResultStore(t, newMemoryResultStore(100, 0))
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/down" {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer server.Close()
+
+	// Every /api/test call is stored
+	for _, path := range []string{"/", "/down", "/"} {
+		req := httptest.NewRequest(http.MethodPost, "/api/test", strings.NewReader(`{"url": "`+server.URL+path+`"}`))
+		testURLHandler(httptest.NewRecorder(), req)
+	}
+
+	get := func(query string) (int, []StoredResult) {
+		req := httptest.NewRequest(http.MethodGet, "/api/history"+query, nil)
+		w := httptest.NewRecorder()
+		historyHandler(w, req)
+		var body struct {
+			Results []StoredResult `json:"results"`
+		}
+		json.NewDecoder(w.Body).Decode(&body)
+		return w.Code, body.Results
+	}
+
+	code, results := get("")
+	if code != http.StatusOK || len(results) != 3 {
+		t.Fatalf("expected 3 results, got %d (status %d)", len(results), code)
+	}
+	if results[0].Source != sourceTest || results[0].ID == "" || results[0].Response.StatusCode != http.StatusOK {
+		t.Errorf("unexpected newest result: %+v", results[0])
+	}
+
+	_, results = get("?outcome=fail")
+	if len(results) != 1 || results[0].Request.URL != server.URL+"/down" {
+		t.Errorf("expected the failed check, got %+v", results)
+	}
+
+	_, results = get("?url=" + server.URL + "/&limit=1&since=1h")
+	if len(results) != 1 || results[0].Outcome != outcomeOK {
+		t.Errorf("expected 1 ok result, got %+v", results)
+	}
+
+	_, results = get("?until=2000-01-01T00:00:00Z")
+	if len(results) != 0 {
+		t.Errorf("expected no results, got %d", len(results))
+	}
+
+	for _, query := range []string{"?outcome=maybe", "?limit=0", "?limit=5000", "?since=later"} {
+		if code, _ := get(query); code != http.StatusBadRequest {
+			t.Errorf("%s: expected status code 400, got %d", query, code)
+		}
+	}
+}
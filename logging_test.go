@@ -0,0 +1,155 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// logLines decodes JSON log lines
+func logLines(t *testing.T, buf *bytes.Buffer) []map[string]interface{} {
+	t.Helper()
+	var lines []map[string]interface{}
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		if line == "" {
+			continue
+		}
+		var entry map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			t.Fatalf("invalid log line %q: %v", line, err)
+		}
+		lines = append(lines, entry)
+	}
+	return lines
+}
+
+func TestNewLogger(t *testing.T) {
+	tests := []struct {
+		name    string
+		format  string
+		level   string
+		wantErr bool
+		check   func(string) bool
+	}{
+		{"json info", "json", "info", false, func(out string) bool {
+			return strings.Contains(out, `"msg":"shown"`) && !strings.Contains(out, "hidden")
+		}},
+		{"text debug", "TEXT", "debug", false, func(out string) bool {
+			return strings.Contains(out, "msg=shown") && strings.Contains(out, "msg=hidden")
+		}},
+		{"warn", "json", "WARN", false, func(out string) bool { return out == "" }},
+		{"invalid format", "xml", "info", true, nil},
+		{"invalid level", "json", "loud", true, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			logger, err := newLogger(&buf, tt.format, tt.level)
+			if tt.wantErr {
+				if err == nil {
+					t.Error("expected error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			logger.Info("shown")
+			logger.Debug("hidden")
+			if !tt.check(buf.String()) {
+				t.Errorf("unexpected output %q", buf.String())
+			}
+		})
+	}
+}
+
+func TestValidRequestID(t *testing.T) {
+	tests := []struct {
+		id    string
+		valid bool
+	}{
+		{"abc-123_X.y:z", true},
+		{"", false},
+		{"has space", false},
+		{"line\nbreak", false},
+		{strings.Repeat("a", maxRequestIDLength), true},
+		{strings.Repeat("a", maxRequestIDLength+1), false},
+	}
+	for _, tt := range tests {
+		if got := validRequestID(tt.id); got != tt.valid {
+			t.Errorf("validRequestID(%q) = %v, want %v", tt.id, got, tt.valid)
+		}
+	}
+}
+
+func TestLogRequests(t *testing.T) {
+	useTestResultStore(t, newMemoryResultStore(10, 0))
+	useTestMetrics(t)
+
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	defer target.Close()
+
+	var buf bytes.Buffer
+	logger, _ := newLogger(&buf, logFormatJSON, "info")
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/test", testURLHandler)
+	mux.HandleFunc("/health", healthHandler)
+	handler := logRequests(logger, mux)
+
+	t.Run("propagates request ID into check logs", func(t *testing.T) {
+		buf.Reset()
+		req := httptest.NewRequest(http.MethodPost, "/api/test", strings.NewReader(`{"url":"`+target.URL+`"}`))
+		req.Header.Set(requestIDHeader, "req-42")
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+
+		if got := w.Header().Get(requestIDHeader); got != "req-42" {
+			t.Errorf("expected request ID header req-42, got %q", got)
+		}
+		lines := logLines(t, &buf)
+		if len(lines) != 2 {
+			t.Fatalf("expected check and access lines, got %v", lines)
+		}
+		check, access := lines[0], lines[1]
+		if check["msg"] != "check" || check["request_id"] != "req-42" || check["url"] != target.URL || check["outcome"] != outcomeOK {
+			t.Errorf("unexpected check line %v", check)
+		}
+		if access["msg"] != "request" || access["request_id"] != "req-42" || access["method"] != "POST" ||
+			access["path"] != "/api/test" || access["status"] != float64(200) || access["bytes"].(float64) <= 0 {
+			t.Errorf("unexpected access line %v", access)
+		}
+	})
+
+	t.Run("generates request ID", func(t *testing.T) {
+		buf.Reset()
+		req := httptest.NewRequest(http.MethodGet, "/health", nil)
+		req.Header.Set(requestIDHeader, "not valid!")
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+
+		id := w.Header().Get(requestIDHeader)
+		if len(id) != 32 {
+			t.Errorf("expected generated request ID, got %q", id)
+		}
+		lines := logLines(t, &buf)
+		if len(lines) != 1 || lines[0]["request_id"] != id || lines[0]["status"] != float64(200) {
+			t.Errorf("unexpected access lines %v", lines)
+		}
+	})
+
+	t.Run("logs error status", func(t *testing.T) {
+		buf.Reset()
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/missing", nil))
+		lines := logLines(t, &buf)
+		if len(lines) != 1 || lines[0]["status"] != float64(404) || lines[0]["level"] != "INFO" {
+			t.Errorf("unexpected access lines %v", lines)
+		}
+	})
+}
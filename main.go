@@ -1,12 +1,13 @@
 package main
 
 import (
+	"context"
 	"crypto/tls"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
-	"log"
-	"net"
+	"log/slog"
 	"net/http"
 	"net/url"
 	"os"
@@ -21,9 +22,42 @@ var (
 	ipMutex        sync.RWMutex
 )
 
+// defaultUserAgent is sent with every test request unless overridden by the client
+const defaultUserAgent = "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36"
+
+// allowedMethods lists the HTTP methods a test request may use
+var allowedMethods = map[string]bool{
+	http.MethodGet:     true,
+	http.MethodHead:    true,
+	http.MethodPost:    true,
+	http.MethodPut:     true,
+	http.MethodPatch:   true,
+	http.MethodDelete:  true,
+	http.MethodOptions: true,
+}
+
 // TestRequest represents a URL test request from the client
 type TestRequest struct {
-	URL string `json:"url"`
+	URL     string            `json:"url"`
+	Method  string            `json:"method,omitempty"`  // defaults to GET
+	Headers map[string]string `json:"headers,omitempty"` // overrides default headers such as User-Agent
+	Body    string            `json:"body,omitempty"`
+
+	// Redirect policy
+	FollowRedirects *bool `json:"followRedirects,omitempty"` // defaults to true
+	MaxRedirects    int   `json:"maxRedirects,omitempty"`    // defaults to 10
+	SameHostOnly    bool  `json:"sameHostOnly,omitempty"`    // reject redirects to another host
+	NoDowngrade     bool  `json:"noDowngrade,omitempty"`     // reject https -> http redirects
+
+	// Insecure retries without certificate verification when the certificate is
+	// rejected, and reports every verification problem in the TLS section
+	Insecure bool `json:"insecure,omitempty"`
+
+	// Resolve pins hosts to addresses like curl --resolve, e.g. "example.com:443:203.0.113.10"
+	Resolve []string `json:"resolve,omitempty"`
+
+	// Assert declares expectations checked against the response
+	Assert *Assertions `json:"assert,omitempty"`
 }
 
 // TestResponse represents the result of a URL test
@@ -35,10 +69,45 @@ type TestResponse struct {
 	Headers      map[string]string `json:"headers,omitempty"`
 	BodyPreview  string            `json:"bodyPreview,omitempty"`
 	Truncated    bool              `json:"truncated"`
+	BodySize     int               `json:"bodySize,omitempty"` // bytes of the full decoded body
+	BodyHash     string            `json:"bodyHash,omitempty"` // SHA-256 of the full decoded body, hex
 	Error        string            `json:"error,omitempty"`
+	ErrorCode    string            `json:"errorCode,omitempty"`  // machine-readable error class, e.g. dns_not_found
+	ErrorPhase   string            `json:"errorPhase,omitempty"` // dns, connect, tls, redirect, policy, request or response
 	Blocked      bool              `json:"blocked"`
-	UserIP       string            `json:"userIP,omitempty"`
-	ServerIP     string            `json:"serverIP,omitempty"`
+	// BlockReason, BlockVendor and BlockConfidence explain why a response looks blocked
+	BlockReason     string         `json:"blockReason,omitempty"`     // challenge, captcha, access_denied or rate_limited
+	BlockVendor     string         `json:"blockVendor,omitempty"`     // e.g. cloudflare, akamai, datadome
+	BlockConfidence string         `json:"blockConfidence,omitempty"` // high, medium or low
+	BlockSignature  string         `json:"blockSignature,omitempty"`  // name of the matching signature, see GET /api/signatures
+	BlockEvidence   []string       `json:"blockEvidence,omitempty"`   // the status, headers, cookies and body markers that matched
+	RateLimit       *RateLimit     `json:"rateLimit,omitempty"`       // from Retry-After and RateLimit-*/X-RateLimit-* headers
+	UserIP          string         `json:"userIP,omitempty"`
+	ServerIP        string         `json:"serverIP,omitempty"`
+	Timings         []PhaseTimings `json:"timings,omitempty"` // one entry per hop
+	Redirects       []RedirectHop  `json:"redirects,omitempty"`
+	// RedirectViolation is set when a redirect broke the request's redirect policy
+	RedirectViolation string   `json:"redirectViolation,omitempty"`
+	TLS               *TLSInfo `json:"tls,omitempty"`
+	// BlockedByPolicy is set when the destination (or a redirect target) is not allowed by the SSRF policy
+	BlockedByPolicy bool `json:"blockedByPolicy,omitempty"`
+	// ID identifies the stored result, see /api/results/{id}
+	ID        string `json:"id,omitempty"`
+	Permalink string `json:"permalink,omitempty"` // path of the shareable result page
+	// Assertions and Verdict are set when the request declares assertions
+	Assertions []AssertionResult `json:"assertions,omitempty"`
+	Verdict    string            `json:"verdict,omitempty"` // pass or fail
+	// Commands reproduce the test with curl, Go or Python
+	Commands *Commands `json:"commands,omitempty"`
+}
+
+// RedirectHop represents one redirect response on the way to the final URL
+type RedirectHop struct {
+	URL        string            `json:"url"`
+	StatusCode int               `json:"statusCode"`
+	Location   string            `json:"location"`
+	Headers    map[string]string `json:"headers,omitempty"`
+	Timing     PhaseTimings      `json:"timing"`
 }
 
 // validateURL checks if a URL is valid
@@ -73,19 +142,151 @@ func validateURL(urlStr string) string {
 	return ""
 }
 
+// validateRequest checks the URL, method and headers of a test request
+// Returns an error message if the request is invalid, or empty string if valid
+func validateRequest(req TestRequest) string {
+	if msg := validateURL(req.URL); msg != "" {
+		return msg
+	}
+
+	// Check if method is supported
+	if req.Method != "" && !allowedMethods[strings.ToUpper(req.Method)] {
+		return "Unsupported HTTP method: " + req.Method
+	}
+
+	// Check header names and values so they cannot break the request line
+	for name, value := range req.Headers {
+		if !isValidHeaderName(name) {
+			return "Invalid header name: " + name
+		}
+		if strings.ContainsAny(value, "\r\n\x00") {
+			return "Invalid value for header " + name
+		}
+	}
+
+	if msg := validateRedirectPolicy(req); msg != "" {
+		return msg
+	}
+
+	if msg := validateResolve(req.Resolve); msg != "" {
+		return msg
+	}
+
+	return validateAssertions(req.Assert)
+}
+
+// isValidHeaderName reports whether name is a valid HTTP header field name (RFC 7230 token)
+func isValidHeaderName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for _, c := range name {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		case strings.ContainsRune("!#$%&'*+-.^_`|~", c):
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// requestMethod returns the normalized HTTP method for a test request
+func requestMethod(req TestRequest) string {
+	if req.Method == "" {
+		return http.MethodGet
+	}
+	return strings.ToUpper(req.Method)
+}
+
 func main() {
+	// Set up structured logging; the check command prints its own report, so by
+	// default it only logs warnings
+	checkMode := len(os.Args) > 1 && os.Args[1] == "check"
+	format, level := logFormatJSON, "info"
+	if checkMode {
+		format, level = logFormatText, "warn"
+	}
+	logger, err := loadLogger(os.Stderr, format, level)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid logging configuration: %v\n", err)
+		os.Exit(1)
+	}
+	slog.SetDefault(logger)
+
+	// Load SSRF policy for outgoing test connections
+	loadedPolicy, err := loadNetworkPolicy()
+	if err != nil {
+		fatal("Invalid SSRF policy", "error", err)
+	}
+	destinationPolicy = loadedPolicy
+
+	// Load block signatures; a SIGNATURES_FILE extends or replaces the built-in ones
+	signaturesFile := os.Getenv("SIGNATURES_FILE")
+	if signaturesFile != "" {
+		if err := signatures.setFile(signaturesFile); err != nil {
+			fatal("Failed to load signatures", "file", signaturesFile, "error", err)
+		}
+	}
+
+	// Command-line mode: url-checker check <url> [flags]
+	if checkMode {
+		os.Exit(runCheck(os.Args[2:], os.Stdout, os.Stderr))
+	}
+
+	// Open result history
+	retention, err := loadResultRetention()
+	if err != nil {
+		fatal("Invalid RESULT_RETENTION", "error", err)
+	}
+	if file := os.Getenv("HISTORY_FILE"); file != "" {
+		store, err := openFileResultStore(file, maxHistoryEntries, retention)
+		if err != nil {
+			fatal("Failed to open history file", "file", file, "error", err)
+		}
+		resultStore = store
+	} else {
+		resultStore = newMemoryResultStore(maxHistoryEntries, retention)
+	}
+	redactedHeaders = loadRedactedHeaders()
+
+	// Load and start saved monitors
+	if file := os.Getenv("MONITORS_FILE"); file != "" {
+		if err := monitors.load(file); err != nil {
+			fatal("Failed to load monitors", "file", file, "error", err)
+		}
+	}
+
+	// Pick up changes to the signatures file without a restart
+	if signaturesFile != "" {
+		go signatures.watch()
+	}
+
 	// Fetch server IP on startup (in background to not block startup)
 	go func() {
 		ip := fetchServerIP()
 		ipMutex.Lock()
 		cachedServerIP = ip
 		ipMutex.Unlock()
-		log.Printf("Server IP: %s", ip)
+		slog.Info("Server IP", "ip", ip)
 	}()
 
 	// Set up routes
 	http.HandleFunc("/", serveStaticHandler)
 	http.HandleFunc("/api/test", testURLHandler)
+	http.HandleFunc("/api/parse-curl", parseCurlHandler)
+	http.HandleFunc("/api/batch", batchHandler)
+	http.HandleFunc("/api/batch/", batchEventsHandler)
+	http.HandleFunc("/api/matrix", matrixHandler)
+	http.HandleFunc("/api/profiles", profilesHandler)
+	http.HandleFunc("/api/diff", diffHandler)
+	http.HandleFunc("/api/monitors", monitorsHandler)
+	http.HandleFunc("/api/monitors/", monitorHandler)
+	http.HandleFunc("/api/history", historyHandler)
+	http.HandleFunc("/api/results/", resultHandler)
+	http.HandleFunc("/api/signatures", signaturesHandler)
+	http.HandleFunc("/r/", permalinkHandler)
+	http.HandleFunc("/metrics", metricsHandler)
 	http.HandleFunc("/health", healthHandler)
 
 	// Get PORT from environment variable, default to 8080
@@ -94,12 +295,12 @@ func main() {
 		port = "8080"
 	}
 
-	// Log startup message to stdout
-	log.Printf("URL Tester starting on port %s", port)
+	// Log startup message
+	slog.Info("URL Tester starting", "port", port)
 
-	// Start HTTP server
-	if err := http.ListenAndServe(":"+port, nil); err != nil {
-		log.Fatalf("Server failed to start: %v", err)
+	// Start HTTP server; every request gets an ID and an access log line
+	if err := http.ListenAndServe(":"+port, logRequests(logger, http.DefaultServeMux)); err != nil {
+		fatal("Server failed to start", "error", err)
 	}
 }
 
@@ -125,23 +326,35 @@ func serveStaticHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 // testURLHandler handles POST /api/test requests
+// With ?format=har the test is returned as a HAR document for download
 func testURLHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
+	format := r.URL.Query().Get("format")
+	if format != "" && format != "json" && format != "har" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "format must be json or har"})
+		return
+	}
+
 	// Parse JSON request
-	var req TestRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+	var body testRequestBody
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusBadRequest)
 		json.NewEncoder(w).Encode(map[string]string{"error": "Invalid JSON"})
 		return
 	}
+	req, err := body.request()
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid curl command: " + err.Error()})
+		return
+	}
 
-	// Validate URL
-	if validationErr := validateURL(req.URL); validationErr != "" {
+	// Validate request
+	if validationErr := validateRequest(req); validationErr != "" {
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusBadRequest)
 		json.NewEncoder(w).Encode(map[string]string{"error": validationErr})
@@ -149,110 +362,141 @@ func testURLHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Test the URL
-	response := testURL(req.URL)
+	var response TestResponse
+	var har *HAR
+	if format == "har" {
+		response, har = testURLHAR(r.Context(), req)
+	} else {
+		response = testURLContext(r.Context(), req)
+	}
 
 	// Add user IP and server IP to response
 	response.UserIP = getClientIP(r)
 	response.ServerIP = getServerIP()
 
+	// Keep the result in history; its ID makes it shareable
+	stored := recordResult(r.Context(), sourceTest, "", req, response)
+	response = stored.Response
+	response.Permalink = "/r/" + stored.ID
+
+	if har != nil {
+		har.Log.Comment = strings.TrimSpace("Result " + response.Permalink + ". " + har.Log.Comment)
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", harFilename(req.URL, time.Now())))
+		writeJSON(w, http.StatusOK, har)
+		return
+	}
+
 	// Return JSON response
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(response)
 }
 
+// newTransport creates a fresh transport so every test measures DNS, connect and TLS from scratch
+// Connections go through the SSRF guard and never through an environment proxy, which would bypass it
+// resolve pins hosts to addresses, see resolveOverride
+func newTransport(resolve []string) *http.Transport {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = resolvingDialContext(guardedDialer().DialContext, resolve)
+	return transport
+}
+
 // createHTTPClient creates a custom HTTP client with 30-second timeout
-func createHTTPClient() *http.Client {
+// checkRedirect may be nil to use the net/http default policy
+func createHTTPClient(transport http.RoundTripper, checkRedirect func(req *http.Request, via []*http.Request) error) *http.Client {
 	return &http.Client{
-		Timeout: 30 * time.Second,
-		CheckRedirect: func(req *http.Request, via []*http.Request) error {
-			// Allow redirects by returning nil
-			return nil
-		},
+		Transport:     transport,
+		Timeout:       30 * time.Second,
+		CheckRedirect: checkRedirect,
 	}
 }
 
-// formatError formats an error message for display to the user
-func formatError(err error) string {
-	if err == nil {
-		return ""
-	}
-
-	// Check for timeout error
-	if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
-		return "timeout: request exceeded 30 seconds"
-	}
-
-	// Check for SSL/TLS errors
-	if _, ok := err.(*tls.CertificateVerificationError); ok {
-		return "SSL/TLS error: certificate verification failed"
-	}
-
-	// Check for other SSL/TLS errors
-	if _, ok := err.(tls.RecordHeaderError); ok {
-		return "SSL/TLS error: invalid certificate or protocol error"
-	}
-
-	// Check for DNS errors
-	if dnsErr, ok := err.(*net.DNSError); ok {
-		if dnsErr.IsNotFound {
-			return fmt.Sprintf("DNS error: host not found (%s)", dnsErr.Name)
-		}
-		return fmt.Sprintf("DNS error: %s", dnsErr.Err)
-	}
+// testURL sends an HTTP request to the target URL and returns the result
+func testURL(testReq TestRequest) TestResponse {
+	return testURLContext(context.Background(), testReq)
+}
 
-	// Check for connection errors
-	if opErr, ok := err.(*net.OpError); ok {
-		if opErr.Op == "dial" {
-			if syscallErr, ok := opErr.Err.(interface{ Error() string }); ok {
-				return fmt.Sprintf("connection error: %s", syscallErr.Error())
-			}
-			return "connection error: failed to connect to host"
-		}
-	}
+// testURLContext is testURL logging with the logger of ctx
+func testURLContext(ctx context.Context, testReq TestRequest) TestResponse {
+	response, _, _ := runTest(ctx, testReq)
+	return response
+}
 
-	// Generic error message
-	errStr := err.Error()
-	// Truncate very long error messages
-	if len(errStr) > 200 {
-		errStr = errStr[:200] + "..."
-	}
-	return errStr
+// testURLHAR is testURLContext that also returns the test as a HAR document
+func testURLHAR(ctx context.Context, testReq TestRequest) (TestResponse, *HAR) {
+	response, tracer, body := runTest(ctx, testReq)
+	return response, buildHAR(testReq, response, tracer, body)
 }
 
-// testURL sends an HTTP request to the target URL and returns the result
-func testURL(targetURL string) TestResponse {
-	client := createHTTPClient()
+// runTest runs a test and also returns its trace and full response body
+func runTest(ctx context.Context, testReq TestRequest) (TestResponse, *tracingTransport, []byte) {
+	metrics.inFlight.Add(1)
+	defer metrics.inFlight.Add(-1)
+
+	logger := loggerFrom(ctx).With("url", testReq.URL)
+	transport := newTransport(testReq.Resolve)
+	defer transport.CloseIdleConnections()
+	tracer := newTracingTransport(transport)
+	client := createHTTPClient(tracer, redirectPolicy(testReq))
 
 	// Create request
-	req, err := http.NewRequest(http.MethodGet, targetURL, nil)
+	req, err := newTestHTTPRequest(ctx, testReq)
 	if err != nil {
-		errMsg := formatError(err)
-		fmt.Fprintf(os.Stderr, "Error creating request for URL %s: %v\n", targetURL, err)
+		logger.Warn("Error creating request", "error", err)
 		return TestResponse{
-			Success: false,
-			Error:   errMsg,
-			Blocked: false,
-		}
+			Success:    false,
+			Error:      "invalid request: " + err.Error(),
+			ErrorCode:  "invalid_request",
+			ErrorPhase: phaseRequest,
+			Blocked:    false,
+		}, tracer, nil
 	}
 
-	// Set User-Agent header
-	req.Header.Set("User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36")
-
 	// Record start time
 	startTime := time.Now()
 
 	// Send request
 	resp, err := client.Do(req)
+
+	// In insecure mode, retry without certificate verification so the response can
+	// still be inspected; verification problems are reported in the TLS section
+	verificationSkipped := false
+	if err != nil && testReq.Insecure && isCertificateError(err) {
+		logger.Info("Certificate verification failed, retrying without verification", "error", err)
+		insecureTransport := newTransport(testReq.Resolve)
+		insecureTransport.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+		defer insecureTransport.CloseIdleConnections()
+		tracer = newTracingTransport(insecureTransport)
+		client = createHTTPClient(tracer, redirectPolicy(testReq))
+		verificationSkipped = true
+
+		if req, err = newTestHTTPRequest(ctx, testReq); err == nil {
+			startTime = time.Now()
+			resp, err = client.Do(req)
+		}
+	}
+
 	if err != nil {
-		// Log error to stderr
-		errMsg := formatError(err)
-		fmt.Fprintf(os.Stderr, "Error testing URL %s: %v\n", targetURL, err)
-		return TestResponse{
-			Success: false,
-			Error:   errMsg,
-			Blocked: false,
+		errInfo := classifyError(err)
+		logger.Warn("Error testing URL", "error", err, "error_code", errInfo.Code)
+		response := TestResponse{
+			Success:    false,
+			Error:      errInfo.Message,
+			ErrorCode:  errInfo.Code,
+			ErrorPhase: errInfo.Phase,
+			Blocked:    false,
+			Timings:    tracer.timings(),
+			Redirects:  tracer.redirects(false),
 		}
+		var redirectErr *redirectError
+		if errors.As(err, &redirectErr) {
+			response.RedirectViolation = redirectErr.Reason
+		}
+		var policyErr *policyError
+		response.BlockedByPolicy = errors.As(err, &policyErr)
+		applyAssertions(&response, testReq.Assert, nil)
+		return response, tracer, nil
 	}
 	defer resp.Body.Close()
 
@@ -260,24 +504,34 @@ func testURL(targetURL string) TestResponse {
 	responseTime := time.Since(startTime).Milliseconds()
 
 	// Extract headers
-	headers := make(map[string]string)
-	for key, values := range resp.Header {
-		if len(values) > 0 {
-			headers[key] = values[0]
-		}
+	headers := firstHeaderValues(resp.Header)
+
+	// Inspect TLS connection
+	tlsInfo := buildTLSInfo(resp.TLS)
+	if tlsInfo != nil && testReq.Insecure {
+		tlsInfo.VerificationSkipped = verificationSkipped
+		tlsInfo.Problems = verifyCertificateChain(resp.TLS.PeerCertificates, resp.Request.URL.Hostname(), time.Now())
 	}
 
 	// Read response body (limited to 1000 characters)
+	transferStart := time.Now()
 	bodyBytes, err := io.ReadAll(resp.Body)
+	tracer.finishTransfer(time.Since(transferStart))
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error reading response body for %s: %v\n", targetURL, err)
-		return TestResponse{
+		logger.Warn("Error reading response body", "error", err)
+		response := TestResponse{
 			Success:    true,
 			StatusCode: resp.StatusCode,
 			FinalURL:   resp.Request.URL.String(),
 			Headers:    headers,
-			Blocked:    isBlocked(resp.StatusCode),
+			Timings:    tracer.timings(),
+			Redirects:  tracer.redirects(true),
+			TLS:        tlsInfo,
 		}
+		response.RateLimit = parseRateLimit(resp.StatusCode, resp.Header, time.Now())
+		applyBlockDetection(&response, detectBlock(resp.StatusCode, resp.Header, bodyBytes))
+		applyAssertions(&response, testReq.Assert, bodyBytes)
+		return response, tracer, bodyBytes
 	}
 
 	bodyStr := string(bodyBytes)
@@ -290,10 +544,7 @@ func testURL(targetURL string) TestResponse {
 		truncated = true
 	}
 
-	// Check if blocked
-	blocked := isBlocked(resp.StatusCode)
-
-	return TestResponse{
+	response := TestResponse{
 		Success:      true,
 		StatusCode:   resp.StatusCode,
 		ResponseTime: responseTime,
@@ -301,11 +552,57 @@ func testURL(targetURL string) TestResponse {
 		Headers:      headers,
 		BodyPreview:  bodyPreview,
 		Truncated:    truncated,
-		Blocked:      blocked,
+		BodySize:     len(bodyBytes),
+		BodyHash:     bodyHash(bodyBytes),
+		Timings:      tracer.timings(),
+		Redirects:    tracer.redirects(true),
+		TLS:          tlsInfo,
+	}
+
+	response.RateLimit = parseRateLimit(resp.StatusCode, resp.Header, time.Now())
+
+	// Inspect and evaluate assertions on the full body, not the preview
+	applyBlockDetection(&response, detectBlock(resp.StatusCode, resp.Header, bodyBytes))
+	applyAssertions(&response, testReq.Assert, bodyBytes)
+	return response, tracer, bodyBytes
+}
+
+// newTestHTTPRequest builds the outgoing HTTP request for a test request, canceled with ctx
+func newTestHTTPRequest(ctx context.Context, testReq TestRequest) (*http.Request, error) {
+	var body io.Reader
+	if testReq.Body != "" {
+		body = strings.NewReader(testReq.Body)
+	}
+	req, err := http.NewRequestWithContext(ctx, requestMethod(testReq), testReq.URL, body)
+	if err != nil {
+		return nil, err
+	}
+
+	// Set User-Agent header, then apply client headers on top
+	req.Header.Set("User-Agent", defaultUserAgent)
+	for name, value := range testReq.Headers {
+		// Host is not a regular header in net/http
+		if strings.EqualFold(name, "Host") {
+			req.Host = value
+			continue
+		}
+		req.Header.Set(name, value)
+	}
+	return req, nil
+}
+
+// firstHeaderValues flattens headers to the first value of each header
+func firstHeaderValues(header http.Header) map[string]string {
+	headers := make(map[string]string)
+	for key, values := range header {
+		if len(values) > 0 {
+			headers[key] = values[0]
+		}
 	}
+	return headers
 }
 
-// isBlocked checks if the response indicates the request was blocked
+// isBlocked checks if the status code alone indicates the request was blocked
 func isBlocked(statusCode int) bool {
 	return statusCode == 403 || statusCode == 429
 }
@@ -342,14 +639,14 @@ func fetchServerIP() string {
 	}
 	resp, err := client.Get("https://ipinfo.io/ip")
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error getting server IP: %v\n", err)
+		slog.Warn("Error getting server IP", "error", err)
 		return "unknown"
 	}
 	defer resp.Body.Close()
 
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error reading server IP response: %v\n", err)
+		slog.Warn("Error reading server IP response", "error", err)
 		return "unknown"
 	}
 
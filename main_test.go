@@ -2,12 +2,20 @@ package main
 
 import (
 	"encoding/json"
+	"io"
 	"net/http"
 	"net/http/httptest"
+	"os"
 	"strings"
 	"testing"
 )
 
+func TestMain(m *testing.M) {
+	// Test servers listen on loopback, which the default SSRF policy blocks
+	destinationPolicy = mustNetworkPolicy([]string{"127.0.0.1", "::1"}, defaultDeniedCIDRs)
+	os.Exit(m.Run())
+}
+
 func TestValidateURL(t *testing.T) {
 	tests := []struct {
 		name        string
@@ -92,6 +100,57 @@ func TestValidateURL(t *testing.T) {
 	}
 }
 
+func TestValidateRequest(t *testing.T) {
+	tests := []struct {
+		name     string
+		req      TestRequest
+		errorMsg string
+	}{
+		{
+			name: "URL only",
+			req:  TestRequest{URL: "https://example.com"},
+		},
+		{
+			name: "lowercase method with headers and body",
+			req: TestRequest{
+				URL:     "https://example.com",
+				Method:  "post",
+				Headers: map[string]string{"Authorization": "Bearer token", "Content-Type": "application/json"},
+				Body:    `{"foo":"bar"}`,
+			},
+		},
+		{
+			name:     "invalid URL",
+			req:      TestRequest{URL: ""},
+			errorMsg: "URL is required",
+		},
+		{
+			name:     "unsupported method",
+			req:      TestRequest{URL: "https://example.com", Method: "TRACE"},
+			errorMsg: "Unsupported HTTP method: TRACE",
+		},
+		{
+			name:     "invalid header name",
+			req:      TestRequest{URL: "https://example.com", Headers: map[string]string{"Bad Header": "x"}},
+			errorMsg: "Invalid header name: Bad Header",
+		},
+		{
+			name:     "header value with newline",
+			req:      TestRequest{URL: "https://example.com", Headers: map[string]string{"X-Test": "a\r\nX-Injected: b"}},
+			errorMsg: "Invalid value for header X-Test",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := validateRequest(tt.req)
+			if result != tt.errorMsg {
+				t.Errorf("expected error message %q, got %q", tt.errorMsg, result)
+			}
+		})
+	}
+}
+
 func TestIsBlocked(t *testing.T) {
 	tests := []struct {
 		name       string
@@ -145,7 +204,7 @@ func TestTestURL(t *testing.T) {
 		}))
 		defer server.Close()
 
-		response := testURL(server.URL)
+		response := testURL(TestRequest{URL: server.URL})
 
 		if !response.Success {
 			t.Errorf("expected success, got failure: %s", response.Error)
@@ -174,7 +233,7 @@ func TestTestURL(t *testing.T) {
 		}))
 		defer server.Close()
 
-		response := testURL(server.URL)
+		response := testURL(TestRequest{URL: server.URL})
 
 		if !response.Success {
 			t.Errorf("expected success, got failure: %s", response.Error)
@@ -194,7 +253,7 @@ func TestTestURL(t *testing.T) {
 		}))
 		defer server.Close()
 
-		response := testURL(server.URL)
+		response := testURL(TestRequest{URL: server.URL})
 
 		if !response.Success {
 			t.Errorf("expected success, got failure: %s", response.Error)
@@ -220,7 +279,7 @@ func TestTestURL(t *testing.T) {
 		}))
 		defer server.Close()
 
-		response := testURL(server.URL)
+		response := testURL(TestRequest{URL: server.URL})
 
 		if !response.Success {
 			t.Errorf("expected success, got failure: %s", response.Error)
@@ -242,7 +301,7 @@ func TestTestURL(t *testing.T) {
 		}))
 		defer server.Close()
 
-		testURL(server.URL)
+		testURL(TestRequest{URL: server.URL})
 
 		if userAgent == "" {
 			t.Errorf("expected User-Agent header to be set")
@@ -252,6 +311,76 @@ func TestTestURL(t *testing.T) {
 		}
 	})
 
+	// Test custom method, headers and body
+	t.Run("custom method headers and body", func(t *testing.T) {
+		var method, auth, userAgent, host, body string
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			method = r.Method
+			auth = r.Header.Get("Authorization")
+			userAgent = r.Header.Get("User-Agent")
+			host = r.Host
+			data, _ := io.ReadAll(r.Body)
+			body = string(data)
+			w.WriteHeader(http.StatusCreated)
+		}))
+		defer server.Close()
+
+		response := testURL(TestRequest{
+			URL:    server.URL,
+			Method: "put",
+			Headers: map[string]string{
+				"Authorization": "Bearer secret",
+				"user-agent":    "custom-agent/1.0",
+				"Host":          "virtual.example.com",
+			},
+			Body: `{"name":"test"}`,
+		})
+
+		if !response.Success {
+			t.Errorf("expected success, got failure: %s", response.Error)
+		}
+		if response.StatusCode != 201 {
+			t.Errorf("expected status code 201, got %d", response.StatusCode)
+		}
+		if method != http.MethodPut {
+			t.Errorf("expected method PUT, got %q", method)
+		}
+		if auth != "Bearer secret" {
+			t.Errorf("expected Authorization header to be forwarded, got %q", auth)
+		}
+		if userAgent != "custom-agent/1.0" {
+			t.Errorf("expected User-Agent override, got %q", userAgent)
+		}
+		if host != "virtual.example.com" {
+			t.Errorf("expected Host override, got %q", host)
+		}
+		if body != `{"name":"test"}` {
+			t.Errorf("expected request body to be forwarded, got %q", body)
+		}
+	})
+
+	// Test HEAD request
+	t.Run("head request", func(t *testing.T) {
+		var method string
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			method = r.Method
+			w.Write([]byte("ignored for HEAD"))
+		}))
+		defer server.Close()
+
+		response := testURL(TestRequest{URL: server.URL, Method: http.MethodHead})
+
+		if !response.Success {
+			t.Errorf("expected success, got failure: %s", response.Error)
+		}
+		if method != http.MethodHead {
+			t.Errorf("expected method HEAD, got %q", method)
+		}
+		if response.BodyPreview != "" {
+			t.Errorf("expected empty body preview for HEAD, got %q", response.BodyPreview)
+		}
+	})
+
 	// Test redirect tracking
 	t.Run("redirect tracking", func(t *testing.T) {
 		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -264,7 +393,7 @@ func TestTestURL(t *testing.T) {
 		}))
 		defer server.Close()
 
-		response := testURL(server.URL + "/redirect")
+		response := testURL(TestRequest{URL: server.URL + "/redirect"})
 
 		if !response.Success {
 			t.Errorf("expected success, got failure: %s", response.Error)
@@ -276,7 +405,7 @@ func TestTestURL(t *testing.T) {
 
 	// Test invalid URL
 	t.Run("invalid URL", func(t *testing.T) {
-		response := testURL("http://invalid.example.test.invalid.local")
+		response := testURL(TestRequest{URL: "http://invalid.example.test.invalid.local"})
 
 		if response.Success {
 			t.Errorf("expected failure for invalid URL")
@@ -371,6 +500,29 @@ func TestTestURLHandler(t *testing.T) {
 		}
 	})
 
+	// Test validation error (unsupported method)
+	t.Run("validation error - unsupported method", func(t *testing.T) {
+		reqBody := `{"url":"https://example.com","method":"CONNECT"}`
+		req := httptest.NewRequest(http.MethodPost, "/api/test", strings.NewReader(reqBody))
+		req.Header.Set("Content-Type", "application/json")
+
+		w := httptest.NewRecorder()
+		testURLHandler(w, req)
+
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("expected status code 400, got %d", w.Code)
+		}
+
+		var errResponse map[string]string
+		if err := json.NewDecoder(w.Body).Decode(&errResponse); err != nil {
+			t.Errorf("failed to decode error response: %v", err)
+		}
+
+		if errResponse["error"] != "Unsupported HTTP method: CONNECT" {
+			t.Errorf("expected unsupported method error, got %q", errResponse["error"])
+		}
+	})
+
 	// Test invalid JSON
 	t.Run("invalid JSON", func(t *testing.T) {
 		reqBody := `{invalid json}`
@@ -0,0 +1,344 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Matrix limits
+const (
+	maxMatrixProfiles  = 20
+	matrixConcurrency  = 3 // profiles tested at once; more would look like a burst to the site
+	maxMatrixBodyBytes = 1 << 20
+)
+
+// UserAgentProfile is a named set of headers that identifies a client
+type UserAgentProfile struct {
+	Name        string            `json:"name"`
+	Description string            `json:"description,omitempty"`
+	Headers     map[string]string `json:"headers"`
+}
+
+// builtinProfiles are the profiles available to every matrix request
+// Browser profiles send the headers of a top-level navigation. Accept-Encoding is left to the
+// transport, so every profile's body is decoded and hashed the same way.
+var builtinProfiles = []UserAgentProfile{
+	{
+		Name:        "default",
+		Description: "What /api/test sends",
+		Headers:     map[string]string{"User-Agent": defaultUserAgent},
+	},
+	{
+		Name:        "chrome",
+		Description: "Chrome 131 on Windows",
+		Headers: map[string]string{
+			"User-Agent":                "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/131.0.0.0 Safari/537.36",
+			"Accept":                    "text/html,application/xhtml+xml,application/xml;q=0.9,image/avif,image/webp,image/apng,*/*;q=0.8,application/signed-exchange;v=b3;q=0.7",
+			"Accept-Language":           "en-US,en;q=0.9",
+			"Sec-Ch-Ua":                 `"Google Chrome";v="131", "Chromium";v="131", "Not_A Brand";v="24"`,
+			"Sec-Ch-Ua-Mobile":          "?0",
+			"Sec-Ch-Ua-Platform":        `"Windows"`,
+			"Sec-Fetch-Dest":            "document",
+			"Sec-Fetch-Mode":            "navigate",
+			"Sec-Fetch-Site":            "none",
+			"Sec-Fetch-User":            "?1",
+			"Upgrade-Insecure-Requests": "1",
+		},
+	},
+	{
+		Name:        "firefox",
+		Description: "Firefox 133 on Windows",
+		Headers: map[string]string{
+			"User-Agent":                "Mozilla/5.0 (Windows NT 10.0; Win64; x64; rv:133.0) Gecko/20100101 Firefox/133.0",
+			"Accept":                    "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8",
+			"Accept-Language":           "en-US,en;q=0.5",
+			"Sec-Fetch-Dest":            "document",
+			"Sec-Fetch-Mode":            "navigate",
+			"Sec-Fetch-Site":            "none",
+			"Sec-Fetch-User":            "?1",
+			"Upgrade-Insecure-Requests": "1",
+		},
+	},
+	{
+		Name:        "safari",
+		Description: "Safari 18 on macOS",
+		Headers: map[string]string{
+			"User-Agent":      "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/18.1 Safari/605.1.15",
+			"Accept":          "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8",
+			"Accept-Language": "en-US,en;q=0.9",
+			"Sec-Fetch-Dest":  "document",
+			"Sec-Fetch-Mode":  "navigate",
+			"Sec-Fetch-Site":  "none",
+		},
+	},
+	{
+		Name:        "mobile",
+		Description: "Safari on iPhone",
+		Headers: map[string]string{
+			"User-Agent":      "Mozilla/5.0 (iPhone; CPU iPhone OS 18_1 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/18.1 Mobile/15E148 Safari/604.1",
+			"Accept":          "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8",
+			"Accept-Language": "en-US,en;q=0.9",
+			"Sec-Fetch-Dest":  "document",
+			"Sec-Fetch-Mode":  "navigate",
+			"Sec-Fetch-Site":  "none",
+		},
+	},
+	{
+		Name:        "curl",
+		Description: "curl 8",
+		Headers:     map[string]string{"User-Agent": "curl/8.5.0", "Accept": "*/*"},
+	},
+	{
+		Name:        "googlebot",
+		Description: "Google search crawler",
+		Headers:     map[string]string{"User-Agent": "Mozilla/5.0 (compatible; Googlebot/2.1; +http://www.google.com/bot.html)", "Accept": "*/*"},
+	},
+	{
+		Name:        "gptbot",
+		Description: "OpenAI crawler",
+		Headers:     map[string]string{"User-Agent": "Mozilla/5.0 AppleWebKit/537.36 (KHTML, like Gecko; compatible; GPTBot/1.2; +https://openai.com/gptbot)", "Accept": "*/*"},
+	},
+	{
+		Name:        "claudebot",
+		Description: "Anthropic crawler",
+		Headers:     map[string]string{"User-Agent": "Mozilla/5.0 AppleWebKit/537.36 (KHTML, like Gecko; compatible; ClaudeBot/1.0; +claudebot@anthropic.com)", "Accept": "*/*"},
+	},
+}
+
+// MatrixRequest is the body of POST /api/matrix: one test run once per profile
+type MatrixRequest struct {
+	TestRequest
+	Profiles       []string           `json:"profiles,omitempty"`       // names to run, defaults to every built-in and custom profile
+	CustomProfiles []UserAgentProfile `json:"customProfiles,omitempty"` // replace built-in profiles of the same name
+}
+
+// MatrixResult is the outcome of the test for one profile
+type MatrixResult struct {
+	Profile      string `json:"profile"`
+	UserAgent    string `json:"userAgent"`
+	Success      bool   `json:"success"`
+	StatusCode   int    `json:"statusCode,omitempty"`
+	Blocked      bool   `json:"blocked"`
+	BlockReason  string `json:"blockReason,omitempty"`
+	BlockVendor  string `json:"blockVendor,omitempty"`
+	Throttled    bool   `json:"throttled,omitempty"`
+	FinalURL     string `json:"finalUrl,omitempty"`
+	Redirects    int    `json:"redirects"`
+	BodyHash     string `json:"bodyHash,omitempty"` // SHA-256 of the decoded body, hex
+	BodySize     int    `json:"bodySize"`
+	ResponseTime int64  `json:"responseTime,omitempty"` // milliseconds
+	Error        string `json:"error,omitempty"`
+	ErrorCode    string `json:"errorCode,omitempty"`
+	ID           string `json:"id,omitempty"` // stored result, see /api/results/{id}
+}
+
+// MatrixGroup lists the profiles that got the same response
+type MatrixGroup struct {
+	StatusCode int      `json:"statusCode"`
+	FinalURL   string   `json:"finalUrl,omitempty"`
+	BodyHash   string   `json:"bodyHash,omitempty"`
+	Profiles   []string `json:"profiles"`
+}
+
+// MatrixResponse is returned by POST /api/matrix
+type MatrixResponse struct {
+	URL        string         `json:"url"`
+	Results    []MatrixResult `json:"results"`
+	Groups     []MatrixGroup  `json:"groups"`     // largest first; a single group means every profile got the same response
+	Blocked    []string       `json:"blocked"`    // profiles that were blocked
+	Consistent bool           `json:"consistent"` // every profile got the same status, final URL and body
+}
+
+// resolveProfiles returns the profiles a matrix request runs, in request order
+func resolveProfiles(m MatrixRequest) ([]UserAgentProfile, string) {
+	if len(m.CustomProfiles) > maxMatrixProfiles {
+		return nil, fmt.Sprintf("At most %d custom profiles are allowed", maxMatrixProfiles)
+	}
+
+	byName := map[string]UserAgentProfile{}
+	var order []string
+	for _, p := range builtinProfiles {
+		byName[p.Name] = p
+		order = append(order, p.Name)
+	}
+	custom := map[string]bool{}
+	for _, p := range m.CustomProfiles {
+		if p.Name == "" {
+			return nil, "Custom profiles need a name"
+		}
+		if custom[p.Name] {
+			return nil, "Duplicate custom profile: " + p.Name
+		}
+		custom[p.Name] = true
+		if _, ok := byName[p.Name]; !ok {
+			order = append(order, p.Name)
+		}
+		byName[p.Name] = p
+	}
+
+	names := m.Profiles
+	if len(names) == 0 {
+		names = order
+	}
+	if len(names) > maxMatrixProfiles {
+		return nil, fmt.Sprintf("At most %d profiles are allowed", maxMatrixProfiles)
+	}
+
+	profiles := make([]UserAgentProfile, 0, len(names))
+	seen := map[string]bool{}
+	for _, name := range names {
+		p, ok := byName[name]
+		if !ok {
+			return nil, "Unknown profile: " + name
+		}
+		if !seen[name] {
+			seen[name] = true
+			profiles = append(profiles, p)
+		}
+	}
+	return profiles, ""
+}
+
+// profileRequest applies a profile's headers on top of the shared request headers
+func profileRequest(req TestRequest, profile UserAgentProfile) TestRequest {
+	headers := map[string]string{}
+	for name, value := range req.Headers {
+		headers[name] = value
+	}
+	for name, value := range profile.Headers {
+		setHeader(headers, name, value)
+	}
+	req.Headers = headers
+	return req
+}
+
+// validateMatrixRequest checks the shared request and every profile's headers
+func validateMatrixRequest(m MatrixRequest, profiles []UserAgentProfile) string {
+	if msg := validateRequest(m.TestRequest); msg != "" {
+		return msg
+	}
+	for _, p := range profiles {
+		if msg := validateRequest(profileRequest(m.TestRequest, p)); msg != "" {
+			return "Profile " + p.Name + ": " + msg
+		}
+	}
+	return ""
+}
+
+// runMatrix tests the request once per profile, a few profiles at a time
+func runMatrix(ctx context.Context, req TestRequest, profiles []UserAgentProfile) MatrixResponse {
+	results := make([]MatrixResult, len(profiles))
+	sem := make(chan struct{}, matrixConcurrency)
+	var wg sync.WaitGroup
+	for i, profile := range profiles {
+		wg.Add(1)
+		go func(i int, profile UserAgentProfile) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			results[i] = runMatrixProfile(ctx, profileRequest(req, profile), profile)
+		}(i, profile)
+	}
+	wg.Wait()
+
+	response := MatrixResponse{URL: req.URL, Results: results, Blocked: []string{}}
+	for _, result := range results {
+		if result.Blocked {
+			response.Blocked = append(response.Blocked, result.Profile)
+		}
+	}
+	response.Groups = groupMatrixResults(results)
+	response.Consistent = len(response.Groups) == 1
+	return response
+}
+
+// runMatrixProfile tests and records the request of one profile
+func runMatrixProfile(ctx context.Context, req TestRequest, profile UserAgentProfile) MatrixResult {
+	ctx = withLogger(ctx, loggerFrom(ctx).With("profile", profile.Name))
+	response, _, _ := runTest(ctx, req)
+	stored := recordResult(ctx, sourceMatrix, "", req, response)
+
+	result := MatrixResult{
+		Profile:      profile.Name,
+		UserAgent:    defaultUserAgent,
+		Success:      response.Success,
+		StatusCode:   response.StatusCode,
+		Blocked:      response.Blocked,
+		BlockReason:  response.BlockReason,
+		BlockVendor:  response.BlockVendor,
+		Throttled:    response.RateLimit != nil && response.RateLimit.Throttled,
+		FinalURL:     response.FinalURL,
+		Redirects:    len(response.Redirects),
+		ResponseTime: response.ResponseTime,
+		Error:        response.Error,
+		ErrorCode:    response.ErrorCode,
+		ID:           stored.ID,
+	}
+	for name, value := range req.Headers {
+		if strings.EqualFold(name, "User-Agent") {
+			result.UserAgent = value
+		}
+	}
+	if response.Success {
+		result.BodyHash = response.BodyHash
+		result.BodySize = response.BodySize
+	}
+	return result
+}
+
+// groupMatrixResults groups profiles by status, final URL and body hash, largest group first
+func groupMatrixResults(results []MatrixResult) []MatrixGroup {
+	groups := []MatrixGroup{}
+	index := map[string]int{}
+	for _, result := range results {
+		key := fmt.Sprintf("%d %s %s %s", result.StatusCode, result.FinalURL, result.BodyHash, result.ErrorCode)
+		i, ok := index[key]
+		if !ok {
+			i = len(groups)
+			index[key] = i
+			groups = append(groups, MatrixGroup{StatusCode: result.StatusCode, FinalURL: result.FinalURL, BodyHash: result.BodyHash})
+		}
+		groups[i].Profiles = append(groups[i].Profiles, result.Profile)
+	}
+	sort.SliceStable(groups, func(i, j int) bool { return len(groups[i].Profiles) > len(groups[j].Profiles) })
+	return groups
+}
+
+// matrixHandler handles POST /api/matrix
+func matrixHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var m MatrixRequest
+	if err := json.NewDecoder(io.LimitReader(r.Body, maxMatrixBodyBytes)).Decode(&m); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid JSON"})
+		return
+	}
+	profiles, msg := resolveProfiles(m)
+	if msg == "" {
+		msg = validateMatrixRequest(m, profiles)
+	}
+	if msg != "" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": msg})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, runMatrix(r.Context(), m.TestRequest, profiles))
+}
+
+// profilesHandler handles GET /api/profiles, listing the built-in profiles
+func profilesHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	writeJSON(w, http.StatusOK, builtinProfiles)
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestResolveProfiles(t *testing.T) {
+	custom := []UserAgentProfile{
+		{Name: "chrome", Headers: map[string]string{"User-Agent": "Chrome/1"}},
+		{Name: "internal", Headers: map[string]string{"User-Agent": "internal-probe"}},
+	}
+	tests := []struct {
+		name    string
+		request MatrixRequest
+		want    []string
+		wantErr string
+	}{
+		{"defaults to built-ins", MatrixRequest{}, nil, ""},
+		{"selected", MatrixRequest{Profiles: []string{"curl", "chrome", "curl"}}, []string{"curl", "chrome"}, ""},
+		{"custom", MatrixRequest{Profiles: []string{"internal", "chrome"}, CustomProfiles: custom}, []string{"internal", "chrome"}, ""},
+		{"unknown", MatrixRequest{Profiles: []string{"netscape"}}, nil, "Unknown profile: netscape"},
+		{"unnamed custom", MatrixRequest{CustomProfiles: []UserAgentProfile{{}}}, nil, "need a name"},
+		{"duplicate custom", MatrixRequest{CustomProfiles: []UserAgentProfile{custom[1], custom[1]}}, nil, "Duplicate custom profile"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			profiles, msg := resolveProfiles(tt.request)
+			if tt.wantErr != "" {
+				if !strings.Contains(msg, tt.wantErr) {
+					t.Errorf("expected error containing %q, got %q", tt.wantErr, msg)
+				}
+				return
+			}
+			if msg != "" {
+				t.Fatalf("unexpected error %q", msg)
+			}
+			if tt.want == nil {
+				if len(profiles) != len(builtinProfiles)+len(tt.request.CustomProfiles) {
+					t.Errorf("expected every profile, got %d", len(profiles))
+				}
+				return
+			}
+			var names []string
+			for _, p := range profiles {
+				names = append(names, p.Name)
+			}
+			if strings.Join(names, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("expected %v, got %v", tt.want, names)
+			}
+		})
+	}
+
+	// Custom profiles replace the built-in profile of the same name
+	profiles, _ := resolveProfiles(MatrixRequest{Profiles: []string{"chrome"}, CustomProfiles: custom})
+	if profiles[0].Headers["User-Agent"] != "Chrome/1" {
+		t.Errorf("expected the custom chrome profile, got %+v", profiles[0])
+	}
+}
+
+func TestProfileRequest(t *testing.T) {
+	req := TestRequest{URL: "https://example.com", Headers: map[string]string{"user-agent": "mine", "X-Trace": "1"}}
+	got := profileRequest(req, UserAgentProfile{Name: "curl", Headers: map[string]string{"User-Agent": "curl/8.5.0"}})
+	if got.Headers["User-Agent"] != "curl/8.5.0" || got.Headers["X-Trace"] != "1" {
+		t.Errorf("unexpected headers %v", got.Headers)
+	}
+	if _, ok := got.Headers["user-agent"]; ok {
+		t.Errorf("profile should replace the request User-Agent, got %v", got.Headers)
+	}
+	if req.Headers["user-agent"] != "mine" {
+		t.Errorf("the shared request was modified: %v", req.Headers)
+	}
+}
+
+func TestRunMatrix(t *testing.T) {
+	useTestResultStore(t, newMemoryResultStore(100, 0))
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch ua := r.Header.Get("User-Agent"); {
+		case strings.Contains(ua, "GPTBot"):
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte("no bots"))
+		case r.URL.Path == "/unsupported":
+			w.Write([]byte("please use a browser"))
+		case strings.HasPrefix(ua, "curl/"):
+			http.Redirect(w, r, "/unsupported", http.StatusFound)
+		default:
+			w.Write([]byte("welcome"))
+		}
+	}))
+	defer server.Close()
+
+	profiles, _ := resolveProfiles(MatrixRequest{Profiles: []string{"chrome", "firefox", "curl", "gptbot"}})
+	response := runMatrix(context.Background(), TestRequest{URL: server.URL}, profiles)
+
+	if len(response.Results) != 4 {
+		t.Fatalf("expected 4 results, got %d", len(response.Results))
+	}
+	for i, name := range []string{"chrome", "firefox", "curl", "gptbot"} {
+		if response.Results[i].Profile != name || response.Results[i].ID == "" {
+			t.Errorf("result %d: unexpected %+v", i, response.Results[i])
+		}
+	}
+	chrome, curl, gptbot := response.Results[0], response.Results[2], response.Results[3]
+	if chrome.BodyHash == "" || chrome.BodyHash != response.Results[1].BodyHash || chrome.BodySize != len("welcome") {
+		t.Errorf("expected browsers to get the same body, got %+v", response.Results[:2])
+	}
+	if !strings.HasSuffix(curl.FinalURL, "/unsupported") || curl.Redirects != 1 || curl.UserAgent != "curl/8.5.0" {
+		t.Errorf("unexpected curl result %+v", curl)
+	}
+	if !gptbot.Blocked || gptbot.StatusCode != http.StatusForbidden {
+		t.Errorf("expected gptbot to be blocked, got %+v", gptbot)
+	}
+	if response.Consistent || len(response.Groups) != 3 || len(response.Groups[0].Profiles) != 2 {
+		t.Errorf("unexpected groups %+v", response.Groups)
+	}
+	if len(response.Blocked) != 1 || response.Blocked[0] != "gptbot" {
+		t.Errorf("unexpected blocked profiles %v", response.Blocked)
+	}
+
+	stored, ok, err := resultStore.Get(gptbot.ID)
+	if err != nil || !ok || stored.Source != sourceMatrix {
+		t.Errorf("expected a stored matrix result, got %+v", stored)
+	}
+}
+
+func TestMatrixHandler(t *testing.T) {
+	tests := []struct {
+		name       string
+		method     string
+		body       string
+		wantStatus int
+	}{
+		{"invalid JSON", http.MethodPost, "{", http.StatusBadRequest},
+		{"invalid URL", http.MethodPost, `{"url": "ftp://example.com"}`, http.StatusBadRequest},
+		{"unknown profile", http.MethodPost, `{"url": "https://example.com", "profiles": ["x"]}`, http.StatusBadRequest},
+		{"bad profile header", http.MethodPost, `{"url": "https://example.com", "profiles": ["bad"], "customProfiles": [{"name": "bad", "headers": {"User Agent": "x"}}]}`, http.StatusBadRequest},
+		{"wrong method", http.MethodGet, "", http.StatusMethodNotAllowed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			matrixHandler(w, httptest.NewRequest(tt.method, "/api/matrix", strings.NewReader(tt.body)))
+			if w.Code != tt.wantStatus {
+				t.Errorf("expected %d, got %d: %s", tt.wantStatus, w.Code, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestProfilesHandler(t *testing.T) {
+	w := httptest.NewRecorder()
+	profilesHandler(w, httptest.NewRequest(http.MethodGet, "/api/profiles", nil))
+	var profiles []UserAgentProfile
+	if err := json.Unmarshal(w.Body.Bytes(), &profiles); err != nil {
+		t.Fatal(err)
+	}
+	if len(profiles) != len(builtinProfiles) || profiles[0].Name != "default" {
+		t.Errorf("unexpected profiles %+v", profiles)
+	}
+	for _, p := range profiles {
+		if p.Headers["User-Agent"] == "" {
+			t.Errorf("profile %s has no User-Agent", p.Name)
+		}
+	}
+}
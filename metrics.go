@@ -0,0 +1,256 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// phaseBuckets are the upper bounds in seconds of the phase latency histograms
+var phaseBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30}
+
+// counterVec is a counter with labels
+type counterVec struct {
+	labels []string
+	mu     sync.Mutex
+	values map[string]float64 // keyed by joined label values
+}
+
+// newCounterVec creates a counter with the given label names
+func newCounterVec(labels ...string) *counterVec {
+	return &counterVec{labels: labels, values: make(map[string]float64)}
+}
+
+// inc adds one to the series with the given label values
+func (c *counterVec) inc(values ...string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.values[seriesKey(values)]++
+}
+
+// write writes the counter in Prometheus text format
+func (c *counterVec) write(w io.Writer, name, help string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s counter\n", name, help, name)
+	for _, key := range sortedKeys(c.values) {
+		fmt.Fprintf(w, "%s%s %s\n", name, formatLabels(c.labels, splitSeriesKey(key)), formatFloat(c.values[key]))
+	}
+}
+
+// histogramVec is a histogram with one label
+type histogramVec struct {
+	label   string
+	buckets []float64
+	mu      sync.Mutex
+	series  map[string]*histogramSeries
+}
+
+// histogramSeries holds the observations of one label value
+type histogramSeries struct {
+	counts []uint64 // per bucket, not cumulative
+	sum    float64
+	count  uint64
+}
+
+// newHistogramVec creates a histogram with the given label name and bucket bounds
+func newHistogramVec(label string, buckets []float64) *histogramVec {
+	return &histogramVec{label: label, buckets: buckets, series: make(map[string]*histogramSeries)}
+}
+
+// observe records value for the given label value
+func (h *histogramVec) observe(labelValue string, value float64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	s, ok := h.series[labelValue]
+	if !ok {
+		s = &histogramSeries{counts: make([]uint64, len(h.buckets))}
+		h.series[labelValue] = s
+	}
+	for i, bound := range h.buckets {
+		if value <= bound {
+			s.counts[i]++
+			break
+		}
+	}
+	s.sum += value
+	s.count++
+}
+
+// write writes the histogram in Prometheus text format
+func (h *histogramVec) write(w io.Writer, name, help string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s histogram\n", name, help, name)
+
+	labelValues := make([]string, 0, len(h.series))
+	for value := range h.series {
+		labelValues = append(labelValues, value)
+	}
+	sort.Strings(labelValues)
+
+	for _, value := range labelValues {
+		s := h.series[value]
+		var cumulative uint64
+		for i, bound := range h.buckets {
+			cumulative += s.counts[i]
+			fmt.Fprintf(w, "%s_bucket%s %d\n", name, formatLabels([]string{h.label, "le"}, []string{value, formatFloat(bound)}), cumulative)
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", name, formatLabels([]string{h.label, "le"}, []string{value, "+Inf"}), s.count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", name, formatLabels([]string{h.label}, []string{value}), formatFloat(s.sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", name, formatLabels([]string{h.label}, []string{value}), s.count)
+	}
+}
+
+// checkMetrics are the metrics of checks run by this server
+type checkMetrics struct {
+	checks        *counterVec // source, outcome
+	statusClasses *counterVec // class
+	errorCodes    *counterVec // code
+	phases        *histogramVec
+	inFlight      atomic.Int64
+}
+
+// metrics holds the metrics of this server
+var metrics = newCheckMetrics()
+
+// newCheckMetrics creates empty check metrics
+func newCheckMetrics() *checkMetrics {
+	return &checkMetrics{
+		checks:        newCounterVec("source", "outcome"),
+		statusClasses: newCounterVec("class"),
+		errorCodes:    newCounterVec("code"),
+		phases:        newHistogramVec("phase", phaseBuckets),
+	}
+}
+
+// observe records a completed check
+func (m *checkMetrics) observe(source string, response TestResponse) {
+	m.checks.inc(source, resultOutcome(response))
+	if !response.Success {
+		m.errorCodes.inc(response.ErrorCode)
+		return
+	}
+	m.statusClasses.inc(fmt.Sprintf("%dxx", response.StatusCode/100))
+
+	// Connection phases are only observed for hops that opened a new connection
+	for _, t := range response.Timings {
+		if t.DNSLookup > 0 {
+			m.phases.observe("dns", t.DNSLookup/1000)
+		}
+		if t.TCPConnect > 0 {
+			m.phases.observe("connect", t.TCPConnect/1000)
+		}
+		if t.TLSHandshake > 0 {
+			m.phases.observe("tls", t.TLSHandshake/1000)
+		}
+		m.phases.observe("ttfb", t.TimeToFirstByte/1000)
+	}
+	if n := len(response.Timings); n > 0 {
+		m.phases.observe("transfer", response.Timings[n-1].ContentTransfer/1000)
+	}
+	m.phases.observe("total", float64(response.ResponseTime)/1000)
+}
+
+// write writes all metrics in Prometheus text format
+func (m *checkMetrics) write(w io.Writer) {
+	m.checks.write(w, "urlchecker_checks_total", "Checks run, by source and outcome.")
+	m.statusClasses.write(w, "urlchecker_check_responses_total", "Checks that got a response, by status class.")
+	m.errorCodes.write(w, "urlchecker_check_errors_total", "Checks that got no response, by error code.")
+	m.phases.write(w, "urlchecker_check_phase_seconds", "Latency of check phases.")
+	fmt.Fprintf(w, "# HELP urlchecker_checks_in_flight Checks currently running.\n# TYPE urlchecker_checks_in_flight gauge\nurlchecker_checks_in_flight %d\n", m.inFlight.Load())
+}
+
+// writeMonitorMetrics writes per-monitor gauges, if any monitors exist
+func writeMonitorMetrics(w io.Writer, store *monitorStore) {
+	states := store.list()
+	if len(states) == 0 {
+		return
+	}
+
+	type gauge struct{ name, help string }
+	up := gauge{"urlchecker_monitor_up", "Whether the last check of a monitor was up (1) or down (0)."}
+	latency := gauge{"urlchecker_monitor_last_latency_seconds", "Response time of the last check of a monitor."}
+	expiry := gauge{"urlchecker_monitor_cert_expiry_timestamp_seconds", "Expiry time of the leaf certificate seen by the last check of a monitor."}
+	lines := map[gauge][]string{}
+
+	labelNames := []string{"monitor", "name", "url"}
+	for _, state := range states {
+		view := state.view(0)
+		last := view.Status.LastCheck
+		if last == nil {
+			continue
+		}
+		labels := formatLabels(labelNames, []string{view.ID, view.Name, view.Request.URL})
+		upValue := 0
+		if last.Up {
+			upValue = 1
+		}
+		lines[up] = append(lines[up], fmt.Sprintf("%s%s %d", up.name, labels, upValue))
+		if last.Success {
+			lines[latency] = append(lines[latency], fmt.Sprintf("%s%s %s", latency.name, labels, formatFloat(float64(last.ResponseTime)/1000)))
+		}
+		if last.TLS != nil && len(last.TLS.Certificates) > 0 {
+			lines[expiry] = append(lines[expiry], fmt.Sprintf("%s%s %d", expiry.name, labels, last.TLS.Certificates[0].NotAfter.Unix()))
+		}
+	}
+
+	for _, g := range []gauge{up, latency, expiry} {
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s gauge\n", g.name, g.help, g.name)
+		for _, line := range lines[g] {
+			fmt.Fprintln(w, line)
+		}
+	}
+}
+
+// metricsHandler handles GET /metrics
+func metricsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	metrics.write(w)
+	writeMonitorMetrics(w, monitors)
+}
+
+// seriesKey joins label values into a map key
+func seriesKey(values []string) string {
+	return strings.Join(values, "\x00")
+}
+
+// splitSeriesKey splits a key made by seriesKey
+func splitSeriesKey(key string) []string {
+	return strings.Split(key, "\x00")
+}
+
+// sortedKeys returns the keys of m in order
+func sortedKeys(m map[string]float64) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// formatLabels formats label pairs as {a="x",b="y"}
+func formatLabels(names, values []string) string {
+	pairs := make([]string, len(names))
+	for i, name := range names {
+		pairs[i] = name + `="` + labelEscaper.Replace(values[i]) + `"`
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+// labelEscaper escapes label values as required by the text format
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// formatFloat formats a sample value
+func formatFloat(value float64) string {
+	return fmt.Sprintf("%g", value)
+}
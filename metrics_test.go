@@ -0,0 +1,149 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// useTestMetrics replaces the global metrics for the duration of a test
+func useTestMetrics(t *testing.T) *checkMetrics {
+	t.Helper()
+	saved := metrics
+	metrics = newCheckMetrics()
+	t.Cleanup(func() { metrics = saved })
+	return metrics
+}
+
+func TestMetricsFormat(t *testing.T) {
+	counter := newCounterVec("source", "outcome")
+	counter.inc("test", "ok")
+	counter.inc("test", "ok")
+	counter.inc("batch", "fail")
+	counter.inc("test", "a \"quoted\"\\\nvalue")
+
+	var buf bytes.Buffer
+	counter.write(&buf, "checks_total", "Checks.")
+	want := `# HELP checks_total Checks.
+# TYPE checks_total counter
+checks_total{source="batch",outcome="fail"} 1
+checks_total{source="test",outcome="a \"quoted\"\\\nvalue"} 1
+checks_total{source="test",outcome="ok"} 2
+`
+	if buf.String() != want {
+		t.Errorf("counter output:\n%s\nwant:\n%s", buf.String(), want)
+	}
+
+	histogram := newHistogramVec("phase", []float64{0.1, 1})
+	histogram.observe("dns", 0.05)
+	histogram.observe("dns", 0.5)
+	histogram.observe("dns", 2)
+
+	buf.Reset()
+	histogram.write(&buf, "phase_seconds", "Phases.")
+	want = `# HELP phase_seconds Phases.
+# TYPE phase_seconds histogram
+phase_seconds_bucket{phase="dns",le="0.1"} 1
+phase_seconds_bucket{phase="dns",le="1"} 2
+phase_seconds_bucket{phase="dns",le="+Inf"} 3
+phase_seconds_sum{phase="dns"} 2.55
+phase_seconds_count{phase="dns"} 3
+`
+	if buf.String() != want {
+		t.Errorf("histogram output:\n%s\nwant:\n%s", buf.String(), want)
+	}
+}
+
+func TestMetricsObserve(t *testing.T) {
+	m := newCheckMetrics()
+	m.observe(sourceTest, TestResponse{Success: true, StatusCode: 200, ResponseTime: 120,
+		Timings: []PhaseTimings{{DNSLookup: 5, TCPConnect: 10, TimeToFirstByte: 50, ContentTransfer: 20}}})
+	m.observe(sourceBatch, TestResponse{Success: true, StatusCode: 503})
+	m.observe(sourceMonitor, TestResponse{Success: false, ErrorCode: "dns_not_found"})
+
+	var buf bytes.Buffer
+	m.write(&buf)
+	output := buf.String()
+	for _, line := range []string{
+		`urlchecker_checks_total{source="test",outcome="ok"} 1`,
+		`urlchecker_checks_total{source="batch",outcome="fail"} 1`,
+		`urlchecker_checks_total{source="monitor",outcome="error"} 1`,
+		`urlchecker_check_responses_total{class="2xx"} 1`,
+		`urlchecker_check_responses_total{class="5xx"} 1`,
+		`urlchecker_check_errors_total{code="dns_not_found"} 1`,
+		`urlchecker_check_phase_seconds_count{phase="dns"} 1`,
+		`urlchecker_check_phase_seconds_sum{phase="ttfb"} 0.05`,
+		`urlchecker_check_phase_seconds_count{phase="total"} 2`,
+		`urlchecker_checks_in_flight 0`,
+	} {
+		if !strings.Contains(output, line+"\n") {
+			t.Errorf("missing %q in:\n%s", line, output)
+		}
+	}
+	// Phases without a new connection are not observed
+	if strings.Contains(output, `phase="tls"`) {
+		t.Errorf("unexpected tls phase in:\n%s", output)
+	}
+}
+
+func TestMetricsHandler(t *testing.T) {
+	useTestMetrics(t)
+	useTestResultStore(t, newMemoryResultStore(10, 0))
+	store := useTestMonitors(t)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer server.Close()
+
+	w := httptest.NewRecorder()
+	testURLHandler(w, httptest.NewRequest(http.MethodPost, "/api/test", strings.NewReader(`{"url":"`+server.URL+`"}`)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("test failed with %d: %s", w.Code, w.Body.String())
+	}
+
+	// Without monitors there are no monitor gauges
+	w = httptest.NewRecorder()
+	metricsHandler(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if !strings.HasPrefix(w.Header().Get("Content-Type"), "text/plain; version=0.0.4") {
+		t.Errorf("unexpected content type %q", w.Header().Get("Content-Type"))
+	}
+	if !strings.Contains(w.Body.String(), `urlchecker_checks_total{source="test",outcome="fail"} 1`) ||
+		!strings.Contains(w.Body.String(), `urlchecker_check_responses_total{class="4xx"} 1`) {
+		t.Errorf("check not counted:\n%s", w.Body.String())
+	}
+	if strings.Contains(w.Body.String(), "urlchecker_monitor_up") {
+		t.Errorf("unexpected monitor metrics:\n%s", w.Body.String())
+	}
+
+	state, err := store.add(Monitor{ID: "m1", Name: "site", Request: TestRequest{URL: server.URL}, Interval: Duration(time.Minute), Paused: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	state.check()
+	store.add(Monitor{ID: "m2", Request: TestRequest{URL: server.URL}, Interval: Duration(time.Minute), Paused: true})
+
+	w = httptest.NewRecorder()
+	metricsHandler(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	body := w.Body.String()
+	labels := `{monitor="m1",name="site",url="` + server.URL + `"}`
+	if !strings.Contains(body, "urlchecker_monitor_up"+labels+" 0\n") ||
+		!strings.Contains(body, "urlchecker_monitor_last_latency_seconds"+labels) {
+		t.Errorf("missing monitor gauges:\n%s", body)
+	}
+	if strings.Contains(body, `monitor="m2"`) {
+		t.Errorf("unchecked monitor should have no gauges:\n%s", body)
+	}
+	if !strings.Contains(body, `urlchecker_checks_total{source="monitor",outcome="fail"} 1`) {
+		t.Errorf("monitor check not counted:\n%s", body)
+	}
+
+	w = httptest.NewRecorder()
+	metricsHandler(w, httptest.NewRequest(http.MethodPost, "/metrics", nil))
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("expected 405, got %d", w.Code)
+	}
+}
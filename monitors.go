@@ -0,0 +1,501 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Monitor limits
+const (
+	maxMonitorInterval   = 24 * time.Hour
+	maxMonitorResults    = 100 // results kept in memory per monitor
+	maxMonitors          = 100 // monitors a server runs
+	defaultMonitorListed = 20  // results returned by GET /api/monitors/{id}
+)
+
+// errTooManyMonitors is returned by add when maxMonitors exist
+var errTooManyMonitors = fmt.Errorf("at most %d monitors can be created", maxMonitors)
+
+// minMonitorInterval is the shortest allowed check interval
+var minMonitorInterval = 10 * time.Second
+
+// Monitor states reported in MonitorStatus.State
+const (
+	monitorPending = "pending" // not checked yet
+	monitorUp      = "up"
+	monitorDown    = "down"
+	monitorPaused  = "paused"
+)
+
+// Duration is a time.Duration that reads and writes JSON as a string like "30s" or "5m"
+// Plain numbers are read as seconds
+type Duration time.Duration
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var value interface{}
+	if err := json.Unmarshal(data, &value); err != nil {
+		return err
+	}
+	switch v := value.(type) {
+	case float64:
+		*d = Duration(time.Duration(v * float64(time.Second)))
+	case string:
+		parsed, err := time.ParseDuration(v)
+		if err != nil {
+			return fmt.Errorf("invalid duration %q", v)
+		}
+		*d = Duration(parsed)
+	default:
+		return fmt.Errorf("invalid duration %s", data)
+	}
+	return nil
+}
+
+// Monitor is a URL test run on a schedule
+type Monitor struct {
+	ID        string      `json:"id"`
+	Name      string      `json:"name,omitempty"`
+	Request   TestRequest `json:"request"`  // including assertions
+	Interval  Duration    `json:"interval"` // e.g. "30s", "5m"
+	Paused    bool        `json:"paused,omitempty"`
+	CreatedAt time.Time   `json:"createdAt"`
+}
+
+// MonitorResult is one scheduled check of a monitor
+type MonitorResult struct {
+	Time time.Time `json:"time"`
+	Up   bool      `json:"up"`
+	TestResponse
+}
+
+// MonitorStatus summarizes the recent results of a monitor
+type MonitorStatus struct {
+	State               string         `json:"state"` // pending, up, down or paused
+	LastCheck           *MonitorResult `json:"lastCheck,omitempty"`
+	ConsecutiveFailures int            `json:"consecutiveFailures"`
+	Checks              int            `json:"checks"` // results kept in memory
+	Uptime              float64        `json:"uptime"` // percent of kept results that were up
+}
+
+// MonitorView is a monitor with its status, returned by the monitors API
+type MonitorView struct {
+	Monitor
+	Status  MonitorStatus   `json:"status"`
+	Results []MonitorResult `json:"results,omitempty"` // newest first, only for a single monitor
+}
+
+// monitorState is a registered monitor with its results and scheduler
+type monitorState struct {
+	mu                  sync.Mutex
+	monitor             Monitor
+	results             []MonitorResult // oldest first, at most maxMonitorResults
+	consecutiveFailures int
+	stop                chan struct{} // closed to stop the scheduler; nil when not running
+}
+
+// monitorStore keeps monitors in memory and runs their schedules
+// If file is set, monitor definitions are saved there on every change
+type monitorStore struct {
+	mu       sync.Mutex
+	monitors map[string]*monitorState
+	file     string
+}
+
+// monitors holds the monitors of this server
+var monitors = newMonitorStore()
+
+// newMonitorStore creates an empty monitor store
+func newMonitorStore() *monitorStore {
+	return &monitorStore{monitors: make(map[string]*monitorState)}
+}
+
+// validateMonitor checks the monitor request and interval
+func validateMonitor(m Monitor) string {
+	if msg := validateRequest(m.Request); msg != "" {
+		return msg
+	}
+	interval := time.Duration(m.Interval)
+	if interval < minMonitorInterval || interval > maxMonitorInterval {
+		return fmt.Sprintf("interval must be between %s and %s", minMonitorInterval, maxMonitorInterval)
+	}
+	return ""
+}
+
+// isUp decides whether a check passed: the assertion verdict if the request has assertions,
+// otherwise any 2xx or 3xx response
+func isUp(response TestResponse) bool {
+	if response.Verdict != "" {
+		return response.Verdict == verdictPass
+	}
+	return response.Success && response.StatusCode < 400
+}
+
+// load reads monitor definitions from file and starts them
+// A missing file is not an error; it is created on the first change
+func (s *monitorStore) load(file string) error {
+	s.mu.Lock()
+	s.file = file
+	s.mu.Unlock()
+
+	data, err := os.ReadFile(file)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var list []Monitor
+	if err := json.Unmarshal(data, &list); err != nil {
+		return fmt.Errorf("invalid monitors file %s: %v", file, err)
+	}
+	for _, m := range list {
+		if msg := validateMonitor(m); msg != "" {
+			return fmt.Errorf("invalid monitor %s: %s", m.ID, msg)
+		}
+		if m.ID == "" {
+			m.ID = newID()
+		}
+		if _, err := s.add(m); err != nil {
+			return fmt.Errorf("monitors file %s: %w", file, err)
+		}
+	}
+	return nil
+}
+
+// save writes monitor definitions to the store's file, if set
+func (s *monitorStore) save() {
+	s.mu.Lock()
+	file := s.file
+	list := s.definitionsLocked()
+	s.mu.Unlock()
+	if file == "" {
+		return
+	}
+
+	data, err := json.MarshalIndent(list, "", "  ")
+	if err != nil {
+		slog.Error("Failed to encode monitors", "error", err)
+		return
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(file), ".monitors-*.json")
+	if err != nil {
+		slog.Error("Failed to save monitors", "file", file, "error", err)
+		return
+	}
+	_, writeErr := tmp.Write(data)
+	closeErr := tmp.Close()
+	if writeErr != nil || closeErr != nil {
+		os.Remove(tmp.Name())
+		slog.Error("Failed to save monitors", "file", file, "error", errors.Join(writeErr, closeErr))
+		return
+	}
+	if err := os.Rename(tmp.Name(), file); err != nil {
+		os.Remove(tmp.Name())
+		slog.Error("Failed to save monitors", "file", file, "error", err)
+	}
+}
+
+// definitionsLocked returns all monitors ordered by creation time
+func (s *monitorStore) definitionsLocked() []Monitor {
+	list := make([]Monitor, 0, len(s.monitors))
+	for _, state := range s.monitors {
+		state.mu.Lock()
+		list = append(list, state.monitor)
+		state.mu.Unlock()
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].CreatedAt.Equal(list[j].CreatedAt) {
+			return list[i].ID < list[j].ID
+		}
+		return list[i].CreatedAt.Before(list[j].CreatedAt)
+	})
+	return list
+}
+
+// add registers a monitor and starts its schedule unless paused
+// It fails with errTooManyMonitors once maxMonitors exist
+func (s *monitorStore) add(m Monitor) (*monitorState, error) {
+	state := &monitorState{monitor: m}
+	s.mu.Lock()
+	if len(s.monitors) >= maxMonitors {
+		s.mu.Unlock()
+		return nil, errTooManyMonitors
+	}
+	s.monitors[m.ID] = state
+	s.mu.Unlock()
+	state.start()
+	return state, nil
+}
+
+// get returns the monitor with the given id, or nil
+func (s *monitorStore) get(id string) *monitorState {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.monitors[id]
+}
+
+// list returns all monitors ordered by creation time
+func (s *monitorStore) list() []*monitorState {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	states := make([]*monitorState, 0, len(s.monitors))
+	for _, m := range s.definitionsLocked() {
+		states = append(states, s.monitors[m.ID])
+	}
+	return states
+}
+
+// remove stops and deletes a monitor, reporting whether it existed
+func (s *monitorStore) remove(id string) bool {
+	s.mu.Lock()
+	state, ok := s.monitors[id]
+	delete(s.monitors, id)
+	s.mu.Unlock()
+	if ok {
+		state.stopSchedule()
+	}
+	return ok
+}
+
+// stopAll stops every scheduler
+func (s *monitorStore) stopAll() {
+	for _, state := range s.list() {
+		state.stopSchedule()
+	}
+}
+
+// start runs the monitor on its interval in the background, checking immediately
+func (st *monitorState) start() {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if st.monitor.Paused || st.stop != nil {
+		return
+	}
+	stop := make(chan struct{})
+	st.stop = stop
+	interval := time.Duration(st.monitor.Interval)
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			st.check()
+			select {
+			case <-ticker.C:
+			case <-stop:
+				return
+			}
+		}
+	}()
+}
+
+// stopSchedule stops the background scheduler if running
+func (st *monitorState) stopSchedule() {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if st.stop != nil {
+		close(st.stop)
+		st.stop = nil
+	}
+}
+
+// update replaces the monitor definition and restarts its schedule
+// Header values sent back as [REDACTED] keep their current value
+func (st *monitorState) update(m Monitor) {
+	st.stopSchedule()
+	st.mu.Lock()
+	m.Request.Headers = restoreRedactedHeaders(m.Request.Headers, st.monitor.Request.Headers)
+	st.monitor = m
+	st.mu.Unlock()
+	st.start()
+}
+
+// restoreRedactedHeaders replaces [REDACTED] values in headers with the value of the
+// same header in previous, so a definition read from the API can be sent back unchanged
+func restoreRedactedHeaders(headers, previous map[string]string) map[string]string {
+	for name, value := range headers {
+		if value != redactedValue {
+			continue
+		}
+		for prevName, prevValue := range previous {
+			if strings.EqualFold(name, prevName) {
+				headers[name] = prevValue
+			}
+		}
+	}
+	return headers
+}
+
+// check runs the monitor's test once and records the result
+func (st *monitorState) check() MonitorResult {
+	st.mu.Lock()
+	id, req := st.monitor.ID, st.monitor.Request
+	st.mu.Unlock()
+
+	ctx := withLogger(context.Background(), slog.Default().With("monitor_id", id))
+	response := recordResult(ctx, sourceMonitor, id, req, testURLContext(ctx, req)).Response
+	result := MonitorResult{Time: time.Now().UTC(), Up: isUp(response), TestResponse: response}
+
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	st.results = append(st.results, result)
+	if len(st.results) > maxMonitorResults {
+		st.results = st.results[len(st.results)-maxMonitorResults:]
+	}
+	if result.Up {
+		st.consecutiveFailures = 0
+	} else {
+		st.consecutiveFailures++
+	}
+	return result
+}
+
+// view returns the monitor with its status and up to limit recent results
+func (st *monitorState) view(limit int) MonitorView {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	status := MonitorStatus{
+		State:               monitorPending,
+		ConsecutiveFailures: st.consecutiveFailures,
+		Checks:              len(st.results),
+	}
+	if n := len(st.results); n > 0 {
+		last := st.results[n-1]
+		status.LastCheck = &last
+		status.State = monitorDown
+		if last.Up {
+			status.State = monitorUp
+		}
+		up := 0
+		for _, result := range st.results {
+			if result.Up {
+				up++
+			}
+		}
+		status.Uptime = float64(up) * 100 / float64(n)
+	}
+	if st.monitor.Paused {
+		status.State = monitorPaused
+	}
+
+	view := MonitorView{Monitor: st.monitor, Status: status}
+	view.Request = redactRequest(view.Request)
+	for i := len(st.results) - 1; i >= 0 && len(view.Results) < limit; i-- {
+		view.Results = append(view.Results, st.results[i])
+	}
+	return view
+}
+
+// monitorsHandler handles GET and POST /api/monitors
+func monitorsHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		views := []MonitorView{}
+		for _, state := range monitors.list() {
+			views = append(views, state.view(0))
+		}
+		writeJSON(w, http.StatusOK, views)
+	case http.MethodPost:
+		m, errMsg := decodeMonitor(r)
+		if errMsg != "" {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": errMsg})
+			return
+		}
+		m.ID = newID()
+		m.CreatedAt = time.Now().UTC()
+		state, err := monitors.add(m)
+		if err != nil {
+			writeJSON(w, http.StatusTooManyRequests, map[string]string{"error": fmt.Sprintf("Too many monitors, at most %d can be created", maxMonitors)})
+			return
+		}
+		monitors.save()
+		writeJSON(w, http.StatusCreated, state.view(0))
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// monitorHandler handles /api/monitors/{id} (GET, PUT, DELETE) and POST /api/monitors/{id}/run
+func monitorHandler(w http.ResponseWriter, r *http.Request) {
+	id, action, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/api/monitors/"), "/")
+	state := monitors.get(id)
+	if state == nil || (action != "" && action != "run") {
+		http.Error(w, "Monitor not found", http.StatusNotFound)
+		return
+	}
+
+	if action == "run" {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		writeJSON(w, http.StatusOK, state.check())
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		limit := defaultMonitorListed
+		if value := r.URL.Query().Get("limit"); value != "" {
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 0 || n > maxMonitorResults {
+				writeJSON(w, http.StatusBadRequest, map[string]string{"error": fmt.Sprintf("limit must be between 0 and %d", maxMonitorResults)})
+				return
+			}
+			limit = n
+		}
+		writeJSON(w, http.StatusOK, state.view(limit))
+	case http.MethodPut:
+		m, errMsg := decodeMonitor(r)
+		if errMsg != "" {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": errMsg})
+			return
+		}
+		current := state.view(0)
+		m.ID = current.ID
+		m.CreatedAt = current.CreatedAt
+		state.update(m)
+		monitors.save()
+		writeJSON(w, http.StatusOK, state.view(0))
+	case http.MethodDelete:
+		monitors.remove(id)
+		monitors.save()
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// decodeMonitor reads and validates a monitor definition from the request body
+func decodeMonitor(r *http.Request) (Monitor, string) {
+	var m Monitor
+	if err := json.NewDecoder(io.LimitReader(r.Body, maxBatchUploadBytes)).Decode(&m); err != nil {
+		return m, "Invalid JSON"
+	}
+	return m, validateMonitor(m)
+}
+
+// writeJSON writes v as a JSON response with the given status code
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,351 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// useTestMonitors replaces the global monitor store for the duration of a test
+func useTestMonitors(t *testing.T) *monitorStore {
+	t.Helper()
+	saved := monitors
+	store := newMonitorStore()
+	monitors = store
+	t.Cleanup(func() {
+		store.stopAll()
+		monitors = saved
+	})
+	return store
+}
+
+// waitForChecks polls until the monitor has at least n results
+func waitForChecks(t *testing.T, state *monitorState, n int) MonitorView {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if view := state.view(maxMonitorResults); view.Status.Checks >= n {
+			return view
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("timed out waiting for %d checks", n)
+	return MonitorView{}
+}
+
+func TestDurationJSON(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    time.Duration
+		wantErr bool
+	}{
+		{input: `"30s"`, want: 30 * time.Second},
+		{input: `"5m"`, want: 5 * time.Minute},
+		{input: `"1h30m"`, want: 90 * time.Minute},
+		{input: `60`, want: time.Minute},
+		{input: `"5 minutes"`, wantErr: true},
+		{input: `true`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		var d Duration
+		err := json.Unmarshal([]byte(tt.input), &d)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("%s: expected error", tt.input)
+			}
+			continue
+		}
+		if err != nil || time.Duration(d) != tt.want {
+			t.Errorf("%s: expected %s, got %s (%v)", tt.input, tt.want, time.Duration(d), err)
+		}
+	}
+
+	encoded, _ := json.Marshal(Duration(5 * time.Minute))
+	if string(encoded) != `"5m0s"` {
+		t.Errorf("expected \"5m0s\", got %s", encoded)
+	}
+}
+
+func TestValidateMonitor(t *testing.T) {
+	valid := Monitor{Request: TestRequest{URL: "https://example.com"}, Interval: Duration(time.Minute)}
+	if msg := validateMonitor(valid); msg != "" {
+		t.Errorf("expected valid monitor, got %q", msg)
+	}
+
+	tooShort := valid
+	tooShort.Interval = Duration(time.Second)
+	if msg := validateMonitor(tooShort); !strings.Contains(msg, "interval") {
+		t.Errorf("expected interval error, got %q", msg)
+	}
+
+	tooLong := valid
+	tooLong.Interval = Duration(48 * time.Hour)
+	if msg := validateMonitor(tooLong); !strings.Contains(msg, "interval") {
+		t.Errorf("expected interval error, got %q", msg)
+	}
+
+	badURL := valid
+	badURL.Request.URL = "ftp://example.com"
+	if msg := validateMonitor(badURL); msg == "" {
+		t.Errorf("expected URL error")
+	}
+}
+
+func TestIsUp(t *testing.T) {
+	tests := []struct {
+		name     string
+		response TestResponse
+		up       bool
+	}{
+		{"ok", TestResponse{Success: true, StatusCode: 200}, true},
+		{"redirect", TestResponse{Success: true, StatusCode: 301}, true},
+		{"server error", TestResponse{Success: true, StatusCode: 503}, false},
+		{"request failed", TestResponse{Success: false}, false},
+		{"assertions passed", TestResponse{Success: true, StatusCode: 404, Verdict: verdictPass}, true},
+		{"assertions failed", TestResponse{Success: true, StatusCode: 200, Verdict: verdictFail}, false},
+	}
+
+	for _, tt := range tests {
+		if got := isUp(tt.response); got != tt.up {
+			t.Errorf("%s: expected up=%v, got %v", tt.name, tt.up, got)
+		}
+	}
+}
+
+func TestMonitorSchedule(t *testing.T) {
+	savedInterval := minMonitorInterval
+	minMonitorInterval = time.Millisecond
+	defer func() { minMonitorInterval = savedInterval }()
+	store := useTestMonitors(t)
+
+	var healthy atomic.Bool
+	healthy.Store(true)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !healthy.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+
+	state, err := store.add(Monitor{ID: "m1", Request: TestRequest{URL: server.URL}, Interval: Duration(20 * time.Millisecond)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	view := waitForChecks(t, state, 2)
+	if view.Status.State != monitorUp || view.Status.Uptime != 100 {
+		t.Errorf("expected up with 100%% uptime, got %+v", view.Status)
+	}
+
+	healthy.Store(false)
+	deadline := time.Now().Add(5 * time.Second)
+	for state.view(0).Status.ConsecutiveFailures < 2 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	view = state.view(1)
+	if view.Status.State != monitorDown || view.Status.ConsecutiveFailures < 2 {
+		t.Errorf("expected down with consecutive failures, got %+v", view.Status)
+	}
+	if view.Status.Uptime <= 0 || view.Status.Uptime >= 100 {
+		t.Errorf("expected partial uptime, got %v", view.Status.Uptime)
+	}
+	if len(view.Results) != 1 || view.Results[0].StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("expected newest result first, got %+v", view.Results)
+	}
+
+	// Test stopped monitors no longer check
+	store.remove("m1")
+	time.Sleep(50 * time.Millisecond)
+	checks := state.view(0).Status.Checks
+	time.Sleep(100 * time.Millisecond)
+	if after := state.view(0).Status.Checks; after != checks {
+		t.Errorf("expected no checks after removal, got %d more", after-checks)
+	}
+}
+
+func TestMonitorsAPI(t *testing.T) {
+	useTestMonitors(t)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"status": "ok"}`))
+	}))
+	defer server.Close()
+
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		w := httptest.NewRecorder()
+		if path == "/api/monitors" {
+			monitorsHandler(w, req)
+		} else {
+			monitorHandler(w, req)
+		}
+		return w
+	}
+
+	// Create
+	w := do(http.MethodPost, "/api/monitors", `{"name": "api", "interval": "1m", "request": {"url": "`+server.URL+`", "assert": {"jsonPath": [{"path": "$.status", "equals": "ok"}]}}}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("expected status code 201, got %d: %s", w.Code, w.Body.String())
+	}
+	var created MonitorView
+	json.NewDecoder(w.Body).Decode(&created)
+	if created.ID == "" || created.Name != "api" || time.Duration(created.Interval) != time.Minute {
+		t.Fatalf("unexpected monitor: %+v", created)
+	}
+
+	// The first check runs immediately
+	view := waitForChecks(t, monitors.get(created.ID), 1)
+	if view.Status.State != monitorUp || view.Status.LastCheck == nil || view.Status.LastCheck.Verdict != verdictPass {
+		t.Errorf("expected up after first check, got %+v", view.Status)
+	}
+
+	// List
+	w = do(http.MethodGet, "/api/monitors", "")
+	var list []MonitorView
+	json.NewDecoder(w.Body).Decode(&list)
+	if len(list) != 1 || list[0].ID != created.ID || list[0].Results != nil {
+		t.Errorf("unexpected list: %+v", list)
+	}
+
+	// Run now
+	w = do(http.MethodPost, "/api/monitors/"+created.ID+"/run", "")
+	var result MonitorResult
+	json.NewDecoder(w.Body).Decode(&result)
+	if w.Code != http.StatusOK || !result.Up {
+		t.Errorf("expected successful run, got %d %+v", w.Code, result)
+	}
+
+	// Get with results
+	w = do(http.MethodGet, "/api/monitors/"+created.ID+"?limit=1", "")
+	var got MonitorView
+	json.NewDecoder(w.Body).Decode(&got)
+	if got.Status.Checks < 2 || len(got.Results) != 1 {
+		t.Errorf("expected 1 of at least 2 results, got %d of %d", len(got.Results), got.Status.Checks)
+	}
+
+	// Update to paused
+	w = do(http.MethodPut, "/api/monitors/"+created.ID, `{"name": "renamed", "interval": "5m", "paused": true, "request": {"url": "`+server.URL+`"}}`)
+	var updated MonitorView
+	json.NewDecoder(w.Body).Decode(&updated)
+	if w.Code != http.StatusOK || updated.Name != "renamed" || updated.Status.State != monitorPaused || !updated.CreatedAt.Equal(created.CreatedAt) {
+		t.Errorf("unexpected update: %d %+v", w.Code, updated)
+	}
+
+	// Invalid input
+	for _, body := range []string{`{`, `{"interval": "1m", "request": {"url": "nope"}}`, `{"interval": "1s", "request": {"url": "https://example.com"}}`, `{"interval": "soon", "request": {"url": "https://example.com"}}`} {
+		if w := do(http.MethodPost, "/api/monitors", body); w.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected status code 400, got %d", body, w.Code)
+		}
+	}
+
+	// Delete
+	if w := do(http.MethodDelete, "/api/monitors/"+created.ID, ""); w.Code != http.StatusNoContent {
+		t.Errorf("expected status code 204, got %d", w.Code)
+	}
+	if w := do(http.MethodGet, "/api/monitors/"+created.ID, ""); w.Code != http.StatusNotFound {
+		t.Errorf("expected status code 404, got %d", w.Code)
+	}
+	if w := do(http.MethodPatch, "/api/monitors", ""); w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("expected status code 405, got %d", w.Code)
+	}
+}
+
+func TestMonitorsAPIRedactsHeaders(t *testing.T) {
+	useTestMonitors(t)
+
+	var authorization atomic.Value
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authorization.Store(r.Header.Get("Authorization"))
+	}))
+	defer server.Close()
+
+	body := `{"interval": "1m", "paused": true, "request": {"url": "` + server.URL + `", "headers": {"Authorization": "Bearer secret", "X-Team": "web"}}}`
+	w := httptest.NewRecorder()
+	monitorsHandler(w, httptest.NewRequest(http.MethodPost, "/api/monitors", strings.NewReader(body)))
+	if strings.Contains(w.Body.String(), "secret") {
+		t.Errorf("created monitor leaks the header: %s", w.Body.String())
+	}
+	var created MonitorView
+	json.NewDecoder(w.Body).Decode(&created)
+
+	w = httptest.NewRecorder()
+	monitorsHandler(w, httptest.NewRequest(http.MethodGet, "/api/monitors", nil))
+	if strings.Contains(w.Body.String(), "secret") || !strings.Contains(w.Body.String(), redactedValue) {
+		t.Errorf("listed monitor leaks the header: %s", w.Body.String())
+	}
+
+	// Sending the redacted definition back keeps the real value
+	created.Paused = false
+	update, _ := json.Marshal(created.Monitor)
+	w = httptest.NewRecorder()
+	monitorHandler(w, httptest.NewRequest(http.MethodPut, "/api/monitors/"+created.ID, strings.NewReader(string(update))))
+	if w.Code != http.StatusOK || strings.Contains(w.Body.String(), "secret") {
+		t.Fatalf("unexpected update: %d %s", w.Code, w.Body.String())
+	}
+	waitForChecks(t, monitors.get(created.ID), 1)
+	if got := authorization.Load(); got != "Bearer secret" {
+		t.Errorf("expected the check to send the real header, got %v", got)
+	}
+}
+
+func TestMonitorsAPILimit(t *testing.T) {
+	useTestMonitors(t)
+
+	create := func() *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		monitorsHandler(w, httptest.NewRequest(http.MethodPost, "/api/monitors", strings.NewReader(`{"interval": "1m", "paused": true, "request": {"url": "https://example.com"}}`)))
+		return w
+	}
+	for i := 0; i < maxMonitors; i++ {
+		if w := create(); w.Code != http.StatusCreated {
+			t.Fatalf("monitor %d: expected 201, got %d: %s", i, w.Code, w.Body.String())
+		}
+	}
+	w := create()
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected 429 past the limit, got %d: %s", w.Code, w.Body.String())
+	}
+	if len(monitors.list()) != maxMonitors {
+		t.Errorf("expected %d monitors, got %d", maxMonitors, len(monitors.list()))
+	}
+}
+
+func TestMonitorsFile(t *testing.T) {
+	store := useTestMonitors(t)
+	file := filepath.Join(t.TempDir(), "monitors.json")
+
+	// A missing file starts empty
+	if err := store.load(file); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	store.add(Monitor{ID: "a", Request: TestRequest{URL: "https://example.com"}, Interval: Duration(time.Minute), Paused: true, CreatedAt: time.Now()})
+	store.add(Monitor{ID: "b", Request: TestRequest{URL: "https://example.org"}, Interval: Duration(time.Hour), Paused: true, CreatedAt: time.Now().Add(time.Second)})
+	store.save()
+
+	reloaded := newMonitorStore()
+	if err := reloaded.load(file); err != nil {
+		t.Fatalf("failed to reload: %v", err)
+	}
+	defer reloaded.stopAll()
+	list := reloaded.list()
+	if len(list) != 2 {
+		t.Fatalf("expected 2 monitors, got %d", len(list))
+	}
+	if first := list[0].view(0); first.ID != "a" || first.Request.URL != "https://example.com" || time.Duration(first.Interval) != time.Minute {
+		t.Errorf("unexpected monitor: %+v", first)
+	}
+
+	// Invalid definitions are rejected
+	os.WriteFile(file, []byte(`[{"id": "x", "interval": "1s", "request": {"url": "https://example.com"}}]`), 0o644)
+	if err := newMonitorStore().load(file); err == nil {
+		t.Errorf("expected error for invalid interval")
+	}
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// redactedValue replaces the value of redacted headers in stored results
+const redactedValue = "[REDACTED]"
+
+// defaultRedactedHeaders are redacted from stored requests unless REDACT_HEADERS is set
+var defaultRedactedHeaders = []string{"Authorization", "Cookie", "Proxy-Authorization"}
+
+// redactedHeaders are the canonical names of request headers redacted before storage
+var redactedHeaders = canonicalHeaderSet(defaultRedactedHeaders)
+
+// loadRedactedHeaders reads REDACT_HEADERS, a comma-separated list of header names
+// An empty value disables redaction; unset uses the defaults
+func loadRedactedHeaders() map[string]bool {
+	value, ok := os.LookupEnv("REDACT_HEADERS")
+	if !ok {
+		return canonicalHeaderSet(defaultRedactedHeaders)
+	}
+	return canonicalHeaderSet(splitList(value))
+}
+
+// loadResultRetention reads RESULT_RETENTION, a duration like 720h; unset or 0 keeps results
+// until the history limit is reached
+func loadResultRetention() (time.Duration, error) {
+	value := os.Getenv("RESULT_RETENTION")
+	if value == "" {
+		return 0, nil
+	}
+	return time.ParseDuration(value)
+}
+
+// canonicalHeaderSet returns the canonical forms of names as a set
+func canonicalHeaderSet(names []string) map[string]bool {
+	set := make(map[string]bool, len(names))
+	for _, name := range names {
+		set[http.CanonicalHeaderKey(name)] = true
+	}
+	return set
+}
+
+// redactRequest returns a copy of req with the values of redacted headers replaced
+func redactRequest(req TestRequest) TestRequest {
+	if len(req.Headers) == 0 {
+		return req
+	}
+	headers := make(map[string]string, len(req.Headers))
+	for name, value := range req.Headers {
+		if redactedHeaders[http.CanonicalHeaderKey(name)] {
+			value = redactedValue
+		}
+		headers[name] = value
+	}
+	req.Headers = headers
+	return req
+}
+
+// resultHandler handles GET /api/results/{id}
+func resultHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	id := strings.TrimPrefix(r.URL.Path, "/api/results/")
+	result, found, err := resultStore.Get(id)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to read result"})
+		return
+	}
+	if !found {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "Result not found or expired"})
+		return
+	}
+	writeJSON(w, http.StatusOK, result)
+}
+
+// permalinkHandler handles GET /r/{id} by serving the UI, which loads the result from /api/results/{id}
+func permalinkHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	http.ServeFile(w, r, "./static/index.html")
+}
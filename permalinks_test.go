@@ -0,0 +1,110 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRedactRequest(t *testing.T) {
+	req := TestRequest{
+		URL:     "https://example.com",
+		Headers: map[string]string{"authorization": "Bearer secret", "Cookie": "session=1", "Accept": "text/html"},
+	}
+
+	redacted := redactRequest(req)
+	if redacted.Headers["authorization"] != redactedValue || redacted.Headers["Cookie"] != redactedValue {
+		t.Errorf("expected sensitive headers to be redacted, got %v", redacted.Headers)
+	}
+	if redacted.Headers["Accept"] != "text/html" {
+		t.Errorf("expected other headers to be kept, got %v", redacted.Headers)
+	}
+	if req.Headers["authorization"] != "Bearer secret" {
+		t.Errorf("expected the original request to be unchanged")
+	}
+}
+
+func TestLoadRedactedHeaders(t *testing.T) {
+	t.Setenv("REDACT_HEADERS", "x-api-key, Authorization")
+	headers := loadRedactedHeaders()
+	if !headers["X-Api-Key"] || !headers["Authorization"] || headers["Cookie"] {
+		t.Errorf("unexpected redacted headers: %v", headers)
+	}
+
+	t.Setenv("REDACT_HEADERS", "")
+	if headers := loadRedactedHeaders(); len(headers) != 0 {
+		t.Errorf("expected redaction to be disabled, got %v", headers)
+	}
+}
+
+func TestResultRetention(t *testing.T) {
+	store := newMemoryResultStore(100, time.Hour)
+	now := time.Now()
+	store.Save(StoredResult{ID: "old", Time: now.Add(-2 * time.Hour)})
+	store.Save(StoredResult{ID: "new", Time: now})
+
+	if _, found, _ := store.Get("old"); found {
+		t.Errorf("expected expired result to be dropped")
+	}
+	if _, found, _ := store.Get("new"); !found {
+		t.Errorf("expected recent result to be kept")
+	}
+	if results, _ := store.Query(ResultQuery{}); len(results) != 1 {
+		t.Errorf("expected 1 result, got %d", len(results))
+	}
+}
+
+func TestResultPermalink(t *testing.T) {
+	useTestResultStore(t, newMemoryResultStore(100, 0))
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("OK"))
+	}))
+	defer server.Close()
+
+	// Run a test with a secret header
+	req := httptest.NewRequest(http.MethodPost, "/api/test", strings.NewReader(`{"url": "`+server.URL+`", "headers": {"Authorization": "Bearer secret"}}`))
+	w := httptest.NewRecorder()
+	testURLHandler(w, req)
+
+	var response TestResponse
+	json.NewDecoder(w.Body).Decode(&response)
+	if response.ID == "" || response.Permalink != "/r/"+response.ID {
+		t.Fatalf("expected id and permalink, got %q and %q", response.ID, response.Permalink)
+	}
+
+	// Fetch the stored result
+	req = httptest.NewRequest(http.MethodGet, "/api/results/"+response.ID, nil)
+	w = httptest.NewRecorder()
+	resultHandler(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status code 200, got %d", w.Code)
+	}
+	var stored StoredResult
+	json.NewDecoder(w.Body).Decode(&stored)
+	if stored.ID != response.ID || stored.Response.ID != response.ID || stored.Response.StatusCode != http.StatusOK {
+		t.Errorf("unexpected stored result: %+v", stored)
+	}
+	if stored.Request.Headers["Authorization"] != redactedValue {
+		t.Errorf("expected Authorization to be redacted, got %q", stored.Request.Headers["Authorization"])
+	}
+
+	// Unknown results
+	req = httptest.NewRequest(http.MethodGet, "/api/results/unknown", nil)
+	w = httptest.NewRecorder()
+	resultHandler(w, req)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("expected status code 404, got %d", w.Code)
+	}
+
+	// The permalink serves the UI
+	req = httptest.NewRequest(http.MethodGet, response.Permalink, nil)
+	w = httptest.NewRecorder()
+	permalinkHandler(w, req)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "<html") {
+		t.Errorf("expected the UI page, got %d", w.Code)
+	}
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RateLimit is the rate limit state a server reported in its response headers
+type RateLimit struct {
+	Limit         *int64     `json:"limit,omitempty"`         // requests allowed per window
+	Remaining     *int64     `json:"remaining,omitempty"`     // requests left in the current window
+	WindowSeconds *int64     `json:"windowSeconds,omitempty"` // length of the window
+	Reset         *time.Time `json:"reset,omitempty"`         // when the window resets
+	ResetSeconds  *int64     `json:"resetSeconds,omitempty"`  // seconds until the window resets
+	// RetryAfterSeconds and RetryAt come from Retry-After, given in seconds or as an HTTP date
+	RetryAfterSeconds *int64     `json:"retryAfterSeconds,omitempty"`
+	RetryAt           *time.Time `json:"retryAt,omitempty"`
+	Policy            string     `json:"policy,omitempty"` // RateLimit-Policy as sent
+	Source            string     `json:"source,omitempty"` // header family: RateLimit, X-RateLimit or X-Rate-Limit
+	Throttled         bool       `json:"throttled"`        // 429, 503 with Retry-After, or nothing remaining
+}
+
+// rateLimitFamilies are the header prefixes read for limit, remaining and reset, in order of preference
+// RateLimit-Reset is always a delay; the X- families also use Unix timestamps
+var rateLimitFamilies = []string{"RateLimit", "X-RateLimit", "X-Rate-Limit"}
+
+// parseRateLimit interprets the rate limit headers of a response
+// It returns nil when the response has none and was not throttled
+func parseRateLimit(statusCode int, header http.Header, received time.Time) *RateLimit {
+	// Relative times are computed against the server's clock when it sends one
+	now := received
+	if date, err := http.ParseTime(header.Get("Date")); err == nil {
+		now = date
+	}
+
+	rl := &RateLimit{}
+	found := false
+
+	if value := header.Get("Retry-After"); value != "" {
+		if seconds, ok := parseRetryAfter(value, now); ok {
+			rl.RetryAfterSeconds = &seconds
+			at := received.Add(time.Duration(seconds) * time.Second).UTC().Truncate(time.Second)
+			rl.RetryAt = &at
+			found = true
+		}
+	}
+
+	// Structured fields of the IETF draft: RateLimit: limit=100, remaining=50, reset=30
+	// or, in later versions, RateLimit: "default";r=50;t=30 with RateLimit-Policy: "default";q=100;w=60
+	if value := header.Get("RateLimit"); value != "" {
+		params := rateLimitParams(value)
+		rl.setLimit(params, "limit", "q")
+		rl.setRemaining(params, "remaining", "r")
+		if reset, ok := params.int("reset", "t"); ok {
+			rl.setReset(reset, false, now, received)
+		}
+		rl.Source = "RateLimit"
+		found = true
+	}
+	if value := header.Get("RateLimit-Policy"); value != "" {
+		rl.Policy = value
+		params := rateLimitParams(value)
+		rl.setLimit(params, "q")
+		if n, ok := leadingInt(value); ok && rl.Limit == nil {
+			rl.Limit = &n // 100;w=60
+		}
+		if w, ok := params.int("w"); ok {
+			rl.WindowSeconds = &w
+		}
+		rl.Source = "RateLimit"
+		found = true
+	}
+
+	for _, family := range rateLimitFamilies {
+		limit, hasLimit := leadingInt(header.Get(family + "-Limit"))
+		remaining, hasRemaining := leadingInt(header.Get(family + "-Remaining"))
+		reset, hasReset := leadingInt(header.Get(family + "-Reset"))
+		if !hasLimit && !hasRemaining && !hasReset {
+			continue
+		}
+		if hasLimit && rl.Limit == nil {
+			rl.Limit = &limit
+			// RateLimit-Limit: 100, 100;w=60
+			if w, ok := rateLimitParams(header.Get(family + "-Limit")).int("w"); ok && rl.WindowSeconds == nil {
+				rl.WindowSeconds = &w
+			}
+		}
+		if hasRemaining && rl.Remaining == nil {
+			rl.Remaining = &remaining
+		}
+		if hasReset && rl.Reset == nil {
+			rl.setReset(reset, family != "RateLimit", now, received)
+		}
+		if rl.Source == "" {
+			rl.Source = family
+		}
+		found = true
+	}
+
+	rl.Throttled = statusCode == http.StatusTooManyRequests ||
+		statusCode == http.StatusServiceUnavailable && rl.RetryAfterSeconds != nil ||
+		rl.Remaining != nil && *rl.Remaining <= 0
+	if !found && !rl.Throttled {
+		return nil
+	}
+	return rl
+}
+
+// parseRetryAfter parses a Retry-After value: a number of seconds or an HTTP date
+func parseRetryAfter(value string, now time.Time) (int64, bool) {
+	value = strings.TrimSpace(value)
+	if seconds, err := strconv.ParseInt(value, 10, 64); err == nil && seconds >= 0 {
+		return seconds, true
+	}
+	at, err := http.ParseTime(value)
+	if err != nil {
+		return 0, false
+	}
+	seconds := int64(math.Ceil(at.Sub(now).Seconds()))
+	if seconds < 0 {
+		seconds = 0
+	}
+	return seconds, true
+}
+
+// setReset records a reset given as a delay in seconds or, when timestamps are allowed,
+// as a Unix time in seconds or milliseconds
+func (rl *RateLimit) setReset(value int64, allowTimestamp bool, now, received time.Time) {
+	seconds := value
+	switch {
+	case allowTimestamp && value >= 1e12:
+		seconds = int64(math.Ceil(time.UnixMilli(value).Sub(now).Seconds()))
+	case allowTimestamp && value >= 1e9:
+		seconds = value - now.Unix()
+	}
+	if seconds < 0 {
+		seconds = 0
+	}
+	reset := received.Add(time.Duration(seconds) * time.Second).UTC().Truncate(time.Second)
+	rl.Reset, rl.ResetSeconds = &reset, &seconds
+}
+
+// setLimit sets the limit from the first of keys present, unless it is known
+func (rl *RateLimit) setLimit(params rateLimitParamMap, keys ...string) {
+	if n, ok := params.int(keys...); ok && rl.Limit == nil {
+		rl.Limit = &n
+	}
+}
+
+// setRemaining sets the remaining requests from the first of keys present, unless they are known
+func (rl *RateLimit) setRemaining(params rateLimitParamMap, keys ...string) {
+	if n, ok := params.int(keys...); ok && rl.Remaining == nil {
+		rl.Remaining = &n
+	}
+}
+
+// rateLimitParamMap holds the key=value parameters of a rate limit header
+type rateLimitParamMap map[string]string
+
+// rateLimitParams reads the key=value parameters of a header, keeping the first value of each key
+func rateLimitParams(value string) rateLimitParamMap {
+	params := rateLimitParamMap{}
+	for _, part := range strings.FieldsFunc(value, func(r rune) bool { return r == ',' || r == ';' }) {
+		key, val, ok := strings.Cut(strings.TrimSpace(part), "=")
+		key = strings.ToLower(strings.TrimSpace(key))
+		if _, seen := params[key]; ok && !seen {
+			params[key] = strings.Trim(strings.TrimSpace(val), `"`)
+		}
+	}
+	return params
+}
+
+// int returns the first of keys with an integer value
+func (p rateLimitParamMap) int(keys ...string) (int64, bool) {
+	for _, key := range keys {
+		if n, err := strconv.ParseInt(p[key], 10, 64); err == nil {
+			return n, true
+		}
+	}
+	return 0, false
+}
+
+// leadingInt parses the integer at the start of a header value, as in "100" or "100, 100;w=60"
+func leadingInt(value string) (int64, bool) {
+	value = strings.TrimSpace(value)
+	end := strings.IndexAny(value, ",;")
+	if end >= 0 {
+		value = strings.TrimSpace(value[:end])
+	}
+	n, err := strconv.ParseInt(value, 10, 64)
+	return n, err == nil
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestParseRateLimit(t *testing.T) {
+	received := time.Date(2025, 1, 15, 10, 0, 0, 0, time.UTC)
+	n := func(v int64) *int64 { return &v }
+	at := func(seconds int) *time.Time {
+		t := received.Add(time.Duration(seconds) * time.Second)
+		return &t
+	}
+
+	tests := []struct {
+		name   string
+		status int
+		header http.Header
+		want   *RateLimit
+	}{
+		{
+			name:   "no headers",
+			status: 200,
+			header: http.Header{},
+		},
+		{
+			name:   "429 without headers",
+			status: 429,
+			header: http.Header{},
+			want:   &RateLimit{Throttled: true},
+		},
+		{
+			name:   "retry after seconds",
+			status: 429,
+			header: http.Header{"Retry-After": {"120"}},
+			want:   &RateLimit{RetryAfterSeconds: n(120), RetryAt: at(120), Throttled: true},
+		},
+		{
+			name:   "retry after date uses the server clock",
+			status: 503,
+			header: http.Header{
+				"Date":        {"Wed, 15 Jan 2025 09:59:00 GMT"},
+				"Retry-After": {"Wed, 15 Jan 2025 10:00:30 GMT"},
+			},
+			want: &RateLimit{RetryAfterSeconds: n(90), RetryAt: at(90), Throttled: true},
+		},
+		{
+			name:   "retry after date in the past",
+			status: 503,
+			header: http.Header{"Retry-After": {"Wed, 15 Jan 2025 09:00:00 GMT"}},
+			want:   &RateLimit{RetryAfterSeconds: n(0), RetryAt: at(0), Throttled: true},
+		},
+		{
+			name:   "invalid retry after",
+			status: 200,
+			header: http.Header{"Retry-After": {"soon"}},
+		},
+		{
+			name:   "github style with a unix reset",
+			status: 200,
+			header: http.Header{
+				"X-Ratelimit-Limit":     {"5000"},
+				"X-Ratelimit-Remaining": {"4999"},
+				"X-Ratelimit-Reset":     {"1736935260"}, // received + 60s
+			},
+			want: &RateLimit{Limit: n(5000), Remaining: n(4999), Reset: at(60), ResetSeconds: n(60), Source: "X-RateLimit"},
+		},
+		{
+			name:   "unix reset in milliseconds",
+			status: 200,
+			header: http.Header{"X-Rate-Limit-Remaining": {"0"}, "X-Rate-Limit-Reset": {"1736935230000"}},
+			want:   &RateLimit{Remaining: n(0), Reset: at(30), ResetSeconds: n(30), Source: "X-Rate-Limit", Throttled: true},
+		},
+		{
+			name:   "ietf fields with a delay reset",
+			status: 200,
+			header: http.Header{
+				"Ratelimit-Limit":     {"100, 100;w=60"},
+				"Ratelimit-Remaining": {"42"},
+				"Ratelimit-Reset":     {"15"},
+			},
+			want: &RateLimit{Limit: n(100), Remaining: n(42), WindowSeconds: n(60), Reset: at(15), ResetSeconds: n(15), Source: "RateLimit"},
+		},
+		{
+			name:   "ietf structured header",
+			status: 200,
+			header: http.Header{
+				"Ratelimit":        {`"default";r=0;t=25`},
+				"Ratelimit-Policy": {`"default";q=100;w=60`},
+			},
+			want: &RateLimit{Limit: n(100), Remaining: n(0), WindowSeconds: n(60), Reset: at(25), ResetSeconds: n(25), Policy: `"default";q=100;w=60`, Source: "RateLimit", Throttled: true},
+		},
+		{
+			name:   "ietf combined header",
+			status: 200,
+			header: http.Header{"Ratelimit": {"limit=10, remaining=9, reset=5"}},
+			want:   &RateLimit{Limit: n(10), Remaining: n(9), Reset: at(5), ResetSeconds: n(5), Source: "RateLimit"},
+		},
+		{
+			name:   "ietf fields win over x- fields",
+			status: 200,
+			header: http.Header{
+				"Ratelimit-Remaining":   {"7"},
+				"X-Ratelimit-Remaining": {"8"},
+				"X-Ratelimit-Limit":     {"10"},
+			},
+			want: &RateLimit{Limit: n(10), Remaining: n(7), Source: "RateLimit"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := parseRateLimit(tt.status, tt.header, received)
+			if (got == nil) != (tt.want == nil) {
+				t.Fatalf("parseRateLimit() = %+v, want %+v", got, tt.want)
+			}
+			if got == nil {
+				return
+			}
+			if !equalInt64Ptr(got.Limit, tt.want.Limit) || !equalInt64Ptr(got.Remaining, tt.want.Remaining) ||
+				!equalInt64Ptr(got.WindowSeconds, tt.want.WindowSeconds) || !equalInt64Ptr(got.ResetSeconds, tt.want.ResetSeconds) ||
+				!equalInt64Ptr(got.RetryAfterSeconds, tt.want.RetryAfterSeconds) ||
+				!equalTimePtr(got.Reset, tt.want.Reset) || !equalTimePtr(got.RetryAt, tt.want.RetryAt) ||
+				got.Policy != tt.want.Policy || got.Source != tt.want.Source || got.Throttled != tt.want.Throttled {
+				t.Errorf("parseRateLimit() = %s, want %s", describeRateLimit(got), describeRateLimit(tt.want))
+			}
+		})
+	}
+}
+
+func TestTestURLRateLimit(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "30")
+		w.Header().Set("X-RateLimit-Remaining", "0")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer server.Close()
+
+	response := testURL(TestRequest{URL: server.URL})
+	if response.RateLimit == nil || !response.RateLimit.Throttled || *response.RateLimit.RetryAfterSeconds != 30 || *response.RateLimit.Remaining != 0 {
+		t.Errorf("unexpected rate limit %+v", response.RateLimit)
+	}
+}
+
+func equalInt64Ptr(a, b *int64) bool {
+	return a == nil && b == nil || a != nil && b != nil && *a == *b
+}
+
+func equalTimePtr(a, b *time.Time) bool {
+	return a == nil && b == nil || a != nil && b != nil && a.Equal(*b)
+}
+
+// describeRateLimit formats a rate limit with its pointer values for test failures
+func describeRateLimit(rl *RateLimit) string {
+	value := func(p *int64) interface{} {
+		if p == nil {
+			return nil
+		}
+		return *p
+	}
+	return fmt.Sprintf("{limit:%v remaining:%v window:%v resetSeconds:%v reset:%v retryAfter:%v retryAt:%v policy:%q source:%q throttled:%v}",
+		value(rl.Limit), value(rl.Remaining), value(rl.WindowSeconds), value(rl.ResetSeconds), rl.Reset,
+		value(rl.RetryAfterSeconds), rl.RetryAt, rl.Policy, rl.Source, rl.Throttled)
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// defaultMaxRedirects matches the limit used by net/http
+const defaultMaxRedirects = 10
+
+// maxAllowedRedirects caps the redirect limit a client may request
+const maxAllowedRedirects = 50
+
+// Redirect policy violation reasons reported in TestResponse.RedirectViolation
+const (
+	redirectTooMany   = "too_many_redirects"
+	redirectLoop      = "redirect_loop"
+	redirectCrossHost = "cross_host_redirect"
+	redirectDowngrade = "insecure_redirect"
+)
+
+// redirectError is returned from CheckRedirect when a redirect violates the request's policy
+type redirectError struct {
+	Reason string
+	From   string
+	To     string
+	Limit  int
+}
+
+func (e *redirectError) Error() string {
+	switch e.Reason {
+	case redirectTooMany:
+		return fmt.Sprintf("stopped after %d redirects", e.Limit)
+	case redirectLoop:
+		return fmt.Sprintf("redirect loop detected: %s was already visited", e.To)
+	case redirectCrossHost:
+		return fmt.Sprintf("redirect to another host not allowed: %s -> %s", e.From, e.To)
+	case redirectDowngrade:
+		return fmt.Sprintf("redirect from https to http not allowed: %s -> %s", e.From, e.To)
+	}
+	return "redirect not allowed: " + e.To
+}
+
+// followsRedirects reports whether redirects should be followed for a test request
+func followsRedirects(req TestRequest) bool {
+	return req.FollowRedirects == nil || *req.FollowRedirects
+}
+
+// maxRedirects returns the maximum number of redirects to follow for a test request
+func maxRedirects(req TestRequest) int {
+	if req.MaxRedirects > 0 {
+		return req.MaxRedirects
+	}
+	return defaultMaxRedirects
+}
+
+// validateRedirectPolicy checks the redirect options of a test request
+// Returns an error message if the options are invalid, or empty string if valid
+func validateRedirectPolicy(req TestRequest) string {
+	if req.MaxRedirects < 0 || req.MaxRedirects > maxAllowedRedirects {
+		return fmt.Sprintf("maxRedirects must be between 0 and %d", maxAllowedRedirects)
+	}
+	return ""
+}
+
+// redirectPolicy builds the CheckRedirect function enforcing the request's redirect options
+func redirectPolicy(testReq TestRequest) func(req *http.Request, via []*http.Request) error {
+	follow := followsRedirects(testReq)
+	limit := maxRedirects(testReq)
+
+	return func(req *http.Request, via []*http.Request) error {
+		// Return the redirect response itself so it can be inspected
+		if !follow {
+			return http.ErrUseLastResponse
+		}
+
+		prev := via[len(via)-1]
+		from, to := prev.URL.String(), req.URL.String()
+
+		for _, visited := range via {
+			if visited.URL.String() == to {
+				return &redirectError{Reason: redirectLoop, From: from, To: to}
+			}
+		}
+		if len(via) > limit {
+			return &redirectError{Reason: redirectTooMany, From: from, To: to, Limit: limit}
+		}
+		if testReq.SameHostOnly && req.URL.Host != prev.URL.Host {
+			return &redirectError{Reason: redirectCrossHost, From: from, To: to}
+		}
+		if testReq.NoDowngrade && prev.URL.Scheme == "https" && req.URL.Scheme == "http" {
+			return &redirectError{Reason: redirectDowngrade, From: from, To: to}
+		}
+		return nil
+	}
+}
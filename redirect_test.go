@@ -0,0 +1,145 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestRedirectPolicy(t *testing.T) {
+	// /hop/N redirects to /hop/N-1 until /hop/0, /loop/a <-> /loop/b loops forever
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case strings.HasPrefix(r.URL.Path, "/hop/"):
+			n, _ := strconv.Atoi(strings.TrimPrefix(r.URL.Path, "/hop/"))
+			if n == 0 {
+				w.Write([]byte("arrived"))
+				return
+			}
+			http.Redirect(w, r, fmt.Sprintf("/hop/%d", n-1), http.StatusFound)
+		case r.URL.Path == "/loop/a":
+			http.Redirect(w, r, "/loop/b", http.StatusFound)
+		case r.URL.Path == "/loop/b":
+			http.Redirect(w, r, "/loop/a", http.StatusFound)
+		case r.URL.Path == "/external":
+			http.Redirect(w, r, "http://other.invalid/", http.StatusFound)
+		}
+	}))
+	defer server.Close()
+
+	noFollow := false
+
+	// Test redirect response is returned as-is when following is disabled
+	t.Run("no follow", func(t *testing.T) {
+		response := testURL(TestRequest{URL: server.URL + "/hop/2", FollowRedirects: &noFollow})
+
+		if !response.Success {
+			t.Fatalf("expected success, got failure: %s", response.Error)
+		}
+		if response.StatusCode != http.StatusFound {
+			t.Errorf("expected status code 302, got %d", response.StatusCode)
+		}
+		if response.Headers["Location"] != "/hop/1" {
+			t.Errorf("expected Location header /hop/1, got %q", response.Headers["Location"])
+		}
+		if response.FinalURL != server.URL+"/hop/2" {
+			t.Errorf("expected final URL to be the requested URL, got %q", response.FinalURL)
+		}
+		if len(response.Redirects) != 0 {
+			t.Errorf("expected no followed redirects, got %d", len(response.Redirects))
+		}
+	})
+
+	// Test hops within the limit are followed
+	t.Run("within max redirects", func(t *testing.T) {
+		response := testURL(TestRequest{URL: server.URL + "/hop/3", MaxRedirects: 3})
+
+		if !response.Success {
+			t.Fatalf("expected success, got failure: %s", response.Error)
+		}
+		if len(response.Redirects) != 3 {
+			t.Errorf("expected 3 redirects, got %d", len(response.Redirects))
+		}
+	})
+
+	// Test exceeding the limit
+	t.Run("too many redirects", func(t *testing.T) {
+		response := testURL(TestRequest{URL: server.URL + "/hop/5", MaxRedirects: 2})
+
+		if response.Success {
+			t.Fatalf("expected failure")
+		}
+		if response.RedirectViolation != redirectTooMany {
+			t.Errorf("expected violation %q, got %q", redirectTooMany, response.RedirectViolation)
+		}
+		if response.Error != "redirect error: stopped after 2 redirects" {
+			t.Errorf("unexpected error message %q", response.Error)
+		}
+		if len(response.Redirects) != 3 {
+			t.Errorf("expected 3 recorded redirect responses, got %d", len(response.Redirects))
+		}
+	})
+
+	// Test loop detection
+	t.Run("redirect loop", func(t *testing.T) {
+		response := testURL(TestRequest{URL: server.URL + "/loop/a"})
+
+		if response.Success {
+			t.Fatalf("expected failure")
+		}
+		if response.RedirectViolation != redirectLoop {
+			t.Errorf("expected violation %q, got %q", redirectLoop, response.RedirectViolation)
+		}
+		if !strings.Contains(response.Error, "redirect loop detected") {
+			t.Errorf("unexpected error message %q", response.Error)
+		}
+	})
+
+	// Test cross-host restriction
+	t.Run("same host only", func(t *testing.T) {
+		response := testURL(TestRequest{URL: server.URL + "/external", SameHostOnly: true})
+
+		if response.Success {
+			t.Fatalf("expected failure")
+		}
+		if response.RedirectViolation != redirectCrossHost {
+			t.Errorf("expected violation %q, got %q", redirectCrossHost, response.RedirectViolation)
+		}
+	})
+}
+
+func TestRedirectPolicyDowngrade(t *testing.T) {
+	check := redirectPolicy(TestRequest{URL: "https://example.com", NoDowngrade: true})
+
+	prev, _ := http.NewRequest(http.MethodGet, "https://example.com/", nil)
+	next, _ := http.NewRequest(http.MethodGet, "http://example.com/", nil)
+
+	err := check(next, []*http.Request{prev})
+	redirectErr, ok := err.(*redirectError)
+	if !ok {
+		t.Fatalf("expected redirectError, got %v", err)
+	}
+	if redirectErr.Reason != redirectDowngrade {
+		t.Errorf("expected reason %q, got %q", redirectDowngrade, redirectErr.Reason)
+	}
+
+	secure, _ := http.NewRequest(http.MethodGet, "https://www.example.com/", nil)
+	if err := check(secure, []*http.Request{prev}); err != nil {
+		t.Errorf("expected https -> https redirect to be allowed, got %v", err)
+	}
+}
+
+func TestValidateRedirectPolicy(t *testing.T) {
+	if msg := validateRequest(TestRequest{URL: "https://example.com", MaxRedirects: -1}); msg == "" {
+		t.Errorf("expected error for negative maxRedirects")
+	}
+	if msg := validateRequest(TestRequest{URL: "https://example.com", MaxRedirects: 51}); msg == "" {
+		t.Errorf("expected error for maxRedirects above limit")
+	}
+	if msg := validateRequest(TestRequest{URL: "https://example.com", MaxRedirects: 5}); msg != "" {
+		t.Errorf("expected no error, got %q", msg)
+	}
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// maxResolveOverrides is the most resolve overrides a test request may have
+const maxResolveOverrides = 10
+
+// resolveOverride pins connections to host:port to a fixed address, like curl --resolve
+type resolveOverride struct {
+	host string // lowercase, without brackets
+	port string
+	ip   string
+}
+
+// parseResolveOverride parses "host:port:address"; IPv6 hosts and addresses may be bracketed
+func parseResolveOverride(spec string) (resolveOverride, error) {
+	invalid := fmt.Errorf("invalid resolve override %q (expected host:port:address)", spec)
+
+	var host, rest string
+	if strings.HasPrefix(spec, "[") {
+		end := strings.Index(spec, "]:")
+		if end < 0 {
+			return resolveOverride{}, invalid
+		}
+		host, rest = spec[1:end], spec[end+2:]
+	} else {
+		var ok bool
+		if host, rest, ok = strings.Cut(spec, ":"); !ok {
+			return resolveOverride{}, invalid
+		}
+	}
+	port, address, ok := strings.Cut(rest, ":")
+	if !ok || host == "" {
+		return resolveOverride{}, invalid
+	}
+	if n, err := strconv.Atoi(port); err != nil || n < 1 || n > 65535 {
+		return resolveOverride{}, invalid
+	}
+	address = strings.TrimSuffix(strings.TrimPrefix(address, "["), "]")
+	ip := net.ParseIP(address)
+	if ip == nil {
+		return resolveOverride{}, fmt.Errorf("invalid resolve override %q: %q is not an IP address", spec, address)
+	}
+	return resolveOverride{host: strings.ToLower(host), port: port, ip: ip.String()}, nil
+}
+
+// validateResolve checks the resolve overrides of a request
+func validateResolve(resolve []string) string {
+	if len(resolve) > maxResolveOverrides {
+		return fmt.Sprintf("At most %d resolve overrides are allowed", maxResolveOverrides)
+	}
+	for _, spec := range resolve {
+		if _, err := parseResolveOverride(spec); err != nil {
+			return err.Error()
+		}
+	}
+	return ""
+}
+
+// resolvingDialContext wraps dial so connections to an overridden host:port go to its address
+// The SSRF guard still checks the address that is actually dialed
+func resolvingDialContext(dial func(ctx context.Context, network, address string) (net.Conn, error), resolve []string) func(ctx context.Context, network, address string) (net.Conn, error) {
+	var overrides []resolveOverride
+	for _, spec := range resolve {
+		if o, err := parseResolveOverride(spec); err == nil {
+			overrides = append(overrides, o)
+		}
+	}
+	if len(overrides) == 0 {
+		return dial
+	}
+
+	return func(ctx context.Context, network, address string) (net.Conn, error) {
+		host, port, err := net.SplitHostPort(address)
+		if err == nil {
+			for _, o := range overrides {
+				if o.host == strings.ToLower(host) && o.port == port {
+					address = net.JoinHostPort(o.ip, port)
+					break
+				}
+			}
+		}
+		return dial(ctx, network, address)
+	}
+}
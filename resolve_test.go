@@ -0,0 +1,85 @@
+package main
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestParseResolveOverride(t *testing.T) {
+	tests := []struct {
+		spec    string
+		want    resolveOverride
+		wantErr bool
+	}{
+		{"Example.com:443:203.0.113.10", resolveOverride{"example.com", "443", "203.0.113.10"}, false},
+		{"example.com:80:2001:db8::1", resolveOverride{"example.com", "80", "2001:db8::1"}, false},
+		{"example.com:80:[2001:db8::1]", resolveOverride{"example.com", "80", "2001:db8::1"}, false},
+		{"[::1]:8080:127.0.0.1", resolveOverride{"::1", "8080", "127.0.0.1"}, false},
+		{"example.com:443", resolveOverride{}, true},
+		{"example.com:0:127.0.0.1", resolveOverride{}, true},
+		{"example.com:https:127.0.0.1", resolveOverride{}, true},
+		{":443:127.0.0.1", resolveOverride{}, true},
+		{"example.com:443:other.example", resolveOverride{}, true},
+	}
+
+	for _, tt := range tests {
+		got, err := parseResolveOverride(tt.spec)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseResolveOverride(%q) error = %v, wantErr %v", tt.spec, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("parseResolveOverride(%q) = %+v, want %+v", tt.spec, got, tt.want)
+		}
+	}
+}
+
+func TestResolveOverride(t *testing.T) {
+	var host string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host = r.Host
+	}))
+	defer server.Close()
+	_, port, _ := net.SplitHostPort(server.Listener.Addr().String())
+
+	response := testURL(TestRequest{
+		URL:     "http://pinned.example.invalid:" + port + "/",
+		Resolve: []string{"pinned.example.invalid:" + port + ":127.0.0.1"},
+	})
+	if !response.Success || response.StatusCode != http.StatusOK {
+		t.Fatalf("expected pinned request to succeed, got %+v", response)
+	}
+	if host != "pinned.example.invalid:"+port {
+		t.Errorf("expected the original Host header, got %q", host)
+	}
+
+	// The override goes through the SSRF guard like any other address
+	saved := destinationPolicy
+	defer func() { destinationPolicy = saved }()
+	destinationPolicy = mustNetworkPolicy(nil, defaultDeniedCIDRs)
+	response = testURL(TestRequest{
+		URL:     "http://public.example:" + port + "/",
+		Resolve: []string{"public.example:" + port + ":127.0.0.1"},
+	})
+	if response.Success || !response.BlockedByPolicy {
+		t.Errorf("expected pinned loopback address to be blocked, got %+v", response)
+	}
+}
+
+func TestValidateResolve(t *testing.T) {
+	if msg := validateRequest(TestRequest{URL: "https://example.com", Resolve: []string{"example.com:443:127.0.0.1"}}); msg != "" {
+		t.Errorf("unexpected error %q", msg)
+	}
+	if msg := validateRequest(TestRequest{URL: "https://example.com", Resolve: []string{"bad"}}); msg == "" {
+		t.Error("expected invalid resolve override to be rejected")
+	}
+	tooMany := make([]string, maxResolveOverrides+1)
+	for i := range tooMany {
+		tooMany[i] = "example.com:443:127.0.0.1"
+	}
+	if msg := validateResolve(tooMany); msg == "" {
+		t.Error("expected too many resolve overrides to be rejected")
+	}
+}
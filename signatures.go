@@ -0,0 +1,372 @@
+package main
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// defaultSignaturesJSON holds the built-in block signatures
+//
+//go:embed signatures.json
+var defaultSignaturesJSON []byte
+
+// signaturesPollInterval is how often the signatures file is checked for changes
+var signaturesPollInterval = 5 * time.Second
+
+// Sources of a signature reported by GET /api/signatures
+const signatureSourceBuiltin = "builtin"
+
+// SignatureFile is the format of the built-in signatures and of SIGNATURES_FILE
+type SignatureFile struct {
+	Signatures []SignatureRule `json:"signatures"`
+}
+
+// SignatureRule fingerprints the block pages of a vendor
+// A response matches when a body regex matches together with a header, cookie or status,
+// when a body regex matches on an error status, or when a header or cookie matches with a status
+type SignatureRule struct {
+	Name     string                `json:"name"`
+	Vendor   string                `json:"vendor,omitempty"`
+	Reason   string                `json:"reason,omitempty"`   // challenge, captcha or access_denied
+	Severity string                `json:"severity,omitempty"` // highest confidence reported: high (default), medium or low
+	Status   StatusList            `json:"status,omitempty"`   // statuses of blocks: "403", "4xx" or "400-499"
+	Headers  []SignatureHeaderRule `json:"headers,omitempty"`  // show that the vendor served the response
+	Cookies  []string              `json:"cookies,omitempty"`  // regexes of Set-Cookie names set by the vendor
+	Body     []string              `json:"body,omitempty"`     // regexes of block page markers
+	Disabled bool                  `json:"disabled,omitempty"` // removes a built-in rule of the same name
+	Source   string                `json:"source,omitempty"`   // builtin or the file the rule was loaded from
+}
+
+// StatusList is a list of status specs that also reads plain numbers, as in YAML's [403, 429]
+type StatusList []string
+
+// UnmarshalJSON implements json.Unmarshaler
+func (l *StatusList) UnmarshalJSON(data []byte) error {
+	var values []interface{}
+	if err := json.Unmarshal(data, &values); err != nil {
+		return err
+	}
+	list := make(StatusList, 0, len(values))
+	for _, value := range values {
+		switch v := value.(type) {
+		case float64:
+			list = append(list, strconv.FormatFloat(v, 'f', -1, 64))
+		case string:
+			list = append(list, v)
+		default:
+			return fmt.Errorf("invalid status %v", value)
+		}
+	}
+	*l = list
+	return nil
+}
+
+// SignatureHeaderRule matches a response header
+type SignatureHeaderRule struct {
+	Name  string `json:"name"`
+	Regex string `json:"regex,omitempty"` // matched against the value; without it the header only has to be present
+}
+
+// blockSignature is a compiled signature rule
+type blockSignature struct {
+	Name     string
+	Vendor   string
+	Reason   string
+	Severity string
+	statuses []statusRange
+	headers  []headerMarker
+	cookies  []*regexp.Regexp
+	body     []*regexp.Regexp
+}
+
+// headerMarker matches a header; a nil value matches any value
+type headerMarker struct {
+	name  string
+	value *regexp.Regexp
+}
+
+// compileSignature validates a rule and compiles its matchers
+func compileSignature(rule SignatureRule) (blockSignature, error) {
+	sig := blockSignature{Name: rule.Name, Vendor: rule.Vendor, Reason: rule.Reason, Severity: rule.Severity}
+	if rule.Name == "" {
+		return sig, fmt.Errorf("signature without a name")
+	}
+	fail := func(format string, args ...interface{}) (blockSignature, error) {
+		return sig, fmt.Errorf("signature %s: %s", rule.Name, fmt.Sprintf(format, args...))
+	}
+
+	if sig.Reason == "" {
+		sig.Reason = blockReasonAccessDenied
+	}
+	switch sig.Reason {
+	case blockReasonChallenge, blockReasonCaptcha, blockReasonAccessDenied, blockReasonRateLimited:
+	default:
+		return fail("invalid reason %q (use %s, %s, %s or %s)", sig.Reason, blockReasonChallenge, blockReasonCaptcha, blockReasonAccessDenied, blockReasonRateLimited)
+	}
+	if sig.Severity == "" {
+		sig.Severity = confidenceHigh
+	}
+	if confidenceRank(sig.Severity) == 0 {
+		return fail("invalid severity %q (use %s, %s or %s)", sig.Severity, confidenceHigh, confidenceMedium, confidenceLow)
+	}
+	if len(rule.Body) == 0 && len(rule.Headers) == 0 && len(rule.Cookies) == 0 {
+		return fail("needs body, header or cookie matchers")
+	}
+
+	for _, spec := range rule.Status {
+		r, err := parseStatusRange(spec)
+		if err != nil {
+			return fail("%v", err)
+		}
+		sig.statuses = append(sig.statuses, r)
+	}
+	for _, h := range rule.Headers {
+		if !isValidHeaderName(h.Name) {
+			return fail("invalid header name %q", h.Name)
+		}
+		marker := headerMarker{name: http.CanonicalHeaderKey(h.Name)}
+		if h.Regex != "" {
+			re, err := regexp.Compile(h.Regex)
+			if err != nil {
+				return fail("invalid regex for header %s: %v", h.Name, err)
+			}
+			marker.value = re
+		}
+		sig.headers = append(sig.headers, marker)
+	}
+	for _, pattern := range rule.Cookies {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return fail("invalid cookie regex: %v", err)
+		}
+		sig.cookies = append(sig.cookies, re)
+	}
+	for _, pattern := range rule.Body {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return fail("invalid body regex: %v", err)
+		}
+		sig.body = append(sig.body, re)
+	}
+	return sig, nil
+}
+
+// parseSignatureFile reads the rules of a signatures file and labels them with their source
+func parseSignatureFile(data []byte, source string) ([]SignatureRule, error) {
+	var file SignatureFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("invalid signatures file %s: %v", source, err)
+	}
+	seen := map[string]bool{}
+	for i := range file.Signatures {
+		rule := &file.Signatures[i]
+		if seen[rule.Name] {
+			return nil, fmt.Errorf("invalid signatures file %s: duplicate signature %s", source, rule.Name)
+		}
+		seen[rule.Name] = true
+		rule.Source = source
+	}
+	return file.Signatures, nil
+}
+
+// yamlToJSON converts a YAML document to JSON so it is decoded like a JSON signatures file
+func yamlToJSON(data []byte) ([]byte, error) {
+	var doc interface{}
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	return json.Marshal(doc)
+}
+
+// mergeSignatureRules puts the rules of a file before the built-in rules, which they replace
+// by name; disabled file rules only remove the built-in rule
+func mergeSignatureRules(builtin, custom []SignatureRule) []SignatureRule {
+	replaced := map[string]bool{}
+	merged := []SignatureRule{}
+	for _, rule := range custom {
+		replaced[rule.Name] = true
+		if !rule.Disabled {
+			merged = append(merged, rule)
+		}
+	}
+	for _, rule := range builtin {
+		if !replaced[rule.Name] {
+			merged = append(merged, rule)
+		}
+	}
+	return merged
+}
+
+// signatureRegistry holds the active block signatures, optionally reloaded from a file
+type signatureRegistry struct {
+	mu       sync.RWMutex
+	rules    []SignatureRule
+	compiled []blockSignature
+	file     string
+	modTime  time.Time
+	size     int64
+	loadedAt time.Time
+	lastErr  string
+}
+
+// signatures are the block signatures used by detectBlock
+var signatures = newSignatureRegistry()
+
+// newSignatureRegistry returns a registry with the built-in signatures
+func newSignatureRegistry() *signatureRegistry {
+	r := &signatureRegistry{}
+	if err := r.load(); err != nil {
+		panic(err) // the embedded file is covered by tests
+	}
+	return r
+}
+
+// current returns the compiled signatures in match order
+func (r *signatureRegistry) current() []blockSignature {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.compiled
+}
+
+// setFile sets the signatures file and loads it
+func (r *signatureRegistry) setFile(file string) error {
+	r.mu.Lock()
+	r.file = file
+	r.mu.Unlock()
+	return r.load()
+}
+
+// load compiles the built-in signatures and those of the file, if set
+// On error the previous signatures stay active
+func (r *signatureRegistry) load() error {
+	r.mu.RLock()
+	file := r.file
+	r.mu.RUnlock()
+
+	rules, err := parseSignatureFile(defaultSignaturesJSON, signatureSourceBuiltin)
+	if err != nil {
+		return err
+	}
+
+	var modTime time.Time
+	var size int64
+	if file != "" {
+		info, err := os.Stat(file)
+		if err != nil {
+			return err
+		}
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		ext := strings.ToLower(filepath.Ext(file))
+		if ext == ".yaml" || ext == ".yml" {
+			if data, err = yamlToJSON(data); err != nil {
+				return fmt.Errorf("invalid signatures file %s: %v", file, err)
+			}
+		}
+		custom, err := parseSignatureFile(data, file)
+		if err != nil {
+			return err
+		}
+		rules = mergeSignatureRules(rules, custom)
+		modTime, size = info.ModTime(), info.Size()
+	}
+
+	compiled := make([]blockSignature, 0, len(rules))
+	for _, rule := range rules {
+		sig, err := compileSignature(rule)
+		if err != nil {
+			return err
+		}
+		compiled = append(compiled, sig)
+	}
+
+	r.mu.Lock()
+	r.rules, r.compiled = rules, compiled
+	r.modTime, r.size = modTime, size
+	r.loadedAt = time.Now()
+	r.lastErr = ""
+	r.mu.Unlock()
+	return nil
+}
+
+// changed reports whether the signatures file was modified since it was loaded
+func (r *signatureRegistry) changed() bool {
+	r.mu.RLock()
+	file, modTime, size := r.file, r.modTime, r.size
+	r.mu.RUnlock()
+	if file == "" {
+		return false
+	}
+	info, err := os.Stat(file)
+	if err != nil {
+		return true // report the missing file through load
+	}
+	return !info.ModTime().Equal(modTime) || info.Size() != size
+}
+
+// reload loads the signatures file again if it changed, keeping the previous rules on error
+func (r *signatureRegistry) reload() {
+	if !r.changed() {
+		return
+	}
+	err := r.load()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err != nil {
+		if r.lastErr != err.Error() {
+			slog.Error("Failed to reload signatures, keeping previous rules", "file", r.file, "error", err)
+		}
+		r.lastErr = err.Error()
+		return
+	}
+	slog.Info("Reloaded signatures", "file", r.file, "signatures", len(r.rules))
+}
+
+// watch reloads the signatures file whenever it changes
+func (r *signatureRegistry) watch() {
+	ticker := time.NewTicker(signaturesPollInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		r.reload()
+	}
+}
+
+// SignatureList is the response of GET /api/signatures
+type SignatureList struct {
+	File       string          `json:"file,omitempty"`
+	LoadedAt   time.Time       `json:"loadedAt"`
+	Error      string          `json:"error,omitempty"` // why the last reload failed
+	Signatures []SignatureRule `json:"signatures"`
+}
+
+// signaturesHandler handles GET /api/signatures
+func signaturesHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	signatures.mu.RLock()
+	list := SignatureList{
+		File:       signatures.file,
+		LoadedAt:   signatures.loadedAt.UTC(),
+		Error:      signatures.lastErr,
+		Signatures: signatures.rules,
+	}
+	signatures.mu.RUnlock()
+	writeJSON(w, http.StatusOK, list)
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// useTestSignatures replaces the active signatures for the duration of a test
+func useTestSignatures(t *testing.T, r *signatureRegistry) {
+	t.Helper()
+	previous := signatures
+	signatures = r
+	t.Cleanup(func() { signatures = previous })
+}
+
+// writeSignatures writes a signatures file and moves its modification time forward,
+// so a rewrite within the same second is still noticed
+func writeSignatures(t *testing.T, file, content string, modTime time.Time) {
+	t.Helper()
+	if err := os.WriteFile(file, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(file, modTime, modTime); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestBuiltinSignatures(t *testing.T) {
+	rules, err := parseSignatureFile(defaultSignaturesJSON, signatureSourceBuiltin)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, rule := range rules {
+		if _, err := compileSignature(rule); err != nil {
+			t.Errorf("built-in signature: %v", err)
+		}
+		if rule.Vendor == "" {
+			t.Errorf("built-in signature %s has no vendor", rule.Name)
+		}
+	}
+}
+
+func TestCompileSignature(t *testing.T) {
+	tests := []struct {
+		name    string
+		rule    SignatureRule
+		wantErr string
+	}{
+		{"valid", SignatureRule{Name: "a", Body: []string{"(?i)blocked"}, Status: []string{"4xx"}}, ""},
+		{"no name", SignatureRule{Body: []string{"x"}}, "without a name"},
+		{"no matchers", SignatureRule{Name: "a", Status: []string{"403"}}, "needs body"},
+		{"bad reason", SignatureRule{Name: "a", Reason: "nope", Body: []string{"x"}}, "invalid reason"},
+		{"bad severity", SignatureRule{Name: "a", Severity: "critical", Body: []string{"x"}}, "invalid severity"},
+		{"bad status", SignatureRule{Name: "a", Status: []string{"6xx"}, Body: []string{"x"}}, "invalid status"},
+		{"bad body regex", SignatureRule{Name: "a", Body: []string{"("}}, "invalid body regex"},
+		{"bad header name", SignatureRule{Name: "a", Headers: []SignatureHeaderRule{{Name: "bad name"}}}, "invalid header name"},
+		{"bad header regex", SignatureRule{Name: "a", Headers: []SignatureHeaderRule{{Name: "Server", Regex: "["}}}, "invalid regex"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sig, err := compileSignature(tt.rule)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("unexpected error %v", err)
+				}
+				if sig.Reason != blockReasonAccessDenied || sig.Severity != confidenceHigh {
+					t.Errorf("expected defaults, got %s/%s", sig.Reason, sig.Severity)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("expected error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestSignatureFile(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "signatures.json")
+	base := time.Now().Add(-time.Hour)
+	writeSignatures(t, file, `{"signatures": [
+		{"name": "acme-wall", "vendor": "acme", "reason": "challenge", "severity": "medium", "status": ["403"], "headers": [{"name": "X-Acme"}], "body": ["acme check"]},
+		{"name": "recaptcha", "disabled": true}
+	]}`, base)
+
+	r := &signatureRegistry{}
+	if err := r.setFile(file); err != nil {
+		t.Fatal(err)
+	}
+	useTestSignatures(t, r)
+
+	// File rules come first, and disabled rules remove the built-in rule
+	if r.rules[0].Name != "acme-wall" || r.rules[0].Source != file {
+		t.Errorf("expected the file rule first, got %+v", r.rules[0])
+	}
+	for _, rule := range r.rules {
+		if rule.Name == "recaptcha" {
+			t.Errorf("recaptcha should be disabled")
+		}
+	}
+
+	// Severity caps the confidence of a full match
+	detection := detectBlock(200, http.Header{}, []byte("<p>ACME check in progress</p>"))
+	if detection != nil {
+		t.Errorf("body regexes are case-sensitive unless (?i) is given, got %+v", detection)
+	}
+	detection = detectBlock(200, http.Header{"X-Acme": {"1"}}, []byte("<p>acme check in progress</p>"))
+	if detection == nil || detection.Vendor != "acme" || detection.Confidence != confidenceMedium || detection.Signature != "acme-wall" {
+		t.Errorf("unexpected detection %+v", detection)
+	}
+
+	// Changes are picked up; a broken file keeps the previous rules
+	writeSignatures(t, file, `{"signatures": [{"name": "acme-wall", "vendor": "acme2", "body": ["acme check"]}]}`, base.Add(time.Minute))
+	r.reload()
+	if r.rules[0].Vendor != "acme2" {
+		t.Errorf("expected reloaded rule, got %+v", r.rules[0])
+	}
+	writeSignatures(t, file, `{"signatures": [{"name": "acme-wall", "body": ["("]}]}`, base.Add(2*time.Minute))
+	r.reload()
+	if r.rules[0].Vendor != "acme2" || r.lastErr == "" {
+		t.Errorf("expected previous rules and an error, got %+v, %q", r.rules[0], r.lastErr)
+	}
+
+	// YAML files use the same schema
+	yamlFile := filepath.Join(t.TempDir(), "rules.yaml")
+	writeSignatures(t, yamlFile, "signatures:\n  - name: acme-wall\n    vendor: acme\n    status: [403, 429, 5xx]\n    headers:\n      - name: X-Acme\n        regex: \"^1$\"\n    body: [\"(?i)acme check\"]\n  - name: recaptcha\n    disabled: true\n", base)
+	yamlRegistry := &signatureRegistry{}
+	if err := yamlRegistry.setFile(yamlFile); err != nil {
+		t.Fatal(err)
+	}
+	if rule := yamlRegistry.rules[0]; rule.Name != "acme-wall" || rule.Vendor != "acme" || len(rule.Headers) != 1 || rule.Headers[0].Regex != "^1$" || strings.Join(rule.Status, ",") != "403,429,5xx" || rule.Source != yamlFile {
+		t.Errorf("unexpected YAML rule %+v", rule)
+	}
+	for _, rule := range yamlRegistry.rules {
+		if rule.Name == "recaptcha" {
+			t.Errorf("recaptcha should be disabled by the YAML file")
+		}
+	}
+	writeSignatures(t, yamlFile, "signatures:\n  - name: [\n", base)
+	if err := yamlRegistry.setFile(yamlFile); err == nil || !strings.Contains(err.Error(), "invalid signatures file") {
+		t.Errorf("expected invalid YAML error, got %v", err)
+	}
+	writeSignatures(t, file, `{"signatures": [{"name": "a", "body": ["x"]}, {"name": "a", "body": ["y"]}]}`, base)
+	if err := (&signatureRegistry{}).setFile(file); err == nil || !strings.Contains(err.Error(), "duplicate") {
+		t.Errorf("expected duplicate error, got %v", err)
+	}
+}
+
+func TestSignaturesHandler(t *testing.T) {
+	useTestSignatures(t, newSignatureRegistry())
+
+	w := httptest.NewRecorder()
+	signaturesHandler(w, httptest.NewRequest(http.MethodGet, "/api/signatures", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", w.Code)
+	}
+	var list SignatureList
+	if err := json.Unmarshal(w.Body.Bytes(), &list); err != nil {
+		t.Fatal(err)
+	}
+	if len(list.Signatures) == 0 || list.Signatures[0].Source != signatureSourceBuiltin || list.LoadedAt.IsZero() {
+		t.Errorf("unexpected list %+v", list)
+	}
+
+	w = httptest.NewRecorder()
+	signaturesHandler(w, httptest.NewRequest(http.MethodPost, "/api/signatures", nil))
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("expected 405, got %d", w.Code)
+	}
+}
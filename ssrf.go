@@ -0,0 +1,155 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// defaultDeniedCIDRs are destinations tests may not connect to unless explicitly allowed:
+// loopback, private, link-local (cloud metadata), CGNAT, documentation, multicast and reserved ranges
+var defaultDeniedCIDRs = []string{
+	"0.0.0.0/8",
+	"10.0.0.0/8",
+	"100.64.0.0/10",
+	"127.0.0.0/8",
+	"169.254.0.0/16",
+	"172.16.0.0/12",
+	"192.0.0.0/24",
+	"192.0.2.0/24",
+	"192.168.0.0/16",
+	"198.18.0.0/15",
+	"198.51.100.0/24",
+	"203.0.113.0/24",
+	"224.0.0.0/4",
+	"240.0.0.0/4",
+	"::/128",
+	"::1/128",
+	"2001:db8::/32",
+	"fc00::/7",
+	"fe80::/10",
+	"ff00::/8",
+}
+
+// networkPolicy decides which destination IPs a test may connect to
+// Allowed ranges take precedence over denied ranges
+type networkPolicy struct {
+	allow []*net.IPNet
+	deny  []*net.IPNet
+}
+
+// destinationPolicy is the network policy applied to every outgoing test connection
+var destinationPolicy = mustNetworkPolicy(nil, defaultDeniedCIDRs)
+
+// policyError is returned when a connection is refused by the network policy
+type policyError struct {
+	IP net.IP
+}
+
+func (e *policyError) Error() string {
+	return fmt.Sprintf("destination %s is not allowed", e.IP)
+}
+
+// newNetworkPolicy builds a policy from CIDR strings; bare IPs are treated as single hosts
+func newNetworkPolicy(allow, deny []string) (*networkPolicy, error) {
+	allowNets, err := parseCIDRs(allow)
+	if err != nil {
+		return nil, err
+	}
+	denyNets, err := parseCIDRs(deny)
+	if err != nil {
+		return nil, err
+	}
+	return &networkPolicy{allow: allowNets, deny: denyNets}, nil
+}
+
+// mustNetworkPolicy is like newNetworkPolicy but panics on invalid input
+func mustNetworkPolicy(allow, deny []string) *networkPolicy {
+	p, err := newNetworkPolicy(allow, deny)
+	if err != nil {
+		panic(err)
+	}
+	return p
+}
+
+// loadNetworkPolicy builds the policy from SSRF_ALLOW_CIDRS and SSRF_DENY_CIDRS
+// Denied ranges are added to the defaults
+func loadNetworkPolicy() (*networkPolicy, error) {
+	allow := splitList(os.Getenv("SSRF_ALLOW_CIDRS"))
+	deny := append(append([]string{}, defaultDeniedCIDRs...), splitList(os.Getenv("SSRF_DENY_CIDRS"))...)
+	return newNetworkPolicy(allow, deny)
+}
+
+// check returns a policyError if ip may not be connected to
+func (p *networkPolicy) check(ip net.IP) error {
+	for _, n := range p.allow {
+		if n.Contains(ip) {
+			return nil
+		}
+	}
+	for _, n := range p.deny {
+		if n.Contains(ip) {
+			return &policyError{IP: ip}
+		}
+	}
+	return nil
+}
+
+// guardedDialer returns a dialer that enforces the network policy on the resolved address
+// of every connection. Because the check runs after DNS resolution, right before connect,
+// it applies to every redirect hop and cannot be bypassed with DNS rebinding.
+func guardedDialer() *net.Dialer {
+	return &net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
+		Control: func(network, address string, c syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			ip := net.ParseIP(host)
+			if ip == nil {
+				return fmt.Errorf("unexpected unresolved address %q", address)
+			}
+			return destinationPolicy.check(ip)
+		},
+	}
+}
+
+// parseCIDRs parses CIDR strings, accepting bare IPs as /32 or /128
+func parseCIDRs(values []string) ([]*net.IPNet, error) {
+	nets := make([]*net.IPNet, 0, len(values))
+	for _, value := range values {
+		if !strings.Contains(value, "/") {
+			ip := net.ParseIP(value)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid IP or CIDR %q", value)
+			}
+			if ip.To4() != nil {
+				value += "/32"
+			} else {
+				value += "/128"
+			}
+		}
+		_, n, err := net.ParseCIDR(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid IP or CIDR %q", value)
+		}
+		nets = append(nets, n)
+	}
+	return nets, nil
+}
+
+// splitList splits a comma-separated list, dropping empty entries
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
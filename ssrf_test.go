@@ -0,0 +1,115 @@
+package main
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestNetworkPolicyCheck(t *testing.T) {
+	defaultPolicy := mustNetworkPolicy(nil, defaultDeniedCIDRs)
+	customPolicy := mustNetworkPolicy([]string{"10.1.2.0/24"}, append([]string{"8.8.8.8"}, defaultDeniedCIDRs...))
+
+	tests := []struct {
+		name    string
+		policy  *networkPolicy
+		ip      string
+		allowed bool
+	}{
+		{name: "public IPv4", policy: defaultPolicy, ip: "93.184.216.34", allowed: true},
+		{name: "public IPv6", policy: defaultPolicy, ip: "2606:2800:220:1:248:1893:25c8:1946", allowed: true},
+		{name: "cloud metadata", policy: defaultPolicy, ip: "169.254.169.254", allowed: false},
+		{name: "loopback", policy: defaultPolicy, ip: "127.0.0.1", allowed: false},
+		{name: "IPv6 loopback", policy: defaultPolicy, ip: "::1", allowed: false},
+		{name: "IPv4-mapped loopback", policy: defaultPolicy, ip: "::ffff:127.0.0.1", allowed: false},
+		{name: "RFC1918 10/8", policy: defaultPolicy, ip: "10.0.0.5", allowed: false},
+		{name: "RFC1918 172.16/12", policy: defaultPolicy, ip: "172.20.1.1", allowed: false},
+		{name: "RFC1918 192.168/16", policy: defaultPolicy, ip: "192.168.1.1", allowed: false},
+		{name: "unspecified", policy: defaultPolicy, ip: "0.0.0.0", allowed: false},
+		{name: "IPv6 unique local", policy: defaultPolicy, ip: "fd00:ec2::254", allowed: false},
+		{name: "IPv6 link-local", policy: defaultPolicy, ip: "fe80::1", allowed: false},
+		{name: "allow list overrides deny", policy: customPolicy, ip: "10.1.2.3", allowed: true},
+		{name: "rest of deny range still denied", policy: customPolicy, ip: "10.1.3.3", allowed: false},
+		{name: "extra denied IP", policy: customPolicy, ip: "8.8.8.8", allowed: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.policy.check(net.ParseIP(tt.ip))
+			if tt.allowed && err != nil {
+				t.Errorf("expected %s to be allowed, got %v", tt.ip, err)
+			}
+			if !tt.allowed && err == nil {
+				t.Errorf("expected %s to be denied", tt.ip)
+			}
+		})
+	}
+}
+
+func TestNewNetworkPolicy(t *testing.T) {
+	if _, err := newNetworkPolicy([]string{"not-a-cidr"}, nil); err == nil {
+		t.Errorf("expected error for invalid CIDR")
+	}
+	if _, err := newNetworkPolicy(nil, []string{"10.0.0.0/33"}); err == nil {
+		t.Errorf("expected error for invalid prefix length")
+	}
+	if _, err := newNetworkPolicy([]string{"192.168.1.10", "fd00::1"}, []string{"10.0.0.0/8"}); err != nil {
+		t.Errorf("expected bare IPs to be accepted, got %v", err)
+	}
+}
+
+func TestSSRFProtection(t *testing.T) {
+	saved := destinationPolicy
+	defer func() { destinationPolicy = saved }()
+
+	// Test direct request to a denied address
+	t.Run("loopback blocked", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			t.Errorf("request should not reach the server")
+		}))
+		defer server.Close()
+
+		destinationPolicy = mustNetworkPolicy(nil, defaultDeniedCIDRs)
+		response := testURL(TestRequest{URL: server.URL})
+
+		if response.Success {
+			t.Fatalf("expected failure")
+		}
+		if !response.BlockedByPolicy {
+			t.Errorf("expected blockedByPolicy to be true")
+		}
+		if !strings.HasPrefix(response.Error, "blocked by policy:") {
+			t.Errorf("expected blocked by policy error, got %q", response.Error)
+		}
+	})
+
+	// Test redirect into a denied address is blocked at the hop
+	t.Run("redirect hop blocked", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			http.Redirect(w, r, "http://127.0.0.2/latest/meta-data/", http.StatusFound)
+		}))
+		defer server.Close()
+
+		destinationPolicy = mustNetworkPolicy([]string{"127.0.0.1"}, defaultDeniedCIDRs)
+		response := testURL(TestRequest{URL: server.URL})
+
+		if !response.BlockedByPolicy {
+			t.Errorf("expected blockedByPolicy to be true, got error %q", response.Error)
+		}
+		if len(response.Redirects) != 1 {
+			t.Errorf("expected the allowed redirect hop to be recorded, got %d", len(response.Redirects))
+		}
+	})
+
+	// Test hostnames are checked after resolution
+	t.Run("hostname resolving to loopback", func(t *testing.T) {
+		destinationPolicy = mustNetworkPolicy(nil, defaultDeniedCIDRs)
+		response := testURL(TestRequest{URL: "http://localhost:1/"})
+
+		if !response.BlockedByPolicy {
+			t.Errorf("expected blockedByPolicy to be true, got error %q", response.Error)
+		}
+	})
+}
@@ -0,0 +1,218 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+)
+
+// TLSInfo describes the negotiated TLS connection of the final response
+type TLSInfo struct {
+	Version      string            `json:"version"`
+	CipherSuite  string            `json:"cipherSuite"`
+	ALPN         string            `json:"alpn,omitempty"`
+	ServerName   string            `json:"serverName,omitempty"` // SNI sent by the client
+	Certificates []CertificateInfo `json:"certificates"`         // peer chain, leaf first
+
+	// Set in insecure mode only
+	VerificationSkipped bool          `json:"verificationSkipped,omitempty"`
+	Problems            []CertProblem `json:"problems,omitempty"`
+}
+
+// CertProblem describes one certificate verification problem
+type CertProblem struct {
+	Code    string `json:"code"` // expired, not_yet_valid, hostname_mismatch, unknown_authority, weak_signature, weak_key, invalid_chain
+	Message string `json:"message"`
+	Subject string `json:"subject,omitempty"`
+}
+
+// certVerifyRoots is the root pool used to verify chains in insecure mode (nil uses the system pool)
+var certVerifyRoots *x509.CertPool
+
+// minRSAKeySize is the smallest RSA key size not reported as weak
+const minRSAKeySize = 2048
+
+// weakSignatureAlgorithms lists signature algorithms that are no longer considered secure
+var weakSignatureAlgorithms = map[x509.SignatureAlgorithm]bool{
+	x509.MD2WithRSA:    true,
+	x509.MD5WithRSA:    true,
+	x509.SHA1WithRSA:   true,
+	x509.DSAWithSHA1:   true,
+	x509.ECDSAWithSHA1: true,
+}
+
+// CertificateInfo describes one certificate of the peer chain
+type CertificateInfo struct {
+	Subject            string    `json:"subject"`
+	Issuer             string    `json:"issuer"`
+	SANs               []string  `json:"sans,omitempty"`
+	SerialNumber       string    `json:"serialNumber"`
+	NotBefore          time.Time `json:"notBefore"`
+	NotAfter           time.Time `json:"notAfter"`
+	DaysUntilExpiry    int       `json:"daysUntilExpiry"`
+	SignatureAlgorithm string    `json:"signatureAlgorithm"`
+	KeyType            string    `json:"keyType"`
+	KeySize            int       `json:"keySize,omitempty"` // bits
+}
+
+// buildTLSInfo extracts connection and certificate details from a TLS connection state
+func buildTLSInfo(state *tls.ConnectionState) *TLSInfo {
+	if state == nil {
+		return nil
+	}
+
+	info := &TLSInfo{
+		Version:      tls.VersionName(state.Version),
+		CipherSuite:  tls.CipherSuiteName(state.CipherSuite),
+		ALPN:         state.NegotiatedProtocol,
+		ServerName:   state.ServerName,
+		Certificates: make([]CertificateInfo, 0, len(state.PeerCertificates)),
+	}
+	for _, cert := range state.PeerCertificates {
+		info.Certificates = append(info.Certificates, buildCertificateInfo(cert, time.Now()))
+	}
+	return info
+}
+
+// buildCertificateInfo summarizes a certificate relative to the given time
+func buildCertificateInfo(cert *x509.Certificate, now time.Time) CertificateInfo {
+	keyType, keySize := publicKeyInfo(cert)
+	return CertificateInfo{
+		Subject:            cert.Subject.String(),
+		Issuer:             cert.Issuer.String(),
+		SANs:               subjectAltNames(cert),
+		SerialNumber:       fmt.Sprintf("%X", cert.SerialNumber),
+		NotBefore:          cert.NotBefore,
+		NotAfter:           cert.NotAfter,
+		DaysUntilExpiry:    int(math.Floor(cert.NotAfter.Sub(now).Hours() / 24)),
+		SignatureAlgorithm: cert.SignatureAlgorithm.String(),
+		KeyType:            keyType,
+		KeySize:            keySize,
+	}
+}
+
+// isCertificateError reports whether err was caused by a rejected server certificate
+func isCertificateError(err error) bool {
+	var verificationErr *tls.CertificateVerificationError
+	var unknownAuthorityErr x509.UnknownAuthorityError
+	var hostnameErr x509.HostnameError
+	var invalidErr x509.CertificateInvalidError
+	return errors.As(err, &verificationErr) ||
+		errors.As(err, &unknownAuthorityErr) ||
+		errors.As(err, &hostnameErr) ||
+		errors.As(err, &invalidErr)
+}
+
+// verifyCertificateChain verifies a peer chain against certVerifyRoots and collects every problem
+// instead of stopping at the first one like crypto/tls does
+func verifyCertificateChain(certs []*x509.Certificate, host string, now time.Time) []CertProblem {
+	if len(certs) == 0 {
+		return nil
+	}
+
+	var problems []CertProblem
+	add := func(code, message string, cert *x509.Certificate) {
+		subject := cert.Subject.String()
+		for _, p := range problems {
+			if p.Code == code && p.Subject == subject {
+				return
+			}
+		}
+		problems = append(problems, CertProblem{Code: code, Message: message, Subject: subject})
+	}
+
+	// Validity period, signature and key strength of every certificate
+	validFrom, validUntil := certs[0].NotBefore, certs[0].NotAfter
+	for i, cert := range certs {
+		if now.After(cert.NotAfter) {
+			add("expired", "certificate expired on "+cert.NotAfter.UTC().Format(time.RFC3339), cert)
+		}
+		if now.Before(cert.NotBefore) {
+			add("not_yet_valid", "certificate is not valid before "+cert.NotBefore.UTC().Format(time.RFC3339), cert)
+		}
+		if cert.NotBefore.After(validFrom) {
+			validFrom = cert.NotBefore
+		}
+		if cert.NotAfter.Before(validUntil) {
+			validUntil = cert.NotAfter
+		}
+
+		// The signature on a self-signed root is not relied upon
+		selfSigned := i > 0 && i == len(certs)-1 && cert.Subject.String() == cert.Issuer.String()
+		if weakSignatureAlgorithms[cert.SignatureAlgorithm] && !selfSigned {
+			add("weak_signature", "certificate uses weak signature algorithm "+cert.SignatureAlgorithm.String(), cert)
+		}
+		if key, ok := cert.PublicKey.(*rsa.PublicKey); ok && key.N.BitLen() < minRSAKeySize {
+			add("weak_key", fmt.Sprintf("RSA key is only %d bits", key.N.BitLen()), cert)
+		}
+	}
+
+	// Hostname
+	if err := certs[0].VerifyHostname(host); err != nil {
+		add("hostname_mismatch", err.Error(), certs[0])
+	}
+
+	// Chain of trust, checked at a time when every certificate is valid so that
+	// expiry does not hide an untrusted chain
+	opts := x509.VerifyOptions{
+		Roots:         certVerifyRoots,
+		Intermediates: x509.NewCertPool(),
+		CurrentTime:   now,
+	}
+	if (now.Before(validFrom) || now.After(validUntil)) && validFrom.Before(validUntil) {
+		opts.CurrentTime = validFrom.Add(validUntil.Sub(validFrom) / 2)
+	}
+	for _, cert := range certs[1:] {
+		opts.Intermediates.AddCert(cert)
+	}
+	if _, err := certs[0].Verify(opts); err != nil {
+		var unknownAuthorityErr x509.UnknownAuthorityError
+		var invalidErr x509.CertificateInvalidError
+		var insecureAlgErr x509.InsecureAlgorithmError
+		switch {
+		case errors.As(err, &unknownAuthorityErr):
+			add("unknown_authority", err.Error(), certs[0])
+		case errors.As(err, &insecureAlgErr):
+			add("weak_signature", err.Error(), certs[0])
+		case errors.As(err, &invalidErr) && invalidErr.Reason == x509.Expired:
+			// Already reported per certificate
+		default:
+			add("invalid_chain", err.Error(), certs[0])
+		}
+	}
+
+	return problems
+}
+
+// subjectAltNames lists all DNS, IP, email and URI subject alternative names
+func subjectAltNames(cert *x509.Certificate) []string {
+	var sans []string
+	sans = append(sans, cert.DNSNames...)
+	for _, ip := range cert.IPAddresses {
+		sans = append(sans, ip.String())
+	}
+	sans = append(sans, cert.EmailAddresses...)
+	for _, uri := range cert.URIs {
+		sans = append(sans, uri.String())
+	}
+	return sans
+}
+
+// publicKeyInfo returns the key algorithm and size in bits of a certificate's public key
+func publicKeyInfo(cert *x509.Certificate) (string, int) {
+	switch key := cert.PublicKey.(type) {
+	case *rsa.PublicKey:
+		return "RSA", key.N.BitLen()
+	case *ecdsa.PublicKey:
+		return "ECDSA", key.Curve.Params().BitSize
+	case ed25519.PublicKey:
+		return "Ed25519", 256
+	}
+	return cert.PublicKeyAlgorithm.String(), 0
+}
@@ -0,0 +1,229 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestBuildTLSInfo(t *testing.T) {
+	// Test connection details from a real handshake
+	t.Run("from TLS connection", func(t *testing.T) {
+		server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte("secure"))
+		}))
+		defer server.Close()
+
+		resp, err := server.Client().Get(server.URL)
+		if err != nil {
+			t.Fatalf("request failed: %v", err)
+		}
+		resp.Body.Close()
+
+		info := buildTLSInfo(resp.TLS)
+		if info == nil {
+			t.Fatalf("expected TLS info, got nil")
+		}
+		if info.Version == "" || info.CipherSuite == "" {
+			t.Errorf("expected version and cipher suite, got %q / %q", info.Version, info.CipherSuite)
+		}
+		if len(info.Certificates) == 0 {
+			t.Fatalf("expected peer certificates")
+		}
+
+		leaf := info.Certificates[0]
+		if leaf.KeyType == "" || leaf.KeySize == 0 {
+			t.Errorf("expected key type and size, got %q / %d", leaf.KeyType, leaf.KeySize)
+		}
+		if leaf.SignatureAlgorithm == "" {
+			t.Errorf("expected signature algorithm")
+		}
+		foundSAN := false
+		for _, san := range leaf.SANs {
+			if san == "127.0.0.1" {
+				foundSAN = true
+			}
+		}
+		if !foundSAN {
+			t.Errorf("expected 127.0.0.1 in SANs, got %v", leaf.SANs)
+		}
+	})
+
+	// Test plain HTTP has no TLS section
+	t.Run("nil state", func(t *testing.T) {
+		if info := buildTLSInfo(nil); info != nil {
+			t.Errorf("expected nil TLS info, got %+v", info)
+		}
+	})
+}
+
+// newTestCertificate creates a certificate from template signed by parent (self-signed if parent is nil)
+func newTestCertificate(t *testing.T, template *x509.Certificate, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	if parent == nil {
+		parent, parentKey = template, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatalf("failed to create certificate: %v", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("failed to parse certificate: %v", err)
+	}
+	return cert, key
+}
+
+func TestBuildCertificateInfo(t *testing.T) {
+	now := time.Now()
+	cert, _ := newTestCertificate(t, &x509.Certificate{
+		SerialNumber: big.NewInt(0xABCDEF),
+		Subject:      pkix.Name{CommonName: "test.example.com"},
+		DNSNames:     []string{"test.example.com", "www.test.example.com"},
+		NotBefore:    now.Add(-time.Hour),
+		NotAfter:     now.Add(10*24*time.Hour + time.Hour),
+	}, nil, nil)
+
+	info := buildCertificateInfo(cert, now)
+
+	if info.Subject != "CN=test.example.com" {
+		t.Errorf("expected subject CN=test.example.com, got %q", info.Subject)
+	}
+	if info.SerialNumber != "ABCDEF" {
+		t.Errorf("expected serial ABCDEF, got %q", info.SerialNumber)
+	}
+	if info.DaysUntilExpiry != 10 {
+		t.Errorf("expected 10 days until expiry, got %d", info.DaysUntilExpiry)
+	}
+	if info.KeyType != "ECDSA" || info.KeySize != 256 {
+		t.Errorf("expected ECDSA 256, got %s %d", info.KeyType, info.KeySize)
+	}
+	if info.SignatureAlgorithm != "ECDSA-SHA256" {
+		t.Errorf("expected ECDSA-SHA256, got %q", info.SignatureAlgorithm)
+	}
+	if len(info.SANs) != 2 {
+		t.Errorf("expected 2 SANs, got %v", info.SANs)
+	}
+
+	expired := buildCertificateInfo(cert, now.Add(12*24*time.Hour))
+	if expired.DaysUntilExpiry >= 0 {
+		t.Errorf("expected negative days for expired certificate, got %d", expired.DaysUntilExpiry)
+	}
+}
+
+func TestVerifyCertificateChain(t *testing.T) {
+	now := time.Now()
+
+	// Test every problem is reported, not just the first
+	t.Run("expired self-signed with wrong host", func(t *testing.T) {
+		cert, _ := newTestCertificate(t, &x509.Certificate{
+			SerialNumber: big.NewInt(1),
+			Subject:      pkix.Name{CommonName: "expired.example.com"},
+			DNSNames:     []string{"expired.example.com"},
+			NotBefore:    now.Add(-48 * time.Hour),
+			NotAfter:     now.Add(-24 * time.Hour),
+		}, nil, nil)
+
+		problems := verifyCertificateChain([]*x509.Certificate{cert}, "other.example.com", now)
+
+		codes := map[string]bool{}
+		for _, p := range problems {
+			codes[p.Code] = true
+		}
+		for _, code := range []string{"expired", "hostname_mismatch", "unknown_authority"} {
+			if !codes[code] {
+				t.Errorf("expected problem %q, got %+v", code, problems)
+			}
+		}
+	})
+
+	// Test a chain to a trusted root has no problems
+	t.Run("trusted chain", func(t *testing.T) {
+		ca, caKey := newTestCertificate(t, &x509.Certificate{
+			SerialNumber:          big.NewInt(2),
+			Subject:               pkix.Name{CommonName: "Test Root CA"},
+			NotBefore:             now.Add(-time.Hour),
+			NotAfter:              now.Add(24 * time.Hour),
+			IsCA:                  true,
+			BasicConstraintsValid: true,
+			KeyUsage:              x509.KeyUsageCertSign,
+		}, nil, nil)
+		leaf, _ := newTestCertificate(t, &x509.Certificate{
+			SerialNumber: big.NewInt(3),
+			Subject:      pkix.Name{CommonName: "good.example.com"},
+			DNSNames:     []string{"good.example.com"},
+			NotBefore:    now.Add(-time.Hour),
+			NotAfter:     now.Add(24 * time.Hour),
+			ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		}, ca, caKey)
+
+		roots := x509.NewCertPool()
+		roots.AddCert(ca)
+		certVerifyRoots = roots
+		defer func() { certVerifyRoots = nil }()
+
+		problems := verifyCertificateChain([]*x509.Certificate{leaf, ca}, "good.example.com", now)
+
+		if len(problems) != 0 {
+			t.Errorf("expected no problems, got %+v", problems)
+		}
+	})
+}
+
+func TestInsecureMode(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Test", "reached")
+		w.Write([]byte("secure content"))
+	}))
+	defer server.Close()
+
+	// Test untrusted certificate fails by default
+	t.Run("verification enabled", func(t *testing.T) {
+		response := testURL(TestRequest{URL: server.URL})
+
+		if response.Success {
+			t.Errorf("expected failure for untrusted certificate")
+		}
+	})
+
+	// Test insecure mode returns the response and lists problems
+	t.Run("insecure retry", func(t *testing.T) {
+		response := testURL(TestRequest{URL: server.URL, Insecure: true})
+
+		if !response.Success {
+			t.Fatalf("expected success, got failure: %s", response.Error)
+		}
+		if response.StatusCode != 200 || response.BodyPreview != "secure content" {
+			t.Errorf("expected full response, got %d %q", response.StatusCode, response.BodyPreview)
+		}
+		if response.Headers["X-Test"] != "reached" {
+			t.Errorf("expected response headers, got %v", response.Headers)
+		}
+		if response.TLS == nil {
+			t.Fatalf("expected TLS info")
+		}
+		if !response.TLS.VerificationSkipped {
+			t.Errorf("expected verificationSkipped to be true")
+		}
+		found := false
+		for _, p := range response.TLS.Problems {
+			if p.Code == "unknown_authority" {
+				found = true
+			}
+		}
+		if !found {
+			t.Errorf("expected unknown_authority problem, got %+v", response.TLS.Problems)
+		}
+	})
+}
@@ -0,0 +1,222 @@
+package main
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptrace"
+	"sync"
+	"time"
+)
+
+// PhaseTimings holds the timing breakdown of a single request/response exchange (one hop)
+// All durations are in milliseconds
+type PhaseTimings struct {
+	URL             string  `json:"url"`
+	Start           float64 `json:"start"` // offset from the start of the test
+	DNSLookup       float64 `json:"dnsLookup"`
+	TCPConnect      float64 `json:"tcpConnect"`
+	TLSHandshake    float64 `json:"tlsHandshake"`
+	TimeToFirstByte float64 `json:"timeToFirstByte"` // request written until first response byte
+	ContentTransfer float64 `json:"contentTransfer"`
+	Total           float64 `json:"total"`
+	ConnReused      bool    `json:"connReused"`
+}
+
+// hopTimer collects httptrace events and the response status for one hop
+type hopTimer struct {
+	mu           sync.Mutex
+	start        time.Time
+	dnsStart     time.Time
+	dnsDone      time.Time
+	connectStart time.Time
+	connectDone  time.Time
+	tlsStart     time.Time
+	tlsDone      time.Time
+	gotConn      time.Time
+	wroteRequest time.Time
+	firstByte    time.Time
+	transfer     time.Duration
+	reused       bool
+	remoteAddr   string
+	url          string
+	statusCode   int
+	header       http.Header
+
+	// Request and response details kept for HAR export
+	method        string
+	host          string
+	requestHeader http.Header
+	requestSize   int64
+	proto         string
+}
+
+// clientTrace returns the httptrace hooks that record events into the timer
+func (h *hopTimer) clientTrace() *httptrace.ClientTrace {
+	record := func(field *time.Time, first bool) {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		// Happy Eyeballs may dial several addresses; keep the first start and last finish
+		if first && !field.IsZero() {
+			return
+		}
+		*field = time.Now()
+	}
+	return &httptrace.ClientTrace{
+		DNSStart:     func(httptrace.DNSStartInfo) { record(&h.dnsStart, true) },
+		DNSDone:      func(httptrace.DNSDoneInfo) { record(&h.dnsDone, false) },
+		ConnectStart: func(string, string) { record(&h.connectStart, true) },
+		ConnectDone:  func(string, string, error) { record(&h.connectDone, false) },
+		TLSHandshakeStart: func() {
+			record(&h.tlsStart, true)
+		},
+		TLSHandshakeDone: func(tls.ConnectionState, error) {
+			record(&h.tlsDone, false)
+		},
+		GotConn: func(info httptrace.GotConnInfo) {
+			h.mu.Lock()
+			h.reused = info.Reused
+			h.gotConn = time.Now()
+			if info.Conn != nil {
+				h.remoteAddr = info.Conn.RemoteAddr().String()
+			}
+			h.mu.Unlock()
+		},
+		WroteRequest:         func(httptrace.WroteRequestInfo) { record(&h.wroteRequest, false) },
+		GotFirstResponseByte: func() { record(&h.firstByte, false) },
+	}
+}
+
+// timings converts the recorded events into a PhaseTimings relative to testStart
+func (h *hopTimer) timings(testStart time.Time) PhaseTimings {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	t := PhaseTimings{
+		URL:             h.url,
+		Start:           durationMillis(h.start.Sub(testStart)),
+		DNSLookup:       phaseMillis(h.dnsStart, h.dnsDone),
+		TCPConnect:      phaseMillis(h.connectStart, h.connectDone),
+		TLSHandshake:    phaseMillis(h.tlsStart, h.tlsDone),
+		TimeToFirstByte: phaseMillis(h.wroteRequest, h.firstByte),
+		ContentTransfer: durationMillis(h.transfer),
+		ConnReused:      h.reused,
+	}
+	if !h.firstByte.IsZero() {
+		t.Total = durationMillis(h.firstByte.Sub(h.start)) + t.ContentTransfer
+	}
+	return t
+}
+
+// tracingTransport wraps a RoundTripper and records phase timings and responses for
+// every hop, including each request made while following redirects
+type tracingTransport struct {
+	base  http.RoundTripper
+	start time.Time
+
+	mu   sync.Mutex
+	hops []*hopTimer
+}
+
+// newTracingTransport creates a tracing wrapper around base
+func newTracingTransport(base http.RoundTripper) *tracingTransport {
+	return &tracingTransport{base: base, start: time.Now()}
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *tracingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	host := req.Host
+	if host == "" {
+		host = req.URL.Host
+	}
+	hop := &hopTimer{
+		start:         time.Now(),
+		url:           req.URL.String(),
+		method:        req.Method,
+		host:          host,
+		requestHeader: req.Header.Clone(),
+		requestSize:   req.ContentLength,
+	}
+	t.mu.Lock()
+	t.hops = append(t.hops, hop)
+	t.mu.Unlock()
+
+	ctx := httptrace.WithClientTrace(req.Context(), hop.clientTrace())
+	resp, err := t.base.RoundTrip(req.WithContext(ctx))
+	if err == nil {
+		hop.mu.Lock()
+		hop.statusCode = resp.StatusCode
+		hop.header = resp.Header
+		hop.proto = resp.Proto
+		hop.mu.Unlock()
+	}
+	return resp, err
+}
+
+// finishTransfer records the body transfer duration on the last hop
+func (t *tracingTransport) finishTransfer(d time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if len(t.hops) == 0 {
+		return
+	}
+	last := t.hops[len(t.hops)-1]
+	last.mu.Lock()
+	last.transfer = d
+	last.mu.Unlock()
+}
+
+// timings returns the recorded timings for every hop in order
+func (t *tracingTransport) timings() []PhaseTimings {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	result := make([]PhaseTimings, 0, len(t.hops))
+	for _, hop := range t.hops {
+		result = append(result, hop.timings(t.start))
+	}
+	return result
+}
+
+// redirects returns the hops that answered with a redirect. When the request completed,
+// the last hop is the final response and is never part of the chain.
+func (t *tracingTransport) redirects(completed bool) []RedirectHop {
+	t.mu.Lock()
+	hops := t.hops
+	t.mu.Unlock()
+
+	if completed && len(hops) > 0 {
+		hops = hops[:len(hops)-1]
+	}
+
+	var chain []RedirectHop
+	for _, hop := range hops {
+		hop.mu.Lock()
+		statusCode, header := hop.statusCode, hop.header
+		hop.mu.Unlock()
+
+		location := header.Get("Location")
+		if statusCode < 300 || statusCode >= 400 || location == "" {
+			continue
+		}
+		chain = append(chain, RedirectHop{
+			URL:        hop.url,
+			StatusCode: statusCode,
+			Location:   location,
+			Headers:    firstHeaderValues(header),
+			Timing:     hop.timings(t.start),
+		})
+	}
+	return chain
+}
+
+// phaseMillis returns the duration between two events in milliseconds, or 0 if either is missing
+func phaseMillis(start, end time.Time) float64 {
+	if start.IsZero() || end.IsZero() || end.Before(start) {
+		return 0
+	}
+	return durationMillis(end.Sub(start))
+}
+
+// durationMillis converts a duration to milliseconds with microsecond precision
+func durationMillis(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestTracingTransport(t *testing.T) {
+	// Test single hop timings
+	t.Run("single hop", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			time.Sleep(20 * time.Millisecond)
+			w.Write([]byte("ok"))
+		}))
+		defer server.Close()
+
+		response := testURL(TestRequest{URL: server.URL})
+
+		if len(response.Timings) != 1 {
+			t.Fatalf("expected 1 hop, got %d", len(response.Timings))
+		}
+		hop := response.Timings[0]
+		if hop.URL != server.URL {
+			t.Errorf("expected hop URL %q, got %q", server.URL, hop.URL)
+		}
+		if hop.TimeToFirstByte < 20 {
+			t.Errorf("expected time to first byte >= 20ms, got %v", hop.TimeToFirstByte)
+		}
+		if hop.Total < hop.TimeToFirstByte {
+			t.Errorf("expected total >= time to first byte, got %v < %v", hop.Total, hop.TimeToFirstByte)
+		}
+		if hop.TLSHandshake != 0 {
+			t.Errorf("expected no TLS handshake for plain HTTP, got %v", hop.TLSHandshake)
+		}
+	})
+
+	// Test one timing entry per redirect hop
+	t.Run("redirect hops", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/start" {
+				http.Redirect(w, r, "/end", http.StatusFound)
+				return
+			}
+			w.Write([]byte("done"))
+		}))
+		defer server.Close()
+
+		response := testURL(TestRequest{URL: server.URL + "/start"})
+
+		if len(response.Timings) != 2 {
+			t.Fatalf("expected 2 hops, got %d", len(response.Timings))
+		}
+		if response.Timings[1].URL != server.URL+"/end" {
+			t.Errorf("expected second hop URL %q, got %q", server.URL+"/end", response.Timings[1].URL)
+		}
+		if response.Timings[1].Start < response.Timings[0].Start {
+			t.Errorf("expected hops in chronological order")
+		}
+		if response.Timings[0].ContentTransfer != 0 {
+			t.Errorf("expected content transfer only on final hop")
+		}
+	})
+
+	// Test TLS handshake is measured
+	t.Run("tls handshake", func(t *testing.T) {
+		server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte("secure"))
+		}))
+		defer server.Close()
+
+		tracer := newTracingTransport(server.Client().Transport)
+		resp, err := createHTTPClient(tracer, nil).Get(server.URL)
+		if err != nil {
+			t.Fatalf("request failed: %v", err)
+		}
+		resp.Body.Close()
+
+		timings := tracer.timings()
+		if len(timings) != 1 {
+			t.Fatalf("expected 1 hop, got %d", len(timings))
+		}
+		if timings[0].TLSHandshake <= 0 {
+			t.Errorf("expected TLS handshake time, got %v", timings[0].TLSHandshake)
+		}
+	})
+}
+
+func TestRedirectChain(t *testing.T) {
+	// Test every redirect hop is reported
+	t.Run("multi-hop chain", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.URL.Path {
+			case "/a":
+				w.Header().Set("Set-Cookie", "session=1")
+				http.Redirect(w, r, "/b", http.StatusMovedPermanently)
+			case "/b":
+				http.Redirect(w, r, "/login?next=/a", http.StatusFound)
+			default:
+				w.Write([]byte("login page"))
+			}
+		}))
+		defer server.Close()
+
+		response := testURL(TestRequest{URL: server.URL + "/a"})
+
+		if !response.Success {
+			t.Fatalf("expected success, got failure: %s", response.Error)
+		}
+		if len(response.Redirects) != 2 {
+			t.Fatalf("expected 2 redirects, got %d", len(response.Redirects))
+		}
+
+		first := response.Redirects[0]
+		if first.URL != server.URL+"/a" || first.StatusCode != 301 || first.Location != "/b" {
+			t.Errorf("unexpected first hop: %+v", first)
+		}
+		if first.Headers["Set-Cookie"] != "session=1" {
+			t.Errorf("expected hop headers to be recorded, got %v", first.Headers)
+		}
+		if first.Timing.Total <= 0 {
+			t.Errorf("expected hop timing, got %v", first.Timing.Total)
+		}
+
+		second := response.Redirects[1]
+		if second.StatusCode != 302 || second.Location != "/login?next=/a" {
+			t.Errorf("unexpected second hop: %+v", second)
+		}
+		if response.FinalURL != server.URL+"/login?next=/a" {
+			t.Errorf("expected final URL %q, got %q", server.URL+"/login?next=/a", response.FinalURL)
+		}
+	})
+
+	// Test no chain without redirects
+	t.Run("no redirects", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte("ok"))
+		}))
+		defer server.Close()
+
+		response := testURL(TestRequest{URL: server.URL})
+
+		if len(response.Redirects) != 0 {
+			t.Errorf("expected no redirects, got %d", len(response.Redirects))
+		}
+	})
+}